@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/pkg/fake_ktmine"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":7100", "listen address")
+	fixtures := flag.String("fixtures", "", "JSON array or JSONL file of KTMine items (generated when empty)")
+	count := flag.Int("patents", fake_ktmine.DefaultPatentCount, "number of generated patents")
+	apiKey := flag.String("key", "", "required API key (any key accepted when empty)")
+	latency := flag.Duration("latency", 0, "latency added to every request")
+	throttleRate := flag.Float64("throttle-rate", 0, "probability of a 429 response")
+	errorRate := flag.Float64("error-rate", 0, "probability of a 500 response")
+	retryAfter := flag.Int("retry-after", 1, "Retry-After seconds sent with 429 responses")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for injected faults")
+	flag.Parse()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	patents := fake_ktmine.GeneratePatents(*count)
+	if *fixtures != "" {
+		loaded, err := fake_ktmine.LoadPatents(*fixtures)
+		if err != nil {
+			panic(fmt.Sprintf("failed to load fixtures: %s", err))
+		}
+		patents = loaded
+	}
+
+	server := fake_ktmine.NewServer(fake_ktmine.Options{
+		Patents:      patents,
+		APIKey:       *apiKey,
+		Latency:      *latency,
+		ThrottleRate: *throttleRate,
+		ErrorRate:    *errorRate,
+		RetryAfter:   *retryAfter,
+		Seed:         *seed,
+	})
+	log.Info("fake ktmine started", slog.String("addr", *addr), slog.Int("patents", len(patents)))
+	if err := http.ListenAndServe(*addr, server.Handler()); err != nil {
+		panic(fmt.Sprintf("error while running fake ktmine: %s", err))
+	}
+}
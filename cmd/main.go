@@ -17,12 +17,26 @@ import (
 func main() {
 	cfg := config.LoadConfig()
 	log := setUpLogger(cfg.ENV)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		exitOnError(runMigrate(os.Args[2:], cfg, log))
+		return
+	}
 	repo := repository.NewRepository(log, cfg)
 	serv := service.NewService(log, repo, cfg)
 	handl := handler.NewHandler(log, serv)
 	srv := new(internal.Server)
-	ctx := context.Background()
-	go handl.HandlePatentUpload(ctx)
+	ctx, stopConsumer := context.WithCancel(context.Background())
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		handl.HandlePatentUpload(ctx)
+	}()
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		handl.RelayOutbox(relayCtx)
+	}()
 	go func() {
 		log.Info("server started on port: 8080")
 		if err := srv.Run("7000", handl.InitRoutes()); err != nil {
@@ -33,8 +47,14 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
 	<-quit
+	// let uploads in progress finish before the process exits
+	stopConsumer()
+	<-consumerDone
+	// the relay runs once more on stop, publishing the results of the drained uploads
+	stopRelay()
+	<-relayDone
 	if err := srv.ShutDown(context.Background()); err != nil {
-		log.Error("error while shutting down: %s", err.Error())
+		log.Error("error while shutting down", slog.String("error", err.Error()))
 	}
 }
 func setUpLogger(env string) *slog.Logger {
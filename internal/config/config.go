@@ -4,25 +4,84 @@ import (
 	"github.com/joho/godotenv"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Config struct {
-	KTMineURL           string
-	KTMineAPIKey        string
-	DBPort              string
-	DBUsername          string
-	DBPassword          string
-	DBHost              string
-	SSLMode             string
-	DBName              string
-	ENV                 string
-	BrokerURL           string
-	BrokerConsumeQueue  string
-	BrokerPublishQueue  string
-	BrokerPrefetchCount int
+	KTMineURL              string
+	KTMineAPIKey           string
+	DBPort                 string
+	DBUsername             string
+	DBPassword             string
+	DBHost                 string
+	SSLMode                string
+	DBName                 string
+	ENV                    string
+	BrokerURL              string
+	BrokerConsumeQueue     string
+	BrokerPublishQueue     string
+	BrokerPrefetchCount    int
+	KTMineMaxRetries       int
+	KTMineRetryBaseWait    time.Duration
+	KTMineRetryMaxWait     time.Duration
+	KTMineRateLimit        float64
+	KTMineRateBurst        int
+	KTMineBreakerThreshold int
+	KTMineBreakerCooldown  time.Duration
+	// KTMineRequestTimeout bounds one request to KTMine, including reading
+	// the response; a hung request counts as a failure towards the breaker.
+	KTMineRequestTimeout time.Duration
+	BrokerRequeueDelay   time.Duration
+	// BrokerConsumerWorkers is the number of upload requests handled at once,
+	// capped at BrokerPrefetchCount; 0 uses the prefetch count.
+	BrokerConsumerWorkers int
+	BrokerShutdownTimeout time.Duration
+	// BrokerReconnectBaseWait and BrokerReconnectMaxWait bound the backoff
+	// between attempts to reach the broker.
+	BrokerReconnectBaseWait time.Duration
+	BrokerReconnectMaxWait  time.Duration
+	// BrokerMaxAttempts is how often an upload request is tried before it is
+	// dead-lettered; retries wait BrokerRequeueDelay, doubling up to
+	// BrokerRetryMaxDelay.
+	BrokerMaxAttempts        int
+	BrokerRetryMaxDelay      time.Duration
+	BrokerDeadLetterExchange string
+	BrokerDeadLetterQueue    string
+	// OutboxRelayInterval is how often pending outbox messages are published
+	// when no upload wakes the relay earlier; OutboxRelayBatchSize is how many
+	// are published per round. OutboxRelayLease is how long a round keeps its
+	// messages from other relays; it should cover publishing a whole batch.
+	OutboxRelayInterval  time.Duration
+	OutboxRelayBatchSize int
+	OutboxRelayLease     time.Duration
+	// UploadEventsExchange and UploadEventsRoutingKey address the lifecycle
+	// events of broker uploads; no events are published when both are empty.
+	// UploadEventsProgressPages is the number of pages between progress
+	// events, 0 disables them.
+	UploadEventsExchange      string
+	UploadEventsRoutingKey    string
+	UploadEventsProgressPages int
+	PatentProvider            string
+	PatentFilesDir            string
+	UploadFetchWorkers        int
+	UploadParseWorkers        int
+	UploadBatchSize           int
+	UploadMemoryLimit         int64
+	DBWriteMode               string
+	// FamilyJurisdictionPreference is the default order in which family
+	// deduplication picks a family's representative.
+	FamilyJurisdictionPreference []string
 }
 
+// DB write modes: multi-row INSERT statements, or COPY into staging tables
+// that are then merged into the patent tables.
+const (
+	DBWriteInsert = "insert"
+	DBWriteCopy   = "copy"
+)
+
 var (
 	config *Config
 	once   sync.Once
@@ -38,20 +97,93 @@ func LoadConfig() *Config {
 			panic("failed to parse config")
 		}
 		config = &Config{
-			KTMineURL:           os.Getenv("KTMINE_URL"),
-			KTMineAPIKey:        os.Getenv("KTMINE_API_KEY"),
-			DBPort:              os.Getenv("DB_PORT"),
-			DBUsername:          os.Getenv("DB_USERNAME"),
-			DBPassword:          os.Getenv("DB_PASSWORD"),
-			DBHost:              os.Getenv("DB_HOST"),
-			SSLMode:             os.Getenv("SSL_MODE"),
-			ENV:                 os.Getenv("ENV"),
-			DBName:              os.Getenv("DB_NAME"),
-			BrokerURL:           os.Getenv("BROKER_URL"),
-			BrokerConsumeQueue:  os.Getenv("BROKER_CONSUME_QUEUE"),
-			BrokerPublishQueue:  os.Getenv("BROKER_PUBLISH_QUEUE"),
-			BrokerPrefetchCount: brokerPrefetchCount,
+			KTMineURL:                 os.Getenv("KTMINE_URL"),
+			KTMineAPIKey:              os.Getenv("KTMINE_API_KEY"),
+			DBPort:                    os.Getenv("DB_PORT"),
+			DBUsername:                os.Getenv("DB_USERNAME"),
+			DBPassword:                os.Getenv("DB_PASSWORD"),
+			DBHost:                    os.Getenv("DB_HOST"),
+			SSLMode:                   os.Getenv("SSL_MODE"),
+			ENV:                       os.Getenv("ENV"),
+			DBName:                    os.Getenv("DB_NAME"),
+			BrokerURL:                 os.Getenv("BROKER_URL"),
+			BrokerConsumeQueue:        os.Getenv("BROKER_CONSUME_QUEUE"),
+			BrokerPublishQueue:        os.Getenv("BROKER_PUBLISH_QUEUE"),
+			BrokerPrefetchCount:       brokerPrefetchCount,
+			KTMineMaxRetries:          getEnvInt("KTMINE_MAX_RETRIES", 4),
+			KTMineRetryBaseWait:       time.Duration(getEnvInt("KTMINE_RETRY_BASE_WAIT_MS", 500)) * time.Millisecond,
+			KTMineRetryMaxWait:        time.Duration(getEnvInt("KTMINE_RETRY_MAX_WAIT_MS", 30000)) * time.Millisecond,
+			KTMineRateLimit:           getEnvFloat("KTMINE_RATE_LIMIT", 10),
+			KTMineRateBurst:           getEnvInt("KTMINE_RATE_BURST", 8),
+			KTMineBreakerThreshold:    getEnvInt("KTMINE_BREAKER_THRESHOLD", 5),
+			KTMineBreakerCooldown:     time.Duration(getEnvInt("KTMINE_BREAKER_COOLDOWN_MS", 30000)) * time.Millisecond,
+			KTMineRequestTimeout:      time.Duration(getEnvInt("KTMINE_REQUEST_TIMEOUT_MS", 30000)) * time.Millisecond,
+			BrokerRequeueDelay:        time.Duration(getEnvInt("BROKER_REQUEUE_DELAY_MS", 30000)) * time.Millisecond,
+			BrokerConsumerWorkers:     getEnvInt("BROKER_CONSUMER_WORKERS", 0),
+			BrokerShutdownTimeout:     time.Duration(getEnvInt("BROKER_SHUTDOWN_TIMEOUT_MS", 60000)) * time.Millisecond,
+			BrokerReconnectBaseWait:   time.Duration(getEnvInt("BROKER_RECONNECT_BASE_WAIT_MS", 1000)) * time.Millisecond,
+			BrokerReconnectMaxWait:    time.Duration(getEnvInt("BROKER_RECONNECT_MAX_WAIT_MS", 30000)) * time.Millisecond,
+			BrokerMaxAttempts:         getEnvInt("BROKER_MAX_ATTEMPTS", 5),
+			BrokerRetryMaxDelay:       time.Duration(getEnvInt("BROKER_RETRY_MAX_DELAY_MS", 600000)) * time.Millisecond,
+			BrokerDeadLetterExchange:  os.Getenv("BROKER_DEAD_LETTER_EXCHANGE"),
+			BrokerDeadLetterQueue:     os.Getenv("BROKER_DEAD_LETTER_QUEUE"),
+			OutboxRelayInterval:       time.Duration(getEnvInt("OUTBOX_RELAY_INTERVAL_MS", 1000)) * time.Millisecond,
+			OutboxRelayBatchSize:      getEnvInt("OUTBOX_RELAY_BATCH_SIZE", 100),
+			OutboxRelayLease:          time.Duration(getEnvInt("OUTBOX_RELAY_LEASE_MS", 300000)) * time.Millisecond,
+			UploadEventsExchange:      os.Getenv("UPLOAD_EVENTS_EXCHANGE"),
+			UploadEventsRoutingKey:    os.Getenv("UPLOAD_EVENTS_ROUTING_KEY"),
+			UploadEventsProgressPages: getEnvInt("UPLOAD_EVENTS_PROGRESS_PAGES", 5),
+			PatentProvider:            os.Getenv("PATENT_PROVIDER"),
+			PatentFilesDir:            os.Getenv("PATENT_FILES_DIR"),
+			UploadFetchWorkers:        getEnvPositiveInt("UPLOAD_FETCH_WORKERS", 8),
+			UploadParseWorkers:        getEnvPositiveInt("UPLOAD_PARSE_WORKERS", 2),
+			UploadBatchSize:           getEnvInt("UPLOAD_BATCH_SIZE", 500),
+			UploadMemoryLimit:         int64(getEnvInt("UPLOAD_MEMORY_LIMIT_MB", 256)) << 20,
+			DBWriteMode:               getEnv("DB_WRITE_MODE", DBWriteInsert),
+			FamilyJurisdictionPreference: strings.Split(
+				getEnv("FAMILY_JURISDICTION_PREFERENCE", "US,EP,WO,GB,DE,CN,JP,KR"), ","),
 		}
 	})
 	return config
 }
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		panic("failed to parse config: " + key)
+	}
+	return parsed
+}
+
+// getEnvPositiveInt is getEnvInt for settings that need at least 1, such as
+// worker counts: with none, an upload would complete without saving anything.
+func getEnvPositiveInt(key string, fallback int) int {
+	parsed := getEnvInt(key, fallback)
+	if parsed < 1 {
+		panic("invalid config: " + key + " must be at least 1")
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		panic("failed to parse config: " + key)
+	}
+	return parsed
+}
@@ -0,0 +1,21 @@
+package config
+
+import "testing"
+
+func TestGetEnvPositiveIntRejectsValuesBelowOne(t *testing.T) {
+	for _, value := range []string{"0", "-1"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("UPLOAD_FETCH_WORKERS", value)
+			defer func() {
+				if recover() == nil {
+					t.Errorf("UPLOAD_FETCH_WORKERS=%s was accepted", value)
+				}
+			}()
+			getEnvPositiveInt("UPLOAD_FETCH_WORKERS", 8)
+		})
+	}
+	t.Setenv("UPLOAD_FETCH_WORKERS", "")
+	if got := getEnvPositiveInt("UPLOAD_FETCH_WORKERS", 8); got != 8 {
+		t.Errorf("default = %d, want 8", got)
+	}
+}
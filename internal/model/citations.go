@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// Citation is an edge of the citation graph: the patent CitingNumber cites
+// CitedNumber. Numbers are normalized publication numbers without kind code,
+// since citations rarely name the kind that was eventually stored.
+type Citation struct {
+	CitingNumber string `json:"citing_number" db:"citing_number"`
+	CitedNumber  string `json:"cited_number" db:"cited_number"`
+	// Category is the search report category, e.g. "X" or "A", when known.
+	Category string `json:"category,omitempty" db:"category"`
+}
+
+// NonPatentCitation is a literature reference cited by a patent.
+type NonPatentCitation struct {
+	CitingNumber string `json:"citing_number" db:"citing_number"`
+	Position     int    `json:"position" db:"position"`
+	Text         string `json:"text" db:"text"`
+}
+
+// PatentCitations holds what a provider reported about a patent's citations.
+// Backward citations are the documents the patent cites, forward citations
+// the later patents citing it; both become edges in the same direction.
+type PatentCitations struct {
+	Backward  []Citation          `json:"backward"`
+	Forward   []Citation          `json:"forward"`
+	NonPatent []NonPatentCitation `json:"non_patent"`
+}
+
+// Edges returns the backward and forward citations as one edge list.
+func (c PatentCitations) Edges() []Citation {
+	edges := make([]Citation, 0, len(c.Backward)+len(c.Forward))
+	edges = append(edges, c.Backward...)
+	return append(edges, c.Forward...)
+}
+
+// CitationNode is a publication number within a citation neighbourhood.
+// PatentId is set when the patent itself is stored.
+type CitationNode struct {
+	PublicationNumber string     `json:"publication_number" db:"publication_number"`
+	Distance          int        `json:"distance" db:"distance"`
+	PatentId          *uuid.UUID `json:"patent_id,omitempty" db:"patent_id"`
+}
+
+// CitationNeighbourhood is the part of the citation graph within Depth
+// citations of a patent, in either direction.
+type CitationNeighbourhood struct {
+	PublicationNumber string              `json:"publication_number"`
+	Depth             int                 `json:"depth"`
+	Nodes             []CitationNode      `json:"nodes"`
+	Edges             []Citation          `json:"edges"`
+	NonPatent         []NonPatentCitation `json:"non_patent_citations"`
+	// Truncated is set when the neighbourhood had more nodes than are returned.
+	Truncated bool `json:"truncated"`
+}
+
+// CitationNeighbourhoodInput selects a neighbourhood. Depth defaults to 1 and
+// is capped at 3; MaxNodes bounds how much of a dense graph is returned.
+type CitationNeighbourhoodInput struct {
+	PublicationNumber string
+	Depth             int
+	MaxNodes          int
+}
+
+func (i *CitationNeighbourhoodInput) Validate() error {
+	if i.PublicationNumber == "" {
+		return fmt.Errorf("publication number is required")
+	}
+	if i.Depth < 0 || i.Depth > 3 {
+		return fmt.Errorf("depth must be between 1 and 3")
+	}
+	if i.MaxNodes < 0 {
+		return fmt.Errorf("max_nodes must not be negative")
+	}
+	return nil
+}
+
+func (i *CitationNeighbourhoodInput) Sanitize() {
+	if i.Depth == 0 {
+		i.Depth = 1
+	}
+	if i.MaxNodes == 0 || i.MaxNodes > 1000 {
+		i.MaxNodes = 1000
+	}
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CPCClassification is one CPC symbol of a patent split into its hierarchy
+// levels, e.g. H04L9/32 is section H, class 04, subclass L, group 9 and
+// subgroup 32. Symbols are stored without spaces.
+type CPCClassification struct {
+	Symbol   string `json:"symbol" db:"symbol"`
+	Section  string `json:"section" db:"section"`
+	Class    string `json:"class" db:"class"`
+	Subclass string `json:"subclass" db:"subclass"`
+	Group    string `json:"group" db:"main_group"`
+	Subgroup string `json:"subgroup" db:"subgroup"`
+	// Inventive is true for classifications of the invention itself and false
+	// for additional information classifications.
+	Inventive bool `json:"inventive" db:"inventive"`
+}
+
+// CPCPattern selects a node of the CPC hierarchy and everything below it.
+// "H04L" and "H04L*" both select every symbol of subclass H04L, "H04L9/32"
+// selects that subgroup only and "H04L9/32*" also the subgroups numbered
+// below it, such as H04L9/3213.
+type CPCPattern struct {
+	CPCClassification
+	// Wildcard is set when the pattern ended in "*".
+	Wildcard bool
+}
+
+// ParseCPC splits a CPC symbol such as "H04L 9/32" into its levels. Partial
+// symbols down to the section are accepted.
+func ParseCPC(symbol string) (CPCClassification, error) {
+	pattern, err := parseCPC(symbol, false)
+	return pattern.CPCClassification, err
+}
+
+// NewCPCClassification builds the classification of a symbol as received
+// from a provider. A symbol that does not parse keeps its text without levels
+// so it is stored rather than dropped.
+func NewCPCClassification(symbol string, inventive bool) CPCClassification {
+	classification, err := ParseCPC(symbol)
+	if err != nil {
+		classification = CPCClassification{Symbol: strings.ToUpper(strings.Join(strings.Fields(symbol), ""))}
+	}
+	classification.Inventive = inventive
+	return classification
+}
+
+// ParseCPCPattern parses a CPC filter value, a possibly partial symbol
+// optionally followed by "*".
+func ParseCPCPattern(value string) (CPCPattern, error) {
+	return parseCPC(value, true)
+}
+
+func parseCPC(value string, allowWildcard bool) (CPCPattern, error) {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(value), ""))
+	var pattern CPCPattern
+	if allowWildcard && strings.HasSuffix(normalized, "*") {
+		pattern.Wildcard = true
+		normalized = strings.TrimSuffix(normalized, "*")
+	}
+	invalid := func(reason string) (CPCPattern, error) {
+		return CPCPattern{}, fmt.Errorf("invalid CPC symbol %q: %s", value, reason)
+	}
+
+	rest := normalized
+	if rest == "" {
+		return invalid("empty")
+	}
+	if !strings.ContainsRune("ABCDEFGHY", rune(rest[0])) {
+		return invalid("section must be one of A-H or Y")
+	}
+	pattern.Section, rest = rest[:1], rest[1:]
+	if rest != "" {
+		if len(rest) < 2 || !isDigits(rest[:2]) {
+			return invalid("class must be two digits")
+		}
+		pattern.Class, rest = rest[:2], rest[2:]
+	}
+	if rest != "" {
+		if rest[0] < 'A' || rest[0] > 'Z' {
+			return invalid("subclass must be a letter")
+		}
+		pattern.Subclass, rest = rest[:1], rest[1:]
+	}
+	if rest != "" {
+		group, subgroup, hasSubgroup := strings.Cut(rest, "/")
+		if group == "" || len(group) > 4 || !isDigits(group) {
+			return invalid("group must be one to four digits")
+		}
+		pattern.Group = strings.TrimLeft(group, "0")
+		if pattern.Group == "" {
+			pattern.Group = "0"
+		}
+		if hasSubgroup {
+			if !isDigits(subgroup) || len(subgroup) > 6 || (subgroup == "" && !pattern.Wildcard) {
+				return invalid("subgroup must be digits")
+			}
+			pattern.Subgroup = subgroup
+		}
+	}
+	pattern.Symbol = pattern.Section + pattern.Class + pattern.Subclass + pattern.Group
+	if pattern.Subgroup != "" {
+		pattern.Symbol += "/" + pattern.Subgroup
+	}
+	return pattern, nil
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the canonical form of the pattern, as sent to KTMine. A
+// wildcard on a group is written "H04L9/*" so a plain text prefix match does
+// not also pick up group 90.
+func (p CPCPattern) String() string {
+	switch {
+	case p.Wildcard && p.Group != "" && p.Subgroup == "":
+		return p.Symbol + "/*"
+	case p.Wildcard:
+		return p.Symbol + "*"
+	}
+	return p.Symbol
+}
+
+// Match reports whether a classification lies at or below the pattern in the
+// CPC hierarchy.
+func (p CPCPattern) Match(c CPCClassification) bool {
+	levels := [][2]string{
+		{p.Section, c.Section},
+		{p.Class, c.Class},
+		{p.Subclass, c.Subclass},
+		{p.Group, c.Group},
+	}
+	for _, level := range levels {
+		if level[0] != "" && level[0] != level[1] {
+			return false
+		}
+	}
+	if p.Subgroup == "" {
+		return true
+	}
+	if p.Wildcard {
+		return strings.HasPrefix(c.Subgroup, p.Subgroup)
+	}
+	return p.Subgroup == c.Subgroup
+}
+
+// MatchCPCSymbol reports whether a raw symbol matches a raw pattern; values
+// that do not parse never match.
+func MatchCPCSymbol(pattern, symbol string) bool {
+	parsedPattern, err := ParseCPCPattern(pattern)
+	if err != nil {
+		return false
+	}
+	classification, err := ParseCPC(symbol)
+	if err != nil {
+		return false
+	}
+	return parsedPattern.Match(classification)
+}
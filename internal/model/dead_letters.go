@@ -0,0 +1,62 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeadLetter is an upload request that failed permanently or ran out of
+// attempts, as kept in the dead-letter queue.
+type DeadLetter struct {
+	MessageId     string     `json:"message_id"`
+	Reason        string     `json:"reason"`
+	Attempts      int        `json:"attempts"`
+	FailedAt      *time.Time `json:"failed_at,omitempty"`
+	OriginalQueue string     `json:"original_queue"`
+	// Body is the request as received, which need not be valid JSON.
+	Body string `json:"body"`
+}
+
+// DeadLetterListInput pages through the dead-letter queue from its head.
+type DeadLetterListInput struct {
+	Limit int
+}
+
+func (i *DeadLetterListInput) Validate() error {
+	if i.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+func (i *DeadLetterListInput) Sanitize() {
+	if i.Limit == 0 || i.Limit > 100 {
+		i.Limit = 100
+	}
+}
+
+// DeadLetterReplayInput selects dead letters to send back to the upload
+// queue: the listed message ids, or the first Limit messages when none are
+// listed.
+type DeadLetterReplayInput struct {
+	MessageIds []string `json:"message_ids"`
+	Limit      int      `json:"limit"`
+}
+
+func (i *DeadLetterReplayInput) Validate() error {
+	if i.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+func (i *DeadLetterReplayInput) Sanitize() {
+	if i.Limit == 0 || i.Limit > 100 {
+		i.Limit = 100
+	}
+}
+
+type DeadLetterReplayOutput struct {
+	Replayed   int      `json:"replayed"`
+	MessageIds []string `json:"message_ids"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "errors"
+
+// ErrUpstreamUnavailable is returned when the patent search backend is known
+// to be down and requests are rejected without being sent.
+var ErrUpstreamUnavailable = errors.New("patent search backend unavailable")
+
+// ErrInvalidFilters is returned when user supplied filters cannot be translated.
+var ErrInvalidFilters = errors.New("invalid filters")
+
+// ErrJobNotFound is returned when no upload job exists for a transaction id.
+var ErrJobNotFound = errors.New("upload job not found")
+
+// ErrInvalidPayload is returned when an upload request cannot be processed as
+// sent, so retrying it cannot succeed.
+var ErrInvalidPayload = errors.New("invalid upload payload")
+
+// ErrBrokerUnavailable is returned when the message broker is not connected.
+var ErrBrokerUnavailable = errors.New("message broker unavailable")
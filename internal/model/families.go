@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// FamilyType selects the family definition used to collapse an upload.
+type FamilyType string
+
+const (
+	// InpadocFamily groups patents linked by a shared priority, directly or
+	// through other members.
+	InpadocFamily FamilyType = "inpadoc"
+	// SimpleFamily groups patents that claim exactly the same priorities.
+	SimpleFamily FamilyType = "simple"
+)
+
+func (f FamilyType) Valid() bool {
+	switch f {
+	case InpadocFamily, SimpleFamily:
+		return true
+	}
+	return false
+}
+
+// FamilyDedupOptions configures family deduplication of an upload. The
+// representative of a family is the member from the first jurisdiction in
+// JurisdictionPreference; members from unlisted jurisdictions come last and
+// ties go to the lowest publication number.
+type FamilyDedupOptions struct {
+	Family                 FamilyType `json:"family"`
+	JurisdictionPreference []string   `json:"jurisdiction_preference,omitempty"`
+}
+
+func (o *FamilyDedupOptions) Validate() error {
+	if o.Family != "" && !o.Family.Valid() {
+		return fmt.Errorf("unknown family %q, expected %s or %s", o.Family, InpadocFamily, SimpleFamily)
+	}
+	return nil
+}
+
+// Sanitize defaults to INPADOC families and the given jurisdiction
+// preference, and upper-cases jurisdiction codes.
+func (o *FamilyDedupOptions) Sanitize(defaultPreference []string) {
+	if o.Family == "" {
+		o.Family = InpadocFamily
+	}
+	if len(o.JurisdictionPreference) == 0 {
+		o.JurisdictionPreference = defaultPreference
+	}
+	preference := make([]string, 0, len(o.JurisdictionPreference))
+	for _, jurisdiction := range o.JurisdictionPreference {
+		if jurisdiction = strings.ToUpper(strings.TrimSpace(jurisdiction)); jurisdiction != "" {
+			preference = append(preference, jurisdiction)
+		}
+	}
+	o.JurisdictionPreference = preference
+}
+
+// FamilyMember is a saved patent of an upload with the data needed to group
+// it into families.
+type FamilyMember struct {
+	Id                uuid.UUID `db:"id"`
+	PublicationNumber string    `db:"publication_number"`
+	Authority         string    `db:"authority"`
+	InpadocFamily     string    `db:"inpadoc_family"`
+	SimpleFamilyKey   string    `db:"simple_family_key"`
+}
+
+// FamilySuppression records a patent left out of a bundle in favour of the
+// representative of its family.
+type FamilySuppression struct {
+	RepresentativeId uuid.UUID
+	SuppressedId     uuid.UUID
+	Family           FamilyType
+}
@@ -6,7 +6,7 @@ import (
 
 type UploadFilterOperator string
 
-var advancedAggs = []map[string]string{
+var AdvancedAggs = []map[string]string{
 	{"field": "current_assignee.party_name.raw", "name": "Current Assignee", "type": "terms"},
 	{"field": "document_country", "name": "Document Country", "type": "terms"},
 	{"field": "legal_status", "name": "Legal Status", "type": "terms"},
@@ -19,6 +19,14 @@ const (
 	NotOperator UploadFilterOperator = "not"
 )
 
+func (o UploadFilterOperator) Valid() bool {
+	switch o {
+	case AndOperator, OrOperator, NotOperator:
+		return true
+	}
+	return false
+}
+
 type SingleParsedFilter struct {
 	Criteria       []string              `json:"criteria"`
 	SearchField    string                `json:"searchField"`
@@ -49,6 +57,9 @@ type FilterInterface interface {
 	GetFilters() []SingleParsedFilter
 }
 
+// RedactedValue replaces secrets in request bodies shown to clients.
+const RedactedValue = "[REDACTED]"
+
 type FiltersRequestBody struct {
 	Filters      []SingleParsedFilter `json:"filters"`
 	ReturnFields []string             `json:"returnFields"`
@@ -100,6 +111,21 @@ func NewStatisticsRequestBody(filters []SingleParsedFilter, key string) Statisti
 		Start:        0,
 		Count:        0,
 		Key:          key,
-		AdvancedAggs: advancedAggs,
+		AdvancedAggs: AdvancedAggs,
 	}
 }
+
+// PatentQuery is a provider-independent request for a page of patents.
+// Full asks for descriptions, abstracts and claims on top of the bibliographic fields.
+type PatentQuery struct {
+	Filters   []SingleParsedFilter
+	Offset    int
+	Limit     int
+	PreFilter *bool
+	Full      bool
+}
+
+type PatentStatistics struct {
+	Aggregations map[string]interface{}
+	TotalFound   int
+}
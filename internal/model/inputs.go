@@ -1,15 +1,34 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"time"
 )
 
 type UploadInput struct {
-	PublicationNumbers []string `json:"publication_numbers" validate:"required"`
-	CollectionId       uuid.UUID
-	UserId             uuid.UUID
+	PublicationNumbers []string   `json:"publication_numbers" validate:"required"`
+	BundleId           uuid.UUID  `json:"bundle_id" validate:"required"`
+	TransactionId      uuid.UUID  `json:"transaction_id"`
+	CollectionId       *uuid.UUID `json:"collection_id"`
+	UserId             *uuid.UUID `json:"user_id"`
+}
+
+func (u *UploadInput) Validate() error {
+	if len(u.PublicationNumbers) == 0 {
+		return errors.New("publication_numbers must not be empty")
+	}
+	if u.BundleId == uuid.Nil {
+		return errors.New("bundle_id is required")
+	}
+	return nil
+}
+
+func (u *UploadInput) Sanitize() {
+	if u.TransactionId == uuid.Nil {
+		u.TransactionId = uuid.New()
+	}
 }
 
 type CustomDate struct {
@@ -26,9 +45,37 @@ func (c *CustomDate) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// OpenDateBound is sent in place of an omitted min or max date.
+const OpenDateBound = "*"
+
+// DateInFilter is one date range; either bound may be omitted. Several
+// ranges on a field are combined with their operator, "or" by default.
 type DateInFilter struct {
-	Min CustomDate `json:"min,omitempty"`
-	Max CustomDate `json:"max,omitempty"`
+	Min      *CustomDate           `json:"min,omitempty"`
+	Max      *CustomDate           `json:"max,omitempty"`
+	Operator *UploadFilterOperator `json:"operator"`
+}
+
+func (d DateInFilter) Validate() error {
+	if d.Min == nil && d.Max == nil {
+		return errors.New("date range needs min or max")
+	}
+	if d.Min != nil && d.Max != nil && d.Min.After(d.Max.Time) {
+		return fmt.Errorf("min %s is after max %s", d.Min.Format("2006-01-02"), d.Max.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// Bounds returns the range as a [min, max] criteria pair.
+func (d DateInFilter) Bounds() []string {
+	bounds := []string{OpenDateBound, OpenDateBound}
+	if d.Min != nil {
+		bounds[0] = d.Min.Format("2006-01-02")
+	}
+	if d.Max != nil {
+		bounds[1] = d.Max.Format("2006-01-02")
+	}
+	return bounds
 }
 
 type SingleFilter struct {
@@ -37,20 +84,22 @@ type SingleFilter struct {
 }
 
 type Filters struct {
-	DocumentNumber  *[]string       `json:"document_number,omitempty"`
-	ApplicationDate *[]DateInFilter `json:"application_date,omitempty"`
-	PublicationDate *[]DateInFilter `json:"publication_date,omitempty"`
-	CurrentAssignee *[]SingleFilter `json:"current_assignee,omitempty"`
-	Inventor        *[]SingleFilter `json:"inventor,omitempty"`
-	CurrentOwner    *[]SingleFilter `json:"current_owner,omitempty"`
-	DocumentCountry *[]SingleFilter `json:"document_country,omitempty"`
-	TopLevelCPC     *[]SingleFilter `json:"top_level_cpc,omitempty"`
-	CPCCode         *[]SingleFilter `json:"cpc_code,omitempty"`
-	LegalStatus     *[]SingleFilter `json:"legal_status,omitempty"`
-	TermsFilters    *string         `json:"terms_filter_simplified,omitempty"`
-	PreFilter       *bool           `json:"pre_filter"`
-	Limit           *int            `json:"limit"`
-	Offset          *int            `json:"offset"`
+	DocumentNumber       *[]string       `json:"document_number,omitempty"`
+	ApplicationDate      *[]DateInFilter `json:"application_date,omitempty"`
+	PublicationDate      *[]DateInFilter `json:"publication_date,omitempty"`
+	EarliestPriorityDate *[]DateInFilter `json:"earliest_priority_date,omitempty"`
+	EstimatedExpiryDate  *[]DateInFilter `json:"estimated_expiry_date,omitempty"`
+	CurrentAssignee      *[]SingleFilter `json:"current_assignee,omitempty"`
+	Inventor             *[]SingleFilter `json:"inventor,omitempty"`
+	CurrentOwner         *[]SingleFilter `json:"current_owner,omitempty"`
+	DocumentCountry      *[]SingleFilter `json:"document_country,omitempty"`
+	TopLevelCPC          *[]SingleFilter `json:"top_level_cpc,omitempty"`
+	CPCCode              *[]SingleFilter `json:"cpc_code,omitempty"`
+	LegalStatus          *[]SingleFilter `json:"legal_status,omitempty"`
+	TermsFilters         *string         `json:"terms_filter_simplified,omitempty"`
+	PreFilter            *bool           `json:"pre_filter"`
+	Limit                *int            `json:"limit"`
+	Offset               *int            `json:"offset"`
 }
 
 func (f *Filters) Sanitize() {
@@ -64,9 +113,20 @@ func (f *Filters) Sanitize() {
 	}
 }
 
+// UploadPageSize is the number of patents a filter upload fetches per
+// provider request.
+const UploadPageSize = 20
+
 type UploadPatentPayload struct {
 	BundleId      uuid.UUID  `json:"bundle_id"`
 	TransactionId uuid.UUID  `json:"transaction_id"`
 	CollectionId  *uuid.UUID `json:"collection_id"`
 	Filters       Filters    `json:"filters"`
+	// AllOrNothing saves the whole upload in one transaction instead of
+	// committing it batch by batch; a failed upload then leaves nothing behind
+	// and is restarted from the first page.
+	AllOrNothing bool `json:"all_or_nothing"`
+	// FamilyDedup, when set, keeps one representative per patent family in the
+	// bundle once all pages are saved.
+	FamilyDedup *FamilyDedupOptions `json:"family_dedup,omitempty"`
 }
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+type UploadJobState string
+
+const (
+	JobPending   UploadJobState = "pending"
+	JobRunning   UploadJobState = "running"
+	JobCompleted UploadJobState = "completed"
+	JobFailed    UploadJobState = "failed"
+)
+
+func (s UploadJobState) Valid() bool {
+	switch s {
+	case JobPending, JobRunning, JobCompleted, JobFailed:
+		return true
+	}
+	return false
+}
+
+// UploadJob is the durable record of one filter upload received from the broker.
+type UploadJob struct {
+	TransactionId uuid.UUID       `json:"transaction_id" db:"transaction_id"`
+	BundleId      uuid.UUID       `json:"bundle_id" db:"bundle_id"`
+	Filters       json.RawMessage `json:"filters" db:"filters"`
+	State         UploadJobState  `json:"state" db:"state"`
+	TotalPatents  int             `json:"total_patents" db:"total_patents"`
+	PagesFetched  int             `json:"pages_fetched" db:"pages_fetched"`
+	PatentsParsed int             `json:"patents_parsed" db:"patents_parsed"`
+	PatentsSaved  int             `json:"patents_saved" db:"patents_saved"`
+	Inserted      int             `json:"patents_inserted" db:"patents_inserted"`
+	Updated       int             `json:"patents_updated" db:"patents_updated"`
+	Unchanged     int             `json:"patents_unchanged" db:"patents_unchanged"`
+	Collapsed     int             `json:"patents_collapsed" db:"patents_collapsed"`
+	Error         *string         `json:"error,omitempty" db:"error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" db:"updated_at"`
+	FinishedAt    *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// UploadJobListInput filters the upload job list. Jobs are returned newest first.
+type UploadJobListInput struct {
+	BundleId *uuid.UUID
+	State    *UploadJobState
+	Limit    int
+	Offset   int
+}
+
+func (i *UploadJobListInput) Validate() error {
+	if i.State != nil && !i.State.Valid() {
+		return fmt.Errorf("unknown state %q", *i.State)
+	}
+	if i.Limit < 0 || i.Offset < 0 {
+		return fmt.Errorf("limit and offset must not be negative")
+	}
+	return nil
+}
+
+func (i *UploadJobListInput) Sanitize() {
+	if i.Limit == 0 || i.Limit > 100 {
+		i.Limit = 100
+	}
+}
+
+// PatentBatch is a group of fetched pages of an upload job that is committed
+// in one transaction, together with the checkpoints of those pages.
+type PatentBatch struct {
+	TransactionId uuid.UUID
+	BundleId      uuid.UUID
+	Patents       []FilteredFullPatent
+	PageOffsets   []int
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// OutboxMessage is a broker message stored in the same transaction as the
+// change it announces and published by the outbox relay once committed.
+type OutboxMessage struct {
+	Id uuid.UUID `db:"id"`
+	// Key deduplicates messages: a message whose key is already in the outbox
+	// is dropped, so redoing the change does not announce it twice.
+	Key string `db:"message_key"`
+	// Exchange and RoutingKey address the message; both empty sends it to the
+	// result queue.
+	Exchange   string    `db:"exchange"`
+	RoutingKey string    `db:"routing_key"`
+	Payload    []byte    `db:"payload"`
+	Attempts   int       `db:"attempts"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// NewUploadResultMessage is the result of a broker upload for the analyzer.
+func NewUploadResultMessage(transactionId uuid.UUID, payload []byte) OutboxMessage {
+	return OutboxMessage{
+		Id:        uuid.New(),
+		Key:       "upload-result:" + transactionId.String(),
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+}
+
+// NewUploadEventMessage is a lifecycle event of a broker upload. Events are
+// never deduplicated, since an upload retried by the broker goes through its
+// lifecycle again.
+func NewUploadEventMessage(exchange, routingKey string, payload []byte) OutboxMessage {
+	id := uuid.New()
+	return OutboxMessage{
+		Id:         id,
+		Key:        "upload-event:" + id.String(),
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		Payload:    payload,
+		CreatedAt:  time.Now(),
+	}
+}
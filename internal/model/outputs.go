@@ -1,9 +1,76 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"time"
+)
 
 type AnalyzePatentsOutput struct {
 	TransactionId uuid.UUID  `json:"transaction_id"`
 	BundleId      uuid.UUID  `json:"bundle_id"`
 	UserId        *uuid.UUID `json:"user_id,omitempty"`
+	SaveStats
+	// Collapsed counts the family members left out of the bundle by family
+	// deduplication.
+	Collapsed int `json:"collapsed"`
+}
+
+type UploadReport struct {
+	TransactionId uuid.UUID `json:"transaction_id"`
+	BundleId      uuid.UUID `json:"bundle_id"`
+	Found         []string  `json:"found"`
+	NotFound      []string  `json:"not_found"`
+	Duplicates    []string  `json:"duplicates"`
+	TotalSaved    int       `json:"total_saved"`
+	SaveStats
+}
+
+// FilterExplanation describes what an upload with the given filters would
+// send to the patent provider, without fetching or saving anything.
+type FilterExplanation struct {
+	Request               FiltersRequestBody `json:"request"`
+	TotalFound            int                `json:"total_found"`
+	PageSize              int                `json:"page_size"`
+	EstimatedCalls        int                `json:"estimated_calls"`
+	EstimatedPayloadBytes int                `json:"estimated_payload_bytes"`
+	Warnings              []string           `json:"warnings"`
+}
+
+type CircuitBreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// BrokerStatus reports the broker connection. Since is when it was last
+// established or lost.
+type BrokerStatus struct {
+	Connected  bool       `json:"connected"`
+	Since      *time.Time `json:"since,omitempty"`
+	Reconnects int        `json:"reconnects"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+type ServiceStatus struct {
+	KTMine CircuitBreakerStatus `json:"ktmine"`
+	Broker BrokerStatus         `json:"broker"`
+}
+
+// Ready reports whether the service can take upload requests.
+func (s ServiceStatus) Ready() bool {
+	return s.Broker.Connected
+}
+
+// SaveStats counts what saving a set of patents did to the patent table.
+type SaveStats struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+func (s *SaveStats) Add(other SaveStats) {
+	s.Inserted += other.Inserted
+	s.Updated += other.Updated
+	s.Unchanged += other.Unchanged
 }
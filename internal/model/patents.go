@@ -18,30 +18,49 @@ type ParsedPatentsData struct {
 }
 
 type ParsedPatent struct {
-	Id                             uuid.UUID `json:"id"`
-	Title                          string    `json:"title"`
-	Abstract                       string    `json:"abstract"`
-	CPC                            string    `json:"cpc"`
-	EarliestPriorityDate           time.Time `json:"earliest_priority_date"`
-	EstimatedExpiryDate            time.Time `json:"estimated_expiry_date"`
-	PublicationNumber              string    `json:"documentNumber"`
-	CountOfCitedByPatents          int       `json:"count_of_cited_by_patents"`
-	Description                    string    `json:"description"`
-	BriefDescriptionOfDrawings     string    `json:"brief_description_of_drawings"`
-	SimpleLegalStatus              string    `json:"simple_legal_status"`
-	InpadocFamily                  string    `json:"inpadoc_family"`
-	InpadocFamilyApplicationCount  int       `json:"inpadoc_family_application_count"`
-	InpadocFamilyJurisdiction      string    `json:"inpadoc_family_jurisdiction"`
-	InpadocFamilyJurisdictionCount int       `json:"inpadoc_family_jurisdiction_count"`
-	Authority                      string    `json:"authority"`
-	ApplicationDate                time.Time `json:"application_date"`
-	ApplicationNumber              string    `json:"application_number"`
-	IssueDate                      time.Time `json:"issue_date"`
-	PublicationDate                time.Time `json:"publication_date"`
-	FirstClaim                     string    `json:"first_claim"`
-	TotalNumberOfClaims            int       `json:"total_number_of_claims"`
-	TotalNumberOfIndependentClaims int       `json:"total_number_of_independent_claims"`
-	FileURL                        string    `json:"file_url"`
+	Id                             uuid.UUID           `json:"id"`
+	Title                          string              `json:"title"`
+	Abstract                       string              `json:"abstract"`
+	CPC                            string              `json:"cpc"`
+	CPCClassifications             []CPCClassification `json:"cpc_classifications"`
+	EarliestPriorityDate           time.Time           `json:"earliest_priority_date"`
+	EstimatedExpiryDate            time.Time           `json:"estimated_expiry_date"`
+	PublicationNumber              string              `json:"documentNumber"`
+	CountOfCitedByPatents          int                 `json:"count_of_cited_by_patents"`
+	Citations                      PatentCitations     `json:"citations"`
+	Description                    string              `json:"description"`
+	BriefDescriptionOfDrawings     string              `json:"brief_description_of_drawings"`
+	SimpleLegalStatus              string              `json:"simple_legal_status"`
+	InpadocFamily                  string              `json:"inpadoc_family"`
+	InpadocFamilyApplicationCount  int                 `json:"inpadoc_family_application_count"`
+	InpadocFamilyJurisdiction      string              `json:"inpadoc_family_jurisdiction"`
+	InpadocFamilyJurisdictionCount int                 `json:"inpadoc_family_jurisdiction_count"`
+	SimpleFamilyKey                string              `json:"simple_family_key"`
+	Authority                      string              `json:"authority"`
+	ApplicationDate                time.Time           `json:"application_date"`
+	ApplicationNumber              string              `json:"application_number"`
+	IssueDate                      time.Time           `json:"issue_date"`
+	PublicationDate                time.Time           `json:"publication_date"`
+	FirstClaim                     string              `json:"first_claim"`
+	TotalNumberOfClaims            int                 `json:"total_number_of_claims"`
+	TotalNumberOfIndependentClaims int                 `json:"total_number_of_independent_claims"`
+	FileURL                        string              `json:"file_url"`
+}
+
+// SetClaimCounts fills the claim summary fields from the grouped claims of the
+// patent: the first claim is the lowest numbered independent claim.
+func (p *ParsedPatent) SetClaimCounts(claims []Claim) {
+	p.FirstClaim = ""
+	p.TotalNumberOfClaims = 0
+	p.TotalNumberOfIndependentClaims = len(claims)
+	firstNumber := 0
+	for _, claim := range claims {
+		p.TotalNumberOfClaims += 1 + len(claim.DependantClaims)
+		if p.FirstClaim == "" || claim.ClaimNumber < firstNumber {
+			p.FirstClaim = claim.IndependentClaim
+			firstNumber = claim.ClaimNumber
+		}
+	}
 }
 
 type Inventor struct {
@@ -119,4 +138,8 @@ type FilteredFullPatent struct {
 	ID          uuid.UUID
 	Description string
 	Abstract    string
+	Claims      []Claim
+	// Details holds the bibliographic fields beyond the core columns. It is
+	// nil when the provider returned a summary instead of a full patent.
+	Details *ParsedPatent
 }
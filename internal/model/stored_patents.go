@@ -0,0 +1,47 @@
+package model
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// StoredPatent is a patent as saved in the database, with its CPC
+// classifications in the provider's order.
+type StoredPatent struct {
+	Id                uuid.UUID           `json:"id" db:"id"`
+	PublicationNumber string              `json:"publication_number" db:"publication_number"`
+	Title             string              `json:"title" db:"title"`
+	Authority         *string             `json:"authority" db:"authority"`
+	PublicationDate   *time.Time          `json:"publication_date" db:"publication_date"`
+	SimpleLegalStatus *string             `json:"simple_legal_status" db:"simple_legal_status"`
+	CPC               []CPCClassification `json:"cpc" db:"-"`
+}
+
+// PatentListInput filters stored patents, ordered by publication number. A
+// patent matches CPC when any of its symbols lies under any of the patterns,
+// see CPCPattern.
+type PatentListInput struct {
+	BundleId *uuid.UUID
+	CPC      []string
+	Limit    int
+	Offset   int
+}
+
+func (i *PatentListInput) Validate() error {
+	for _, value := range i.CPC {
+		if _, err := ParseCPCPattern(value); err != nil {
+			return err
+		}
+	}
+	if i.Limit < 0 || i.Offset < 0 {
+		return fmt.Errorf("limit and offset must not be negative")
+	}
+	return nil
+}
+
+func (i *PatentListInput) Sanitize() {
+	if i.Limit == 0 || i.Limit > 100 {
+		i.Limit = 100
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+type UploadEventType string
+
+const (
+	UploadStarted   UploadEventType = "started"
+	UploadProgress  UploadEventType = "progress"
+	UploadCompleted UploadEventType = "completed"
+	UploadFailed    UploadEventType = "failed"
+)
+
+// UploadEvent reports a step in the lifecycle of a broker upload. Every event
+// carries the transaction and bundle; the other fields depend on Type.
+type UploadEvent struct {
+	Type          UploadEventType `json:"type"`
+	TransactionId uuid.UUID       `json:"transaction_id"`
+	BundleId      uuid.UUID       `json:"bundle_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	// CorrelationId is the id of the broker message that requested the upload.
+	// It is the only key of a failed event whose payload could not be read.
+	CorrelationId string `json:"correlation_id,omitempty"`
+	// TotalPatents, TotalPages, PagesDone and PatentsParsed describe the
+	// progress of started and progress events. PagesDone includes the pages
+	// saved by earlier attempts; PatentsParsed only counts this attempt.
+	TotalPatents  int `json:"total_patents,omitempty"`
+	TotalPages    int `json:"total_pages,omitempty"`
+	PagesDone     int `json:"pages_done,omitempty"`
+	PatentsParsed int `json:"patents_parsed,omitempty"`
+	// SaveStats and Collapsed are the counts of a completed upload.
+	SaveStats *SaveStats `json:"save_stats,omitempty"`
+	Collapsed int        `json:"collapsed,omitempty"`
+	// ErrorClass and Error describe why an upload failed.
+	ErrorClass UploadErrorClass `json:"error_class,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// UploadErrorClass groups upload failures by what the user can do about them.
+// Invalid payloads and filters fail the same way when retried; the other
+// classes are retried by the broker.
+type UploadErrorClass string
+
+const (
+	UploadErrorInvalidPayload      UploadErrorClass = "invalid_payload"
+	UploadErrorInvalidFilters      UploadErrorClass = "invalid_filters"
+	UploadErrorUpstreamUnavailable UploadErrorClass = "upstream_unavailable"
+	UploadErrorCancelled           UploadErrorClass = "cancelled"
+	UploadErrorInternal            UploadErrorClass = "internal"
+)
+
+func ClassifyUploadError(err error) UploadErrorClass {
+	switch {
+	case errors.Is(err, ErrInvalidPayload):
+		return UploadErrorInvalidPayload
+	case errors.Is(err, ErrInvalidFilters):
+		return UploadErrorInvalidFilters
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return UploadErrorUpstreamUnavailable
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return UploadErrorCancelled
+	default:
+		return UploadErrorInternal
+	}
+}
+
+type correlationIdKey struct{}
+
+// WithCorrelationId returns a copy of ctx carrying the correlation id of the
+// broker message being handled.
+func WithCorrelationId(ctx context.Context, correlationId string) context.Context {
+	return context.WithValue(ctx, correlationIdKey{}, correlationId)
+}
+
+// CorrelationIdFrom returns the correlation id carried by ctx, if any.
+func CorrelationIdFrom(ctx context.Context) string {
+	correlationId, _ := ctx.Value(correlationIdKey{}).(string)
+	return correlationId
+}
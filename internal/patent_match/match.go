@@ -0,0 +1,256 @@
+// Package patent_match evaluates parsed filters and statistics aggregations
+// locally, for the providers without a search backend of their own: the file
+// repository and the fake KTMine server. Both describe their patents as a
+// Patent, so the same filter gets the same answer from either.
+package patent_match
+
+import (
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/query"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AggregationSize is the number of buckets returned per aggregation, as in
+// KTMine's terms aggregations.
+const AggregationSize = 10
+
+// Patent is a patent as seen by the filters. Zero dates never match a date
+// range.
+type Patent struct {
+	PublicationNumber string
+	Country           string
+	LegalStatus       string
+	Title             string
+	Abstract          []string
+	Claims            []string
+	Descriptions      []string
+	Assignees         []string
+	// CurrentOwners is matched by current_owner filters; when empty, the
+	// assignees are used instead.
+	CurrentOwners        []string
+	Inventors            []string
+	CPC                  []string
+	ApplicationDate      time.Time
+	PublicationDate      time.Time
+	EarliestPriorityDate time.Time
+	EstimatedExpiryDate  time.Time
+}
+
+// MatchFilters reports whether p matches every filter.
+func MatchFilters(p *Patent, filters []model.SingleParsedFilter) bool {
+	for _, filter := range filters {
+		if !matchFilter(p, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchFilter(p *Patent, filter model.SingleParsedFilter) bool {
+	operator := model.AndOperator
+	if filter.FilterOperator != nil {
+		operator = *filter.FilterOperator
+	}
+
+	matchedCount := 0
+	total := len(filter.Criteria)
+	if date, ok := dateField(p, filter.SearchField); ok {
+		total = len(filter.Criteria) / 2
+		for i := 0; i+1 < len(filter.Criteria); i += 2 {
+			if inDateRange(date, filter.Criteria[i], filter.Criteria[i+1]) {
+				matchedCount++
+			}
+		}
+	} else {
+		for _, criterion := range filter.Criteria {
+			if matchCriterion(p, filter.SearchField, criterion) {
+				matchedCount++
+			}
+		}
+	}
+	switch operator {
+	case model.OrOperator:
+		return matchedCount > 0
+	case model.NotOperator:
+		return matchedCount == 0
+	default:
+		return matchedCount == total
+	}
+}
+
+func dateField(p *Patent, field string) (time.Time, bool) {
+	switch field {
+	case "patent.applicationdate":
+		return p.ApplicationDate, true
+	case "patent.publicationdate":
+		return p.PublicationDate, true
+	case "patent.earliestprioritydate":
+		return p.EarliestPriorityDate, true
+	case "patent.estimatedexpirydate":
+		return p.EstimatedExpiryDate, true
+	}
+	return time.Time{}, false
+}
+
+// matchCriterion matches one criterion of a filter. Unknown fields never
+// match, so a filter the providers cannot evaluate is not silently ignored.
+func matchCriterion(p *Patent, field, criterion string) bool {
+	switch field {
+	case "patent.documentnumber":
+		return utils.MatchPublicationNumber(
+			utils.NormalizePublicationNumber(criterion),
+			utils.NormalizePublicationNumber(p.PublicationNumber),
+		)
+	case "patent.currentassignee":
+		return containsFold(p.Assignees, criterion)
+	case "patent.currentowner":
+		if len(p.CurrentOwners) == 0 {
+			return containsFold(p.Assignees, criterion)
+		}
+		return containsFold(p.CurrentOwners, criterion)
+	case "patent.inventor":
+		return containsFold(p.Inventors, criterion)
+	case "patent.documentcountry":
+		return strings.EqualFold(p.Country, criterion)
+	case "patent.legalstatus":
+		return strings.EqualFold(p.LegalStatus, criterion)
+	case "patent.toplevelcpc", "patent.cpccode":
+		for _, cpc := range p.CPC {
+			if model.MatchCPCSymbol(criterion, cpc) {
+				return true
+			}
+		}
+		return false
+	case "patent.fulltext":
+		return matchFullText(p, criterion)
+	}
+	return false
+}
+
+func containsFold(values []string, criterion string) bool {
+	criterion = strings.ToLower(criterion)
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), criterion) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDateRange checks one [min, max] pair produced by ParseFilters, where
+// model.OpenDateBound stands for an omitted bound.
+func inDateRange(value time.Time, minBound, maxBound string) bool {
+	if value.IsZero() {
+		return false
+	}
+	if minBound != model.OpenDateBound {
+		if minDate, err := time.Parse("2006-01-02", minBound); err == nil && value.Before(minDate) {
+			return false
+		}
+	}
+	if maxBound != model.OpenDateBound {
+		if maxDate, err := time.Parse("2006-01-02", maxBound); err == nil && value.After(maxDate) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchFullText evaluates the Lucene query built by
+// APIClient.parseTermsFilters against the patent's text fields.
+func matchFullText(p *Patent, criterion string) bool {
+	node, err := query.Parse(criterion)
+	if err != nil {
+		return false
+	}
+	return node.Match(p)
+}
+
+// Text exposes the patent under the KTMine field names used in queries.
+func (p *Patent) Text(field string) []string {
+	switch field {
+	case "invention_title":
+		return []string{p.Title}
+	case "abstract_paragraphs.plain_text":
+		return p.Abstract
+	case "claims.plain_text":
+		return p.Claims
+	case "descriptions.plain_text":
+		return p.Descriptions
+	case "classifications_cpc.symbol":
+		return p.CPC
+	case "current_assignee.party_name":
+		return p.Assignees
+	case "":
+		texts := make([]string, 0, 1+len(p.Abstract)+len(p.Descriptions)+len(p.Claims))
+		texts = append(texts, p.Title)
+		texts = append(texts, p.Abstract...)
+		texts = append(texts, p.Descriptions...)
+		return append(texts, p.Claims...)
+	}
+	return nil
+}
+
+type Bucket struct {
+	Key      string `json:"key"`
+	DocCount int    `json:"doc_count"`
+}
+
+// Aggregate computes the requested terms aggregations over patents, in the
+// shape of KTMine's aggregation response.
+func Aggregate(patents []*Patent, aggs []map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(aggs))
+	for _, agg := range aggs {
+		counts := make(map[string]int)
+		for _, p := range patents {
+			for _, key := range aggregationKeys(p, agg["field"]) {
+				counts[key]++
+			}
+		}
+		buckets := make([]Bucket, 0, len(counts))
+		for key, count := range counts {
+			buckets = append(buckets, Bucket{Key: key, DocCount: count})
+		}
+		sort.Slice(buckets, func(i, j int) bool {
+			if buckets[i].DocCount != buckets[j].DocCount {
+				return buckets[i].DocCount > buckets[j].DocCount
+			}
+			return buckets[i].Key < buckets[j].Key
+		})
+		if len(buckets) > AggregationSize {
+			buckets = buckets[:AggregationSize]
+		}
+		result[agg["name"]] = map[string]interface{}{"buckets": buckets}
+	}
+	return result
+}
+
+func aggregationKeys(p *Patent, field string) []string {
+	unique := make(map[string]struct{})
+	switch field {
+	case "current_assignee.party_name.raw":
+		for _, assignee := range p.Assignees {
+			unique[assignee] = struct{}{}
+		}
+	case "document_country":
+		unique[p.Country] = struct{}{}
+	case "legal_status":
+		unique[p.LegalStatus] = struct{}{}
+	case "classifications_cpc.section_top_class_sub_class":
+		for _, cpc := range p.CPC {
+			cpc = strings.ToUpper(strings.ReplaceAll(cpc, " ", ""))
+			if len(cpc) >= 4 {
+				unique[cpc[:4]] = struct{}{}
+			}
+		}
+	}
+	delete(unique, "")
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	return keys
+}
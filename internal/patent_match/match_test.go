@@ -0,0 +1,62 @@
+package patent_match
+
+import (
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"testing"
+	"time"
+)
+
+func TestMatchFilters(t *testing.T) {
+	or := model.OrOperator
+	not := model.NotOperator
+	p := &Patent{
+		PublicationNumber: "US10000001B2",
+		Country:           "US",
+		Title:             "Battery charging method",
+		Assignees:         []string{"Siemens AG"},
+		CPC:               []string{"H04L9/32"},
+		PublicationDate:   time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name   string
+		filter model.SingleParsedFilter
+		want   bool
+	}{
+		{"assignee substring", model.SingleParsedFilter{Criteria: []string{"siemens"}, SearchField: "patent.currentassignee"}, true},
+		{"owner falls back to assignees", model.SingleParsedFilter{Criteria: []string{"siemens"}, SearchField: "patent.currentowner"}, true},
+		{"and needs every criterion", model.SingleParsedFilter{Criteria: []string{"US", "EP"}, SearchField: "patent.documentcountry"}, false},
+		{"or needs one criterion", model.SingleParsedFilter{Criteria: []string{"US", "EP"}, SearchField: "patent.documentcountry", FilterOperator: &or}, true},
+		{"not excludes", model.SingleParsedFilter{Criteria: []string{"US"}, SearchField: "patent.documentcountry", FilterOperator: &not}, false},
+		{"cpc prefix", model.SingleParsedFilter{Criteria: []string{"H04L"}, SearchField: "patent.toplevelcpc"}, true},
+		{"date in range", model.SingleParsedFilter{Criteria: []string{"2020-01-01", model.OpenDateBound}, SearchField: "patent.publicationdate"}, true},
+		{"missing date never matches", model.SingleParsedFilter{Criteria: []string{model.OpenDateBound, model.OpenDateBound}, SearchField: "patent.applicationdate"}, false},
+		{"full text", model.SingleParsedFilter{Criteria: []string{"invention_title:(battery AND charging)"}, SearchField: "patent.fulltext"}, true},
+		{"unknown field", model.SingleParsedFilter{Criteria: []string{"x"}, SearchField: "patent.unknown"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchFilters(p, []model.SingleParsedFilter{tt.filter}); got != tt.want {
+				t.Errorf("MatchFilters = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateCapsBuckets(t *testing.T) {
+	patents := make([]*Patent, 0, AggregationSize+5)
+	for i := 0; i < AggregationSize+5; i++ {
+		patents = append(patents, &Patent{Assignees: []string{string(rune('A' + i))}, CPC: []string{"h04l 9/32"}})
+	}
+	result := Aggregate(patents, []map[string]string{
+		{"name": "assignees", "field": "current_assignee.party_name.raw"},
+		{"name": "cpc", "field": "classifications_cpc.section_top_class_sub_class"},
+	})
+	assignees := result["assignees"].(map[string]interface{})["buckets"].([]Bucket)
+	if len(assignees) != AggregationSize {
+		t.Errorf("got %d assignee buckets, want %d", len(assignees), AggregationSize)
+	}
+	cpc := result["cpc"].(map[string]interface{})["buckets"].([]Bucket)
+	if len(cpc) != 1 || cpc[0] != (Bucket{Key: "H04L", DocCount: AggregationSize + 5}) {
+		t.Errorf("cpc buckets = %v", cpc)
+	}
+}
@@ -0,0 +1,30 @@
+// Package query implements the boolean query language accepted in
+// Filters.TermsFilters ("terms_filter_simplified").
+//
+// A query is a sequence of terms combined with operators:
+//
+//	battery charging                 both terms (adjacent terms are ANDed)
+//	battery AND charging             the same, explicitly; && also works
+//	battery OR cell                  either term; || also works
+//	battery NOT lithium              NOT, - and ! negate the following clause
+//	(battery OR cell) AND charging   parentheses group clauses
+//	"wireless charging"              exact phrase
+//	"wireless charging"~5            words of the phrase within 5 positions of each other
+//	charg*                           prefix match
+//
+// A clause may be restricted to a field with a prefix:
+//
+//	ti:   invention title
+//	ab:   abstract
+//	cl:   claims
+//	de:   description
+//	cpc:  CPC classification symbol, e.g. cpc:H04L9/32 or cpc:H04L*
+//	as:   current assignee, e.g. as:"Robert Bosch"
+//
+// A prefix also applies to a parenthesised group: ti:(battery OR cell).
+// Clauses without a prefix search title, abstract, claims and description.
+//
+// Operators are case sensitive (and, or and not are ordinary words). Special
+// characters can be escaped with a backslash. Syntax errors are reported as
+// *SyntaxError with the byte offset of the offending token.
+package query
@@ -0,0 +1,115 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Document supplies the text a query is evaluated against. Text("") must
+// return the default full-text fields.
+type Document interface {
+	Text(field string) []string
+}
+
+// Match evaluates the query against a document locally, for providers that
+// have no search engine of their own. Terms match whole words, or word
+// prefixes for wildcard terms; terms that contain punctuation, such as CPC
+// symbols or company names, match as case-insensitive substrings.
+func (n *Node) Match(doc Document) bool {
+	switch n.Kind {
+	case KindAnd:
+		for _, child := range n.Children {
+			if !child.Match(doc) {
+				return false
+			}
+		}
+		return true
+	case KindOr:
+		for _, child := range n.Children {
+			if child.Match(doc) {
+				return true
+			}
+		}
+		return false
+	case KindNot:
+		return !n.Children[0].Match(doc)
+	case KindPhrase:
+		return matchPhrase(doc.Text(n.Field), words(n.Value), n.Slop)
+	}
+	return matchTerm(doc.Text(n.Field), strings.ToLower(n.Value), n.Prefix)
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func matchTerm(texts []string, term string, prefix bool) bool {
+	if len(words(term)) != 1 || words(term)[0] != term {
+		for _, text := range texts {
+			lower := strings.ToLower(text)
+			if prefix && strings.HasPrefix(lower, term) || strings.Contains(lower, term) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, text := range texts {
+		for _, word := range words(text) {
+			if word == term || prefix && strings.HasPrefix(word, term) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPhrase looks for the phrase words in order, or, with a slop, for all
+// of them within a window of len(phrase)+slop words in any order.
+func matchPhrase(texts []string, phrase []string, slop int) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for _, text := range texts {
+		tokens := words(text)
+		for start := range tokens {
+			if slop == 0 {
+				if start+len(phrase) > len(tokens) {
+					break
+				}
+				matched := true
+				for i, word := range phrase {
+					if tokens[start+i] != word {
+						matched = false
+						break
+					}
+				}
+				if matched {
+					return true
+				}
+				continue
+			}
+			end := start + len(phrase) + slop
+			if end > len(tokens) {
+				end = len(tokens)
+			}
+			window := make(map[string]int)
+			for _, token := range tokens[start:end] {
+				window[token]++
+			}
+			matched := true
+			for _, word := range phrase {
+				if window[word] == 0 {
+					matched = false
+					break
+				}
+				window[word]--
+			}
+			if matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type Kind int
+
+const (
+	KindTerm Kind = iota
+	KindPhrase
+	KindAnd
+	KindOr
+	KindNot
+)
+
+// Node is a query AST node. Field is set on leaves only; a field prefix on a
+// group is pushed down to the leaves inside it.
+type Node struct {
+	Kind     Kind
+	Field    string
+	Value    string
+	Prefix   bool
+	Slop     int
+	Pos      int
+	Children []*Node
+}
+
+type SyntaxError struct {
+	Pos     int    `json:"position"`
+	Message string `json:"message"`
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenPhrase
+	tokenField
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind   tokenKind
+	value  string
+	prefix bool
+	slop   int
+	pos    int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenPhrase:
+		return strconv.Quote(t.value)
+	case tokenField:
+		return t.value + ":"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	}
+	return "'" + t.value + "'"
+}
+
+func isSpecial(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()":~\`, r)
+}
+
+func lex(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(input)
+	offsets := make([]int, len(runes)+1)
+	offset := 0
+	for i, r := range runes {
+		offsets[i] = offset
+		offset += len(string(r))
+	}
+	offsets[len(runes)] = offset
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := offsets[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: pos})
+			i++
+		case r == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			tokens = append(tokens, token{kind: tokenAnd, value: "&&", pos: pos})
+			i += 2
+		case r == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			tokens = append(tokens, token{kind: tokenOr, value: "||", pos: pos})
+			i += 2
+		case (r == '-' || r == '!') && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot, value: string(r), pos: pos})
+			i++
+		case r == '"':
+			var builder strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				builder.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, &SyntaxError{Pos: pos, Message: "unterminated phrase"}
+			}
+			j++
+			phrase := token{kind: tokenPhrase, value: builder.String(), pos: pos}
+			if j < len(runes) && runes[j] == '~' {
+				k := j + 1
+				for k < len(runes) && unicode.IsDigit(runes[k]) {
+					k++
+				}
+				if k == j+1 {
+					return nil, &SyntaxError{Pos: offsets[j], Message: "expected a number after '~'"}
+				}
+				phrase.slop, _ = strconv.Atoi(string(runes[j+1 : k]))
+				j = k
+			}
+			if strings.TrimSpace(phrase.value) == "" {
+				return nil, &SyntaxError{Pos: pos, Message: "empty phrase"}
+			}
+			tokens = append(tokens, phrase)
+			i = j
+		case r == ':' || r == '~':
+			return nil, &SyntaxError{Pos: pos, Message: fmt.Sprintf("unexpected '%c'", r)}
+		default:
+			var builder strings.Builder
+			j := i
+			escaped, lastEscaped := false, false
+			for j < len(runes) {
+				c := runes[j]
+				if c == '\\' {
+					if j+1 >= len(runes) {
+						return nil, &SyntaxError{Pos: offsets[j], Message: "dangling escape character"}
+					}
+					builder.WriteRune(runes[j+1])
+					escaped, lastEscaped = true, true
+					j += 2
+					continue
+				}
+				if isSpecial(c) {
+					break
+				}
+				builder.WriteRune(c)
+				lastEscaped = false
+				j++
+			}
+			word := builder.String()
+			if j < len(runes) && runes[j] == ':' && !escaped {
+				tokens = append(tokens, token{kind: tokenField, value: word, pos: pos})
+				i = j + 1
+				continue
+			}
+			t := token{kind: tokenWord, value: word, pos: pos}
+			switch word {
+			case "AND":
+				t.kind = tokenAnd
+			case "OR":
+				t.kind = tokenOr
+			case "NOT":
+				t.kind = tokenNot
+			default:
+				if strings.HasSuffix(word, "*") && !lastEscaped {
+					t.value = strings.TrimSuffix(word, "*")
+					t.prefix = true
+					if t.value == "" {
+						return nil, &SyntaxError{Pos: pos, Message: "wildcard needs at least one character"}
+					}
+				}
+			}
+			tokens = append(tokens, t)
+			i = j
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(input)})
+	return tokens, nil
+}
+
+// maxDepth caps how deeply groups and negations nest, so that a hostile query
+// cannot exhaust the stack of the parser or of the code walking its AST.
+const maxDepth = 100
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// Parse parses a query into its AST.
+func Parse(input string) (*Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return nil, &SyntaxError{Pos: 0, Message: "empty query"}
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: next.pos, Message: fmt.Sprintf("unexpected %s", next)}
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// descend enters a nested group or negation starting at pos. Every successful
+// call must be paired with a decrement of p.depth.
+func (p *parser) descend(pos int) error {
+	if p.depth == maxDepth {
+		return &SyntaxError{Pos: pos, Message: fmt.Sprintf("query nested deeper than %d levels", maxDepth)}
+	}
+	p.depth++
+	return nil
+}
+
+func (p *parser) parseOr(field string) (*Node, error) {
+	first, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	children := []*Node{first}
+	for p.peek().kind == tokenOr {
+		p.next()
+		child, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &Node{Kind: KindOr, Pos: first.Pos, Children: children}, nil
+}
+
+func (p *parser) parseAnd(field string) (*Node, error) {
+	first, err := p.parseUnary(field)
+	if err != nil {
+		return nil, err
+	}
+	children := []*Node{first}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenWord, tokenPhrase, tokenField, tokenNot, tokenLParen:
+		default:
+			if len(children) == 1 {
+				return first, nil
+			}
+			return &Node{Kind: KindAnd, Pos: first.Pos, Children: children}, nil
+		}
+		child, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+}
+
+func (p *parser) parseUnary(field string) (*Node, error) {
+	if t := p.peek(); t.kind == tokenNot {
+		p.next()
+		if err := p.descend(t.pos); err != nil {
+			return nil, err
+		}
+		child, err := p.parseUnary(field)
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Kind: KindNot, Pos: t.pos, Children: []*Node{child}}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+func (p *parser) parsePrimary(field string) (*Node, error) {
+	t := p.next()
+	pos := t.pos
+	if t.kind == tokenField {
+		field = t.value
+		t = p.next()
+		switch t.kind {
+		case tokenWord, tokenPhrase, tokenLParen:
+		default:
+			return nil, &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("expected a term after %s:", field)}
+		}
+	}
+	// a leaf starts at its field prefix, so errors about the field point at it
+	switch t.kind {
+	case tokenWord:
+		return &Node{Kind: KindTerm, Field: field, Value: t.value, Prefix: t.prefix, Pos: pos}, nil
+	case tokenPhrase:
+		return &Node{Kind: KindPhrase, Field: field, Value: t.value, Slop: t.slop, Pos: pos}, nil
+	case tokenLParen:
+		if err := p.descend(t.pos); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr(field)
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &SyntaxError{Pos: closing.pos, Message: fmt.Sprintf("expected ')' to close '(' at position %d, got %s", t.pos, closing)}
+		}
+		return node, nil
+	case tokenRParen:
+		return nil, &SyntaxError{Pos: t.pos, Message: "unexpected ')'"}
+	case tokenEOF:
+		return nil, &SyntaxError{Pos: t.pos, Message: "unexpected end of query"}
+	}
+	return nil, &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("expected a term, got %s", t)}
+}
+
+// Walk calls fn for n and every node below it, stopping early if fn returns false.
+func (n *Node) Walk(fn func(*Node) bool) bool {
+	if !fn(n) {
+		return false
+	}
+	for _, child := range n.Children {
+		if !child.Walk(fn) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package query
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// render prints a node as an s-expression, e.g. (OR (AND a b) ti:c*).
+func render(n *Node) string {
+	switch n.Kind {
+	case KindAnd, KindOr, KindNot:
+		name := map[Kind]string{KindAnd: "AND", KindOr: "OR", KindNot: "NOT"}[n.Kind]
+		parts := []string{name}
+		for _, child := range n.Children {
+			parts = append(parts, render(child))
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	}
+	value := n.Value
+	if n.Kind == KindPhrase {
+		value = strconv.Quote(value)
+		if n.Slop > 0 {
+			value += "~" + strconv.Itoa(n.Slop)
+		}
+	} else if n.Prefix {
+		value += "*"
+	}
+	if n.Field != "" {
+		return n.Field + ":" + value
+	}
+	return value
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"battery", "battery"},
+		{"battery charging", "(AND battery charging)"},
+		{"battery AND charging", "(AND battery charging)"},
+		{"battery && charging", "(AND battery charging)"},
+		{"battery OR cell", "(OR battery cell)"},
+		{"battery || cell", "(OR battery cell)"},
+		// AND binds tighter than OR
+		{"a b OR c", "(OR (AND a b) c)"},
+		{"a OR b c", "(OR a (AND b c))"},
+		{"a OR b AND c OR d", "(OR a (AND b c) d)"},
+		{"(a OR b) c", "(AND (OR a b) c)"},
+		{"a (b OR (c d))", "(AND a (OR b (AND c d)))"},
+		// NOT binds tighter than AND
+		{"NOT a b", "(AND (NOT a) b)"},
+		{"battery NOT lithium", "(AND battery (NOT lithium))"},
+		{"-a !b", "(AND (NOT a) (NOT b))"},
+		{"NOT (a OR b)", "(NOT (OR a b))"},
+		{"a - b", "(AND a - b)"},
+		{"and or not", "(AND and or not)"},
+		{"charg*", "charg*"},
+		{`"wireless charging"`, `"wireless charging"`},
+		{`"wireless charging"~5`, `"wireless charging"~5`},
+		{`"say \"hi\""`, `"say \"hi\""`},
+		{`"battery" cell`, `(AND "battery" cell)`},
+		{`as:"Robert Bosch"`, `as:"Robert Bosch"`},
+		{"ti:battery cell", "(AND ti:battery cell)"},
+		{"ti:(battery OR cell*)", "(OR ti:battery ti:cell*)"},
+		{"ti: battery", "ti:battery"},
+		{"cpc:H04L9/32", "cpc:H04L9/32"},
+		{`a\:b`, "a:b"},
+		{`c\+\+`, "c++"},
+		{`abc\*`, "abc*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			node, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := render(node); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEscapedWildcardIsNotPrefix(t *testing.T) {
+	node, err := Parse(`abc\*`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if node.Prefix || node.Value != "abc*" {
+		t.Errorf("got value %q prefix %v, want literal abc*", node.Value, node.Prefix)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		pos     int
+		message string
+	}{
+		{"", 0, "empty query"},
+		{"   ", 0, "empty query"},
+		{"(a OR b", 7, "expected ')' to close '(' at position 0"},
+		{"a (b (c)", 8, "expected ')' to close '(' at position 2"},
+		{"a OR b)", 6, "unexpected ')'"},
+		{"a ) b", 2, "unexpected ')'"},
+		{")", 0, "unexpected ')'"},
+		{"a OR", 4, "unexpected end of query"},
+		{"a AND OR b", 6, "expected a term, got 'OR'"},
+		{"NOT", 3, "unexpected end of query"},
+		{`"abc`, 0, "unterminated phrase"},
+		{`a "abc`, 2, "unterminated phrase"},
+		{`"abc"~`, 5, "expected a number after '~'"},
+		{`""`, 0, "empty phrase"},
+		{"ti:", 3, "expected a term after ti:"},
+		{"a ~", 2, "unexpected '~'"},
+		{"a :b", 2, "unexpected ':'"},
+		{"*", 0, "wildcard needs at least one character"},
+		{`a \`, 2, "dangling escape character"},
+		// positions are byte offsets
+		{"é )", 3, "unexpected ')'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("got %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Pos != tt.pos || !strings.HasPrefix(syntaxErr.Message, tt.message) {
+				t.Errorf("got %q at %d, want %q at %d", syntaxErr.Message, syntaxErr.Pos, tt.message, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	node, err := Parse(`a ti:b "c d" (e OR -f)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := make(map[string]int)
+	node.Walk(func(n *Node) bool {
+		if n.Kind == KindTerm || n.Kind == KindPhrase || n.Kind == KindNot {
+			got[render(n)] = n.Pos
+		}
+		return true
+	})
+	want := map[string]int{"a": 0, "ti:b": 2, `"c d"`: 7, "e": 14, "(NOT f)": 19, "f": 20}
+	for leaf, pos := range want {
+		if got[leaf] != pos {
+			t.Errorf("%s at %d, want %d", leaf, got[leaf], pos)
+		}
+	}
+}
+
+func TestParseNestingLimit(t *testing.T) {
+	for _, open := range []string{"(", "-"} {
+		closing := ""
+		if open == "(" {
+			closing = ")"
+		}
+		deepest := strings.Repeat(open, maxDepth) + "a" + strings.Repeat(closing, maxDepth)
+		if _, err := Parse(deepest); err != nil {
+			t.Errorf("%d levels of %q: unexpected error: %s", maxDepth, open, err)
+		}
+
+		_, err := Parse(strings.Repeat(open, maxDepth+1) + "a" + strings.Repeat(closing, maxDepth+1))
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("%d levels of %q: got %v, want a *SyntaxError", maxDepth+1, open, err)
+		}
+		if syntaxErr.Pos != maxDepth || !strings.HasPrefix(syntaxErr.Message, "query nested deeper than") {
+			t.Errorf("%d levels of %q: got %q at %d", maxDepth+1, open, syntaxErr.Message, syntaxErr.Pos)
+		}
+	}
+}
@@ -1,9 +1,55 @@
 package utils
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	kindCodeSuffix = regexp.MustCompile(`^[A-Z][0-9]?$`)
+	kindCodeAtEnd  = regexp.MustCompile(`[A-Z][0-9]?$`)
+)
 
 func RemoveHTMLTags(text string) string {
 	re := regexp.MustCompile(`<.*?>`)
 	cleanText := re.ReplaceAllString(text, " ")
 	return cleanText
 }
+
+// NormalizePublicationNumber upper-cases a publication number and strips the
+// separators people paste from emails and spreadsheets ("US 10,000,000 B2").
+func NormalizePublicationNumber(number string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToUpper(strings.TrimSpace(number)) {
+		switch r {
+		case ' ', '-', ',', '.', '/', '\t':
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// MatchPublicationNumber reports whether a normalized publication number
+// returned by the API corresponds to a requested one. The request may omit
+// the kind code, so "US10000000" matches "US10000000B2".
+func MatchPublicationNumber(requested, returned string) bool {
+	if requested == returned {
+		return true
+	}
+	if !strings.HasPrefix(returned, requested) {
+		return false
+	}
+	return kindCodeSuffix.MatchString(returned[len(requested):])
+}
+
+// StripKindCode drops the kind code from a normalized publication number, so
+// "US10000000B2" becomes "US10000000".
+func StripKindCode(number string) string {
+	if match := kindCodeAtEnd.FindStringIndex(number); match != nil && match[0] > 0 {
+		if previous := number[match[0]-1]; previous >= '0' && previous <= '9' {
+			return number[:match[0]]
+		}
+	}
+	return number
+}
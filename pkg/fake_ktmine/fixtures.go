@@ -0,0 +1,143 @@
+package fake_ktmine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const DefaultPatentCount = 250
+
+var (
+	fixtureAssignees = []string{"Siemens AG", "Robert Bosch GmbH", "ABB Ltd", "Nokia Oyj", "Philips NV"}
+	fixtureCountries = []string{"US", "EP", "CN", "JP", "WO"}
+	fixtureStatuses  = []string{"Active", "Pending", "Expired"}
+	fixtureCPC       = []string{"H04L9/32", "H04W4/70", "G06F21/62", "B60L53/10", "A61B5/00"}
+	fixtureTopics    = []string{"battery", "encryption", "wireless", "sensor", "charging"}
+)
+
+// GeneratePatents builds a deterministic fixture set in the item shape
+// returned by KTMine's /search, including the full-patent fields.
+func GeneratePatents(count int) []map[string]interface{} {
+	base := time.Date(2005, 1, 3, 0, 0, 0, 0, time.UTC)
+	patents := make([]map[string]interface{}, 0, count)
+	for i := 0; i < count; i++ {
+		country := fixtureCountries[i%len(fixtureCountries)]
+		number := fmt.Sprintf("%s%08d%s", country, 10000000+i, "B2")
+		topic := fixtureTopics[i%len(fixtureTopics)]
+		assignee := fixtureAssignees[i%len(fixtureAssignees)]
+		filed := base.AddDate(0, i%180, i%28)
+		priority := filed.AddDate(0, -6, 0)
+		published := filed.AddDate(2, 0, 0)
+		expiry := filed.AddDate(20, 0, 0)
+		family := i - i%3
+
+		patents = append(patents, map[string]interface{}{
+			"documentNumber": number,
+			"legalStatus":    fixtureStatuses[i%len(fixtureStatuses)],
+			"inventionTitle": fmt.Sprintf("Method for %s management %d", topic, i),
+			"publicationReference": map[string]interface{}{
+				"country": country,
+			},
+			"publicationReferences": []interface{}{
+				map[string]interface{}{"documentDate": published.Format("2006-01-02")},
+			},
+			"applicationReferences": []interface{}{
+				map[string]interface{}{
+					"dataFormat":     "original",
+					"documentNumber": fmt.Sprintf("%d/%06d", filed.Year(), i),
+					"documentDate":   filed.Format("2006-01-02T15:04:05"),
+				},
+			},
+			"minPriorityDate":         priority.Format("2006-01-02T15:04:05"),
+			"projectedExpirationDate": expiry.Format("2006-01-02T15:04:05"),
+			"priorityClaims": []interface{}{
+				map[string]interface{}{"country": country, "documentDate": priority.Format("2006-01-02T15:04:05")},
+			},
+			"currentAssignees": []interface{}{
+				map[string]interface{}{"partyName": assignee, "partyNameClean": assignee},
+			},
+			"inventors": []interface{}{
+				map[string]interface{}{"partyName": fmt.Sprintf("Inventor %d", i%17)},
+				map[string]interface{}{"partyName": fmt.Sprintf("Inventor %d", (i+5)%17)},
+			},
+			"cpcClassifications": []interface{}{
+				map[string]interface{}{"symbol": fixtureCPC[i%len(fixtureCPC)]},
+				map[string]interface{}{"symbol": fixtureCPC[(i+2)%len(fixtureCPC)]},
+			},
+			"inpadocFamilyMembers": []interface{}{
+				map[string]interface{}{"country": "US", "documentNumber": fmt.Sprintf("%08d", 10000000+family), "kind": "B2"},
+				map[string]interface{}{"country": "EP", "documentNumber": fmt.Sprintf("%08d", 10000000+family+1), "kind": "B2"},
+			},
+			"backwardCitations": fixtureCitations(i-7, i-3),
+			"forwardCitations":  fixtureCitations(i+3, i+7),
+			"nonPatentCitations": []interface{}{
+				map[string]interface{}{"text": fmt.Sprintf("Smith et al., A survey of %s, 2004.", topic)},
+			},
+			"abstractParagraphs": []interface{}{
+				map[string]interface{}{"lang": "en", "plainText": fmt.Sprintf("A %s system operated by %s.", topic, assignee)},
+			},
+			"descriptions": []interface{}{
+				map[string]interface{}{"lang": "en", "category": "technical-field", "plainText": fmt.Sprintf("The invention relates to %s.", topic)},
+				map[string]interface{}{"lang": "en", "category": "brief-description-of-drawings", "plainText": "FIG. 1 shows the system."},
+			},
+			"claimsXml": []interface{}{
+				map[string]interface{}{"claimId": "CLM-00001", "isDependent": false, "xmlText": fmt.Sprintf("<claim-text>1. A %s device.</claim-text>", topic)},
+				map[string]interface{}{"claimId": "CLM-00002", "isDependent": true, "claimReferences": []interface{}{"CLM-00001"}, "xmlText": "<claim-text>2. The device of claim 1.</claim-text>"},
+				map[string]interface{}{"claimId": "CLM-00003", "isDependent": false, "xmlText": fmt.Sprintf("<claim-text>3. A method of %s.</claim-text>", topic)},
+			},
+		})
+	}
+	return patents
+}
+
+// LoadPatents reads fixtures from a JSON array or a JSONL file of KTMine items.
+func LoadPatents(path string) ([]map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimSpace(content)
+	patents := make([]map[string]interface{}, 0)
+	if bytes.HasPrefix(content, []byte("[")) {
+		if err := json.Unmarshal(content, &patents); err != nil {
+			return nil, err
+		}
+		return patents, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var patent map[string]interface{}
+		if err := json.Unmarshal(line, &patent); err != nil {
+			return nil, err
+		}
+		patents = append(patents, patent)
+	}
+	return patents, scanner.Err()
+}
+
+// fixtureCitations cites the generated patents with the given indexes that
+// exist, so generated fixtures form a connected citation graph.
+func fixtureCitations(indexes ...int) []interface{} {
+	citations := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		if i < 0 {
+			continue
+		}
+		citations = append(citations, map[string]interface{}{
+			"country":        fixtureCountries[i%len(fixtureCountries)],
+			"documentNumber": fmt.Sprintf("%08d", 10000000+i),
+			"kind":           "B2",
+			"category":       "A",
+		})
+	}
+	return citations
+}
@@ -0,0 +1,98 @@
+package fake_ktmine
+
+import (
+	"github.com/vpnvsk/amunetip-patent-upload/internal/patent_match"
+	"time"
+)
+
+// matchDocument describes a KTMine item for the shared filter matcher. Current
+// owners are not part of the fixtures, so current_owner filters match the
+// assignees.
+func matchDocument(patent map[string]interface{}) *patent_match.Patent {
+	number, _ := patent["documentNumber"].(string)
+	status, _ := patent["legalStatus"].(string)
+	title, _ := patent["inventionTitle"].(string)
+	return &patent_match.Patent{
+		PublicationNumber:    number,
+		Country:              country(patent),
+		LegalStatus:          status,
+		Title:                title,
+		Abstract:             paragraphs(patent, "abstractParagraphs"),
+		Claims:               paragraphs(patent, "claimsXml"),
+		Descriptions:         paragraphs(patent, "descriptions"),
+		Assignees:            partyNames(patent, "currentAssignees"),
+		Inventors:            partyNames(patent, "inventors"),
+		CPC:                  cpcSymbols(patent),
+		ApplicationDate:      firstDate(patent, "applicationReferences"),
+		PublicationDate:      firstDate(patent, "publicationReferences"),
+		EarliestPriorityDate: parseDate(patent["minPriorityDate"]),
+		EstimatedExpiryDate:  parseDate(patent["projectedExpirationDate"]),
+	}
+}
+
+func parseDate(value interface{}) time.Time {
+	date, _ := value.(string)
+	if len(date) < 10 {
+		return time.Time{}
+	}
+	parsed, err := time.Parse("2006-01-02", date[:10])
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+func partyNames(patent map[string]interface{}, key string) []string {
+	parties, _ := patent[key].([]interface{})
+	names := make([]string, 0, len(parties))
+	for _, party := range parties {
+		parsed, _ := party.(map[string]interface{})
+		if name, ok := parsed["partyName"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func country(patent map[string]interface{}) string {
+	reference, _ := patent["publicationReference"].(map[string]interface{})
+	value, _ := reference["country"].(string)
+	return value
+}
+
+func cpcSymbols(patent map[string]interface{}) []string {
+	classifications, _ := patent["cpcClassifications"].([]interface{})
+	symbols := make([]string, 0, len(classifications))
+	for _, classification := range classifications {
+		parsed, _ := classification.(map[string]interface{})
+		if symbol, ok := parsed["symbol"].(string); ok {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+func firstDate(patent map[string]interface{}, key string) time.Time {
+	references, _ := patent[key].([]interface{})
+	for _, reference := range references {
+		parsed, _ := reference.(map[string]interface{})
+		if date := parseDate(parsed["documentDate"]); !date.IsZero() {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+func paragraphs(patent map[string]interface{}, key string) []string {
+	items, _ := patent[key].([]interface{})
+	texts := make([]string, 0, len(items))
+	for _, item := range items {
+		parsed, _ := item.(map[string]interface{})
+		for _, field := range []string{"plainText", "xmlText"} {
+			if text, ok := parsed[field].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return texts
+}
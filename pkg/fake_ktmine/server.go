@@ -0,0 +1,162 @@
+package fake_ktmine
+
+import (
+	"encoding/json"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/patent_match"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Options control the fixtures and the faults injected by the fake server.
+type Options struct {
+	// Patents is the fixture set in KTMine's item shape. When empty,
+	// GeneratePatents(DefaultPatentCount) is used.
+	Patents []map[string]interface{}
+	// APIKey, when set, makes requests with a different key fail with 401.
+	APIKey string
+	// Latency is added to every request.
+	Latency time.Duration
+	// ThrottleRate is the probability of answering 429 with a Retry-After header.
+	ThrottleRate float64
+	// ErrorRate is the probability of answering 500.
+	ErrorRate float64
+	// RetryAfter is sent with throttled responses, in seconds.
+	RetryAfter int
+	// Seed makes the injected faults reproducible.
+	Seed int64
+}
+
+type Server struct {
+	opts    Options
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	patents []map[string]interface{}
+	// documents describes patents[i] for the shared filter matcher.
+	documents []*patent_match.Patent
+}
+
+func NewServer(opts Options) *Server {
+	if len(opts.Patents) == 0 {
+		opts.Patents = GeneratePatents(DefaultPatentCount)
+	}
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = 1
+	}
+	documents := make([]*patent_match.Patent, 0, len(opts.Patents))
+	for _, patent := range opts.Patents {
+		documents = append(documents, matchDocument(patent))
+	}
+	return &Server{
+		opts:      opts,
+		rnd:       rand.New(rand.NewSource(opts.Seed)),
+		patents:   opts.Patents,
+		documents: documents,
+	}
+}
+
+// NewTestServer starts the fake on a local port; point KTMINE_URL at its URL.
+func NewTestServer(opts Options) *httptest.Server {
+	return httptest.NewServer(NewServer(opts).Handler())
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", s.search)
+	return mux
+}
+
+type searchRequest struct {
+	Filters      []model.SingleParsedFilter `json:"filters"`
+	ReturnFields []string                   `json:"returnFields"`
+	Key          string                     `json:"key"`
+	Start        int                        `json:"start"`
+	Count        int                        `json:"count"`
+	AdvancedAggs []map[string]string        `json:"advancedAggs"`
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	throttle, fail := s.roll()
+	if throttle {
+		w.Header().Set("Retry-After", strconv.Itoa(s.opts.RetryAfter))
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+	if fail {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var req searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.opts.APIKey != "" && req.Key != s.opts.APIKey {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	matched := make([]map[string]interface{}, 0)
+	matchedDocuments := make([]*patent_match.Patent, 0)
+	for i, patent := range s.patents {
+		if patent_match.MatchFilters(s.documents[i], req.Filters) {
+			matched = append(matched, patent)
+			matchedDocuments = append(matchedDocuments, s.documents[i])
+		}
+	}
+
+	items := make([]map[string]interface{}, 0)
+	if req.Start < len(matched) && req.Count > 0 {
+		end := req.Start + req.Count
+		if end > len(matched) {
+			end = len(matched)
+		}
+		items = matched[req.Start:end]
+	}
+	response := map[string]interface{}{
+		"response": map[string]interface{}{
+			"totalFound": len(matched),
+			"start":      req.Start,
+			"count":      len(items),
+			"items":      items,
+		},
+	}
+	if len(req.AdvancedAggs) > 0 {
+		response["aggregations"] = patent_match.Aggregate(matchedDocuments, req.AdvancedAggs)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) roll() (throttle bool, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.ThrottleRate > 0 && s.rnd.Float64() < s.opts.ThrottleRate {
+		return true, false
+	}
+	if s.opts.ErrorRate > 0 && s.rnd.Float64() < s.opts.ErrorRate {
+		return false, true
+	}
+	return false, false
+}
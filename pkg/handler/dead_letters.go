@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// listDeadLetters shows the upload requests in the dead-letter queue with the
+// reason they failed, up to limit from the head of the queue.
+func (h *Handler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var input model.DeadLetterListInput
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		input.Limit = limit
+	}
+	if err := input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input.Sanitize()
+
+	deadLetters, err := h.service.ListDeadLetters(r.Context(), input)
+	if err != nil {
+		h.deadLetterError(w, "handler.listDeadLetters", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deadLetters); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// replayDeadLetters sends dead-lettered upload requests back to the upload
+// queue, either those named in message_ids or the first limit of them.
+func (h *Handler) replayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var input model.DeadLetterReplayInput
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	// an empty body replays from the head of the queue
+	if err := decoder.Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	input.Sanitize()
+
+	output, err := h.service.ReplayDeadLetters(r.Context(), input)
+	if err != nil {
+		h.deadLetterError(w, "handler.replayDeadLetters", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(output); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) deadLetterError(w http.ResponseWriter, op string, err error) {
+	if errors.Is(err, model.ErrBrokerUnavailable) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	h.log.Error("dead-letter request failed", slog.String("op", op), slog.String("error", err.Error()))
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/query"
 	"net/http"
 )
 
@@ -26,10 +27,7 @@ func (h *Handler) filterPatents(w http.ResponseWriter, r *http.Request) {
 
 	patents, err := h.service.FilterPatents(ctx, req)
 	if err != nil {
-		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			return
-		}
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeFilterError(w, err)
 		return
 	}
 
@@ -39,3 +37,63 @@ func (h *Handler) filterPatents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// explainFilters answers what an upload with the given filters would do,
+// without fetching or saving any patents.
+func (h *Handler) explainFilters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req model.Filters
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	explanation, err := h.service.ExplainFilters(r.Context(), req)
+	if err != nil {
+		writeFilterError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(explanation); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func writeFilterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	var syntaxErr *query.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		writeSyntaxError(w, syntaxErr)
+		return
+	}
+	if errors.Is(err, model.ErrInvalidFilters) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, model.ErrUpstreamUnavailable) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+// writeSyntaxError reports where a terms filter query failed to parse, so
+// clients can point at the offending part of the query.
+func writeSyntaxError(w http.ResponseWriter, err *query.SyntaxError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    err.Message,
+		"position": err.Pos,
+	})
+}
@@ -24,7 +24,16 @@ func NewHandler(log *slog.Logger, service *service.Service) *Handler {
 func (h *Handler) InitRoutes() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.Handle("/upload/filter", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.filterPatents)))
+	mux.Handle("/upload/filter/explain", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.explainFilters)))
 	mux.Handle("/upload", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.UploadPatents)))
+	mux.Handle("/upload/jobs", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.listUploadJobs)))
+	mux.Handle("/upload/jobs/{transaction_id}", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.getUploadJob)))
+	mux.Handle("/patents", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.listPatents)))
+	mux.Handle("/patents/{publication_number}/citations", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.citationNeighbourhood)))
+	mux.Handle("/status", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.status)))
+	mux.Handle("/ready", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.ready)))
+	mux.Handle("/admin/dead-letters", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.listDeadLetters)))
+	mux.Handle("/admin/dead-letters/replay", logger.LoggingMiddleware(h.log, http.HandlerFunc(h.replayDeadLetters)))
 	return mux
 }
 
@@ -32,4 +41,8 @@ func (h *Handler) HandlePatentUpload(ctx context.Context) {
 	h.service.BrokerClient.ListenPatentUpload(ctx, h.service.UploadPatentHandler)
 }
 
+func (h *Handler) RelayOutbox(ctx context.Context) {
+	h.service.RunOutboxRelay(ctx)
+}
+
 func (h *Handler) Upload(c *gin.Context) {}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) getUploadJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	transactionId, err := uuid.Parse(r.PathValue("transaction_id"))
+	if err != nil {
+		http.Error(w, "invalid transaction_id", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.service.GetUploadJob(r.Context(), transactionId)
+	if err != nil {
+		if errors.Is(err, model.ErrJobNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Error("failed to get upload job", slog.String("op", "handler.getUploadJob"), slog.String("error", err.Error()))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// listUploadJobs lists upload jobs, newest first, optionally filtered by the
+// bundle_id and state query parameters and paged with limit and offset.
+func (h *Handler) listUploadJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	var input model.UploadJobListInput
+	if value := query.Get("bundle_id"); value != "" {
+		bundleId, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "invalid bundle_id", http.StatusBadRequest)
+			return
+		}
+		input.BundleId = &bundleId
+	}
+	if value := query.Get("state"); value != "" {
+		state := model.UploadJobState(value)
+		input.State = &state
+	}
+	for name, target := range map[string]*int{"limit": &input.Limit, "offset": &input.Offset} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+	if err := input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input.Sanitize()
+
+	jobs, err := h.service.ListUploadJobs(r.Context(), input)
+	if err != nil {
+		h.log.Error("failed to list upload jobs", slog.String("op", "handler.listUploadJobs"), slog.String("error", err.Error()))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(jobs); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// listPatents lists stored patents by publication number, optionally filtered
+// by bundle_id and by cpc hierarchy patterns such as H04L* (repeated or comma
+// separated, any may match) and paged with limit and offset.
+func (h *Handler) listPatents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	var input model.PatentListInput
+	if value := query.Get("bundle_id"); value != "" {
+		bundleId, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "invalid bundle_id", http.StatusBadRequest)
+			return
+		}
+		input.BundleId = &bundleId
+	}
+	for _, value := range query["cpc"] {
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				input.CPC = append(input.CPC, pattern)
+			}
+		}
+	}
+	for name, target := range map[string]*int{"limit": &input.Limit, "offset": &input.Offset} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+	if err := input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input.Sanitize()
+
+	patents, err := h.service.ListPatents(r.Context(), input)
+	if err != nil {
+		h.log.Error("failed to list patents", slog.String("op", "handler.listPatents"), slog.String("error", err.Error()))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(patents); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// citationNeighbourhood returns the citation graph around a patent, reached
+// through citations in either direction, to the given depth (1 to 3).
+func (h *Handler) citationNeighbourhood(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	input := model.CitationNeighbourhoodInput{PublicationNumber: r.PathValue("publication_number")}
+	for name, target := range map[string]*int{"depth": &input.Depth, "max_nodes": &input.MaxNodes} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+	if err := input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input.Sanitize()
+
+	neighbourhood, err := h.service.CitationNeighbourhood(r.Context(), input)
+	if err != nil {
+		h.log.Error("failed to load citation neighbourhood", slog.String("op", "handler.citationNeighbourhood"), slog.String("error", err.Error()))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(neighbourhood); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
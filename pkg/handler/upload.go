@@ -1,22 +1,51 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
 	"net/http"
 )
 
 func (h *Handler) UploadPatents(w http.ResponseWriter, r *http.Request) {
-	//var input model.UploadInput
-	//if err := c.ShouldBindJSON(&input); err != nil {
-	//	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-	//	return
-	//}
-	//err := h.service.APIClientInterface.GetData(input)
-	//fmt.Println("after req")
-	//if err != nil {
-	//	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process data"})
-	//	return
-	//}
-	//fmt.Println("after all")
-	//
-	//c.JSON(http.StatusOK, gin.H{"message": "Data processed successfully"})
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+
+	var input model.UploadInput
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := input.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	input.Sanitize()
+
+	report, err := h.service.UploadPatents(ctx, input)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return
+		}
+		if errors.Is(err, model.ErrUpstreamUnavailable) {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		h.log.Error("upload patents failed", slog.String("error", err.Error()))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
 }
@@ -0,0 +1,139 @@
+package db_repository
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The size of the generated batches can be set on the go test command line.
+var (
+	benchPatents         = flag.Int("bench.patents", 1000, "patents saved per iteration of BenchmarkSavePatents")
+	benchClaims          = flag.Int("bench.claims", 15, "claims per patent in BenchmarkSavePatents")
+	benchDescriptionSize = flag.Int("bench.description-size", 20000, "description length in bytes in BenchmarkSavePatents")
+)
+
+// BenchmarkSavePatents compares the INSERT and COPY write paths of
+// SavePatents. Every iteration saves freshly generated patents, so only the
+// insert branch of the upsert is measured. Run it against a scratch database:
+//
+//	DB_HOST=localhost DB_PORT=5432 DB_USERNAME=postgres DB_PASSWORD=postgres \
+//	DB_NAME=patents_bench SSL_MODE=disable \
+//	go test ./pkg/repository/db_repository -run '^$' -bench SavePatents -bench.patents 2000
+func BenchmarkSavePatents(b *testing.B) {
+	db := testDB(b)
+	for _, mode := range []string{config.DBWriteInsert, config.DBWriteCopy} {
+		b.Run(mode, func(b *testing.B) {
+			repo := NewDBRepository(db, testLog, &config.Config{DBWriteMode: mode})
+			transactions := make([]uuid.UUID, 0, b.N)
+			b.Cleanup(func() {
+				if err := cleanUpTransactions(db, transactions); err != nil {
+					b.Errorf("failed to clean up: %s", err)
+				}
+			})
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				rnd := rand.New(rand.NewSource(int64(i)))
+				prefix := fmt.Sprintf("BM%s%d", strings.ToUpper(mode[:1]), time.Now().UnixNano())
+				patents := benchmarkPatents(rnd, prefix, *benchPatents, *benchClaims, *benchDescriptionSize)
+				transactionId := uuid.New()
+				transactions = append(transactions, transactionId)
+				b.StartTimer()
+
+				if _, err := repo.SavePatents(context.Background(), patents, transactionId, uuid.New()); err != nil {
+					b.Fatalf("save failed: %s", err)
+				}
+			}
+			b.ReportMetric(float64(b.N**benchPatents)/b.Elapsed().Seconds(), "patents/s")
+		})
+	}
+}
+
+// benchmarkPatents generates full patents whose content depends only on rnd
+// and the sizes; prefix keeps the publication numbers unique.
+func benchmarkPatents(rnd *rand.Rand, prefix string, count, claims, descriptionSize int) []model.FilteredFullPatent {
+	patents := make([]model.FilteredFullPatent, 0, count)
+	for i := 0; i < count; i++ {
+		priority := time.Date(1995+rnd.Intn(28), time.Month(1+rnd.Intn(12)), 1+rnd.Intn(28), 0, 0, 0, 0, time.UTC)
+		application := priority.AddDate(0, rnd.Intn(12), 0)
+		expiry := priority.AddDate(20, 0, 0)
+		status := []string{"Active", "Pending", "Expired"}[rnd.Intn(3)]
+		patent := model.FilteredFullPatent{
+			ID: uuid.New(),
+			Patent: model.FilteredPatent{
+				Title:                    words(rnd, 8),
+				PublicationNumber:        fmt.Sprintf("%s%07dB2", prefix, i),
+				EarliestPriorityDate:     &priority,
+				EstimatedExpiryDate:      &expiry,
+				ApplicationDate:          &application,
+				SimpleLegalStatus:        &status,
+				InventorsNames:           []string{"Inventor " + words(rnd, 1), "Inventor " + words(rnd, 1)},
+				Assignee:                 []string{"Assignee " + words(rnd, 1)},
+				SimpleFamilyJurisdiction: []string{"US", "EP", "CN"}[:1+rnd.Intn(3)],
+			},
+			Abstract:    words(rnd, 150),
+			Description: text(rnd, descriptionSize),
+		}
+		for number := 1; number <= claims; number++ {
+			claim := model.Claim{ClaimNumber: number, IndependentClaim: words(rnd, 60)}
+			if number > 1 {
+				claim.DependantClaims = []string{fmt.Sprintf("claim %d", 1+rnd.Intn(number-1))}
+			}
+			patent.Claims = append(patent.Claims, claim)
+		}
+		patent.Details = &model.ParsedPatent{
+			Id: patent.ID,
+			CPCClassifications: []model.CPCClassification{
+				model.NewCPCClassification("H04L 9/32", true),
+				model.NewCPCClassification("G06F 21/00", false),
+				model.NewCPCClassification("H01M 10/44", false),
+			}[:1+rnd.Intn(3)],
+			Authority:         "US",
+			ApplicationNumber: fmt.Sprintf("%d/%06d", application.Year(), i),
+			IssueDate:         application.AddDate(2, 0, 0),
+			PublicationDate:   application.AddDate(2, 0, 0),
+			FileURL:           "https://api.ktmine.com/api/v2/patents/pdf/" + patent.Patent.PublicationNumber,
+		}
+		patent.Details.SetClaimCounts(patent.Claims)
+		citing := fmt.Sprintf("%s%07d", prefix, i)
+		for j := 0; j < 1+rnd.Intn(5); j++ {
+			patent.Details.Citations.Backward = append(patent.Details.Citations.Backward, model.Citation{
+				CitingNumber: citing,
+				CitedNumber:  fmt.Sprintf("%s%07d", prefix, rnd.Intn(count)),
+			})
+		}
+		patent.Details.Citations.NonPatent = []model.NonPatentCitation{
+			{CitingNumber: citing, Text: words(rnd, 20)},
+		}
+		patents = append(patents, patent)
+	}
+	return patents
+}
+
+var vocabulary = strings.Fields("battery cell charging wireless signal network module housing sensor control " +
+	"circuit electrode layer vehicle antenna processor memory device method system apparatus")
+
+func words(rnd *rand.Rand, n int) string {
+	result := make([]string, n)
+	for i := range result {
+		result[i] = vocabulary[rnd.Intn(len(vocabulary))]
+	}
+	return strings.Join(result, " ")
+}
+
+func text(rnd *rand.Rand, size int) string {
+	var builder strings.Builder
+	for builder.Len() < size {
+		builder.WriteString(words(rnd, 12))
+		builder.WriteString(". ")
+	}
+	return builder.String()[:size]
+}
@@ -0,0 +1,138 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
+)
+
+var (
+	citationColumns    = []string{"citing_number", "cited_number", "category"}
+	nplCitationColumns = []string{"citing_number", "position", "text"}
+)
+
+// citationKeyExpression turns patent.publication_number into a graph key. It
+// must match the expression of patent_citation_key_idx for the index to be
+// used.
+const citationKeyExpression = `regexp_replace(publication_number, '([0-9])[A-Z][0-9]?$', '\1')`
+
+// citationRows returns the citation edges and literature references of
+// patents. Citations are only ever added: a patent that no longer reports an
+// edge keeps it, as the edge may also come from the other end.
+func citationRows(patents []model.FilteredFullPatent) (edges, literature [][]interface{}) {
+	for _, p := range patents {
+		if p.Details == nil {
+			continue
+		}
+		for _, c := range p.Details.Citations.Edges() {
+			edges = append(edges, []interface{}{c.CitingNumber, c.CitedNumber, nullString(c.Category)})
+		}
+		for _, c := range p.Details.Citations.NonPatent {
+			literature = append(literature, []interface{}{c.CitingNumber, c.Position, c.Text})
+		}
+	}
+	return edges, literature
+}
+
+// insertCitationsBulk adds the citations of every patent of the batch,
+// including unchanged ones, since forward citations keep arriving after a
+// patent is published.
+func (r *DBRepository) insertCitationsBulk(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
+	edges, literature := citationRows(patents)
+	if err := insertRowsBulk(ctx, tx, "patent_citation", citationColumns, edges); err != nil {
+		return err
+	}
+	return insertRowsBulk(ctx, tx, "patent_npl_citation", nplCitationColumns, literature)
+}
+
+// CitationNeighbourhood walks the citation graph from a patent in both
+// directions up to input.Depth edges away and returns the nodes closest to it
+// first, with the edges and literature references between them.
+func (r *DBRepository) CitationNeighbourhood(ctx context.Context, input model.CitationNeighbourhoodInput) (*model.CitationNeighbourhood, error) {
+	root := utils.StripKindCode(utils.NormalizePublicationNumber(input.PublicationNumber))
+	neighbourhood := &model.CitationNeighbourhood{
+		PublicationNumber: root,
+		Depth:             input.Depth,
+		Nodes:             make([]model.CitationNode, 0),
+		Edges:             make([]model.Citation, 0),
+		NonPatent:         make([]model.NonPatentCitation, 0),
+	}
+
+	// one extra node tells whether the neighbourhood was truncated
+	var nodes []struct {
+		PublicationNumber string `db:"publication_number"`
+		Distance          int    `db:"distance"`
+	}
+	err := r.db.SelectContext(ctx, &nodes, `
+        WITH RECURSIVE reach (publication_number, distance) AS (
+            SELECT $1::text, 0
+            UNION
+            SELECT CASE WHEN c.citing_number = r.publication_number THEN c.cited_number ELSE c.citing_number END,
+                   r.distance + 1
+            FROM reach r
+            JOIN patent_citation c ON c.citing_number = r.publication_number OR c.cited_number = r.publication_number
+            WHERE r.distance < $2
+        )
+        SELECT publication_number, MIN(distance) AS distance
+        FROM reach
+        GROUP BY publication_number
+        ORDER BY distance, publication_number
+        LIMIT $3`, root, input.Depth, input.MaxNodes+1)
+	if err != nil {
+		return nil, fmt.Errorf("walk citation graph: %w", err)
+	}
+	if len(nodes) > input.MaxNodes {
+		nodes = nodes[:input.MaxNodes]
+		neighbourhood.Truncated = true
+	}
+	numbers := make([]string, 0, len(nodes))
+	index := make(map[string]int, len(nodes))
+	for _, node := range nodes {
+		index[node.PublicationNumber] = len(neighbourhood.Nodes)
+		numbers = append(numbers, node.PublicationNumber)
+		neighbourhood.Nodes = append(neighbourhood.Nodes, model.CitationNode{
+			PublicationNumber: node.PublicationNumber,
+			Distance:          node.Distance,
+		})
+	}
+
+	var stored []struct {
+		Key string    `db:"key"`
+		Id  uuid.UUID `db:"id"`
+	}
+	err = r.db.SelectContext(ctx, &stored, fmt.Sprintf(`
+        SELECT DISTINCT ON (key) key, id
+        FROM (SELECT %s AS key, id, publication_number FROM patent WHERE %s = ANY($1)) p
+        ORDER BY key, publication_number`, citationKeyExpression, citationKeyExpression), pq.Array(numbers))
+	if err != nil {
+		return nil, fmt.Errorf("resolve citation nodes: %w", err)
+	}
+	for _, patent := range stored {
+		if i, ok := index[patent.Key]; ok {
+			id := patent.Id
+			neighbourhood.Nodes[i].PatentId = &id
+		}
+	}
+
+	err = r.db.SelectContext(ctx, &neighbourhood.Edges, `
+        SELECT citing_number, cited_number, COALESCE(category, '') AS category
+        FROM patent_citation
+        WHERE citing_number = ANY($1) AND cited_number = ANY($1)
+        ORDER BY citing_number, cited_number`, pq.Array(numbers))
+	if err != nil {
+		return nil, fmt.Errorf("list citation edges: %w", err)
+	}
+	err = r.db.SelectContext(ctx, &neighbourhood.NonPatent, `
+        SELECT citing_number, position, text
+        FROM patent_npl_citation
+        WHERE citing_number = ANY($1)
+        ORDER BY citing_number, position`, pq.Array(numbers))
+	if err != nil {
+		return nil, fmt.Errorf("list non-patent citations: %w", err)
+	}
+	return neighbourhood, nil
+}
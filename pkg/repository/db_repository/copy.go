@@ -0,0 +1,204 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// The COPY write path streams a batch into temporary staging tables and
+// merges them with one INSERT ... SELECT per target table. It avoids building
+// statements with thousands of placeholders, and long descriptions travel in
+// COPY's text format instead of as bind parameters.
+const createStagingTables = `
+CREATE TEMP TABLE IF NOT EXISTS staging_patent (LIKE patent INCLUDING DEFAULTS) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_claim (LIKE claim INCLUDING DEFAULTS) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_inventor_link (patent_id UUID, name TEXT) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_assignee_link (patent_id UUID, name TEXT) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_jurisdiction_link (patent_id UUID, name TEXT) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_cpc (LIKE patent_cpc INCLUDING DEFAULTS) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_citation (LIKE patent_citation INCLUDING DEFAULTS) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_npl_citation (LIKE patent_npl_citation INCLUDING DEFAULTS) ON COMMIT DROP;
+CREATE TEMP TABLE IF NOT EXISTS staging_patent_id (patent_id UUID) ON COMMIT DROP;
+TRUNCATE staging_patent, staging_claim, staging_inventor_link, staging_assignee_link,
+    staging_jurisdiction_link, staging_cpc, staging_citation, staging_npl_citation, staging_patent_id;`
+
+// staging_patent is created LIKE patent, so the columns line up
+const upsertStagingPatents = `
+INSERT INTO patent SELECT * FROM staging_patent` + patentUpsertConflict
+
+const mergeStagingTables = `
+INSERT INTO inventor (full_name)
+SELECT DISTINCT name FROM staging_inventor_link
+ON CONFLICT DO NOTHING;
+INSERT INTO patentinventorlink (patent_id, inventor_name)
+SELECT DISTINCT patent_id, name FROM staging_inventor_link;
+
+INSERT INTO standardizedcurrentassignee (name)
+SELECT DISTINCT name FROM staging_assignee_link
+ON CONFLICT DO NOTHING;
+INSERT INTO patentstandardizedcurrentassigneelink (patent_id, standardized_current_assignee_name)
+SELECT DISTINCT patent_id, name FROM staging_assignee_link;
+
+INSERT INTO simplefamilyjurisdiction (name)
+SELECT DISTINCT name FROM staging_jurisdiction_link
+ON CONFLICT DO NOTHING;
+INSERT INTO patentsimplefamilyjurisdictionlink (patent_id, family_jurisdiction_name)
+SELECT DISTINCT patent_id, name FROM staging_jurisdiction_link;
+
+INSERT INTO claim (patent_id, claim_number, independent_claim, dependent_claims)
+SELECT patent_id, claim_number, independent_claim, dependent_claims FROM staging_claim;
+
+INSERT INTO patent_cpc SELECT * FROM staging_cpc
+ON CONFLICT DO NOTHING;
+
+INSERT INTO patent_citation SELECT * FROM staging_citation
+ON CONFLICT DO NOTHING;
+INSERT INTO patent_npl_citation SELECT * FROM staging_npl_citation
+ON CONFLICT DO NOTHING;`
+
+// The link merges take parameters, so they have to run as separate statements.
+const (
+	mergeStagingTransactionLinks = `
+INSERT INTO patenttransactionlink (patent_id, transaction_id)
+SELECT s.patent_id, $1::uuid FROM staging_patent_id s
+WHERE NOT EXISTS (
+    SELECT 1 FROM patenttransactionlink l WHERE l.patent_id = s.patent_id AND l.transaction_id = $1::uuid
+)`
+	mergeStagingBundleLinks = `
+INSERT INTO bundlepatentlink (patent_id, bundle_id)
+SELECT s.patent_id, $1::uuid FROM staging_patent_id s
+WHERE NOT EXISTS (
+    SELECT 1 FROM bundlepatentlink l WHERE l.patent_id = s.patent_id AND l.bundle_id = $1::uuid
+)`
+)
+
+// copyPatents is the COPY counterpart of the INSERT path in savePatentsTx.
+// The patents are upserted first, since the ids they end up with are needed
+// for their relations; resolved is reconciled with the outcome.
+func (r *DBRepository) copyPatents(
+	ctx context.Context,
+	resolved *resolvedPatents,
+	transactionId, bundleId uuid.UUID,
+	tx *sqlx.Tx,
+) error {
+	if _, err := tx.ExecContext(ctx, createStagingTables); err != nil {
+		return fmt.Errorf("create staging tables: %w", err)
+	}
+
+	if len(resolved.inserted) > 0 {
+		patentRows := make([][]interface{}, 0, len(resolved.inserted))
+		for _, p := range resolved.inserted {
+			patentRows = append(patentRows, patentValues(p))
+		}
+		if err := copyRows(ctx, tx, "staging_patent", allPatentColumns(), patentRows); err != nil {
+			return fmt.Errorf("copy into staging_patent: %w", err)
+		}
+		upserted := make([]upsertedPatent, 0, len(resolved.inserted))
+		if err := tx.SelectContext(ctx, &upserted, upsertStagingPatents); err != nil {
+			return fmt.Errorf("upsert patents: %w", err)
+		}
+		if err := resolved.reconcile(upserted); err != nil {
+			return err
+		}
+	}
+
+	if len(resolved.updated) > 0 {
+		if err := r.updatePatentsBulk(ctx, resolved.updated, tx); err != nil {
+			return fmt.Errorf("update patents: %w", err)
+		}
+		if err := r.deleteAssigneePatentLinks(ctx, resolved.updated, tx); err != nil {
+			return fmt.Errorf("delete assignee links: %w", err)
+		}
+		if err := r.updatePatentDetailsBulk(ctx, resolved.updated, tx); err != nil {
+			return fmt.Errorf("update patent details: %w", err)
+		}
+		if err := r.deletePatentCPC(ctx, resolved.updated, tx); err != nil {
+			return fmt.Errorf("delete cpc: %w", err)
+		}
+	}
+
+	inventorRows := make([][]interface{}, 0)
+	jurisdictionRows := make([][]interface{}, 0)
+	claimRows := make([][]interface{}, 0)
+	for _, p := range resolved.inserted {
+		for _, name := range p.Patent.InventorsNames {
+			inventorRows = append(inventorRows, []interface{}{p.ID, name})
+		}
+		for _, name := range p.Patent.SimpleFamilyJurisdiction {
+			jurisdictionRows = append(jurisdictionRows, []interface{}{p.ID, name})
+		}
+		for _, claim := range p.Claims {
+			claimRows = append(claimRows, []interface{}{
+				p.ID, claim.ClaimNumber, claim.IndependentClaim, pq.Array(claim.DependantClaims),
+			})
+		}
+	}
+	assigneeRows := make([][]interface{}, 0)
+	cpcStagingRows := make([][]interface{}, 0)
+	for _, p := range append(resolved.inserted, resolved.updated...) {
+		for _, name := range p.Patent.Assignee {
+			assigneeRows = append(assigneeRows, []interface{}{p.ID, name})
+		}
+		cpcStagingRows = append(cpcStagingRows, cpcRows(p)...)
+	}
+	citationStagingRows, nplStagingRows := citationRows(resolved.all)
+	idRows := make([][]interface{}, 0, len(resolved.all))
+	for _, p := range resolved.all {
+		idRows = append(idRows, []interface{}{p.ID})
+	}
+
+	copies := []struct {
+		table   string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{"staging_inventor_link", []string{"patent_id", "name"}, inventorRows},
+		{"staging_assignee_link", []string{"patent_id", "name"}, assigneeRows},
+		{"staging_jurisdiction_link", []string{"patent_id", "name"}, jurisdictionRows},
+		{"staging_claim", []string{"patent_id", "claim_number", "independent_claim", "dependent_claims"}, claimRows},
+		{"staging_cpc", cpcColumns, cpcStagingRows},
+		{"staging_citation", citationColumns, citationStagingRows},
+		{"staging_npl_citation", nplCitationColumns, nplStagingRows},
+		{"staging_patent_id", []string{"patent_id"}, idRows},
+	}
+	for _, c := range copies {
+		if err := copyRows(ctx, tx, c.table, c.columns, c.rows); err != nil {
+			return fmt.Errorf("copy into %s: %w", c.table, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, mergeStagingTables); err != nil {
+		return fmt.Errorf("merge staging tables: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, mergeStagingTransactionLinks, transactionId); err != nil {
+		return fmt.Errorf("merge transaction links: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, mergeStagingBundleLinks, bundleId); err != nil {
+		return fmt.Errorf("merge bundle links: %w", err)
+	}
+	return nil
+}
+
+func copyRows(ctx context.Context, tx *sqlx.Tx, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			_ = stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
 	"log/slog"
@@ -13,6 +14,10 @@ import (
 
 const batchSize = 500
 
+// claimBatchSize caps the rows per claim INSERT; a batch of patents can carry
+// thousands of claims and must stay under the 65535 parameter limit.
+const claimBatchSize = 1000
+
 type DBRepository struct {
 	db  *sqlx.DB
 	log *slog.Logger
@@ -20,6 +25,11 @@ type DBRepository struct {
 }
 
 func NewDBRepository(db *sqlx.DB, log *slog.Logger, cfg *config.Config) *DBRepository {
+	switch cfg.DBWriteMode {
+	case "", config.DBWriteInsert, config.DBWriteCopy:
+	default:
+		panic(fmt.Sprintf("unknown db write mode %q", cfg.DBWriteMode))
+	}
 	return &DBRepository{
 		db:  db,
 		log: log,
@@ -27,10 +37,14 @@ func NewDBRepository(db *sqlx.DB, log *slog.Logger, cfg *config.Config) *DBRepos
 	}
 }
 
-func (r *DBRepository) SavePatents(ctx context.Context, patents []model.FilteredFullPatent, transactionId, bundleId uuid.UUID) error {
+func (r *DBRepository) SavePatents(
+	ctx context.Context,
+	patents []model.FilteredFullPatent,
+	transactionId, bundleId uuid.UUID,
+) (model.SaveStats, error) {
 	tx, err := r.db.Beginx()
 	if err != nil {
-		return err
+		return model.SaveStats{}, err
 	}
 	defer func() {
 		if p := recover(); p != nil {
@@ -38,91 +52,188 @@ func (r *DBRepository) SavePatents(ctx context.Context, patents []model.Filtered
 			panic(p)
 		}
 	}()
-	for i := 0; i < len(patents); i += 500 {
+	stats, err := r.savePatentsTx(ctx, patents, transactionId, bundleId, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return stats, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.SaveStats{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return stats, nil
+}
+
+// savePatentsTx upserts patents by publication number. New patents are
+// inserted with all their relations; known ones keep their id and only get
+// their legal status, expiry date, assignees and details refreshed when those
+// changed or the stored row has no details yet.
+// Every patent is linked to the transaction and bundle exactly once.
+func (r *DBRepository) savePatentsTx(
+	ctx context.Context,
+	patents []model.FilteredFullPatent,
+	transactionId, bundleId uuid.UUID,
+	tx *sqlx.Tx,
+) (model.SaveStats, error) {
+	var stats model.SaveStats
+	for i := 0; i < len(patents); i += batchSize {
 		end := i + batchSize
 		if end > len(patents) {
 			end = len(patents)
 		}
-		if err := r.insertPatentsBulk(ctx, patents[i:end], tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch patents failed: %w", err)
+		resolved, err := r.resolvePatents(ctx, patents[i:end], tx)
+		if err != nil {
+			return stats, fmt.Errorf("look up existing patents failed: %w", err)
 		}
-		if err := r.insertInventorsBulk(ctx, patents[i:end], tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch inventors failed: %w", err)
+
+		if r.cfg.DBWriteMode == config.DBWriteCopy {
+			if err := r.copyPatents(ctx, &resolved, transactionId, bundleId, tx); err != nil {
+				return stats, fmt.Errorf("copy batch patents failed: %w", err)
+			}
+			stats.Add(resolved.stats)
+			continue
 		}
-		if err := r.insertInventorPatentLinksBulk(ctx, patents[i:end], tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch patentsinventors failed: %w", err)
+
+		if len(resolved.inserted) > 0 {
+			upserted, err := r.insertPatentsBulk(ctx, resolved.inserted, tx)
+			if err != nil {
+				return stats, fmt.Errorf("insert batch patents failed: %w", err)
+			}
+			if err := resolved.reconcile(upserted); err != nil {
+				return stats, fmt.Errorf("insert batch patents failed: %w", err)
+			}
 		}
-		if err := r.insertAssigneesBulk(ctx, patents[i:end], tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch assignee failed: %w", err)
+		stats.Add(resolved.stats)
+
+		inserted := resolved.inserted
+		if len(inserted) > 0 {
+			if err := r.insertInventorsBulk(ctx, inserted, tx); err != nil {
+				return stats, fmt.Errorf("insert batch inventors failed: %w", err)
+			}
+			if err := r.insertInventorPatentLinksBulk(ctx, inserted, tx); err != nil {
+				return stats, fmt.Errorf("insert batch patentsinventors failed: %w", err)
+			}
+			if err := r.insertJurisdictionsBulk(ctx, inserted, tx); err != nil {
+				return stats, fmt.Errorf("insert batch jur failed: %w", err)
+			}
+			if err := r.insertJurisdictionsPatentLinksBulk(ctx, inserted, tx); err != nil {
+				return stats, fmt.Errorf("insert batch patentsjur failed: %w", err)
+			}
+			if err := r.insertClaimsBulk(ctx, inserted, tx); err != nil {
+				return stats, fmt.Errorf("insert batch claims failed: %w", err)
+			}
+			if err := r.insertPatentCPCBulk(ctx, inserted, tx); err != nil {
+				return stats, fmt.Errorf("insert batch cpc failed: %w", err)
+			}
 		}
-		if err := r.insertAssigneePatentLinksBulk(ctx, patents[i:end], tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch patentsassignee failed: %w", err)
+		if len(resolved.updated) > 0 {
+			if err := r.updatePatentsBulk(ctx, resolved.updated, tx); err != nil {
+				return stats, fmt.Errorf("update batch patents failed: %w", err)
+			}
+			if err := r.deleteAssigneePatentLinks(ctx, resolved.updated, tx); err != nil {
+				return stats, fmt.Errorf("delete batch patentsassignee failed: %w", err)
+			}
+			if err := r.updatePatentDetailsBulk(ctx, resolved.updated, tx); err != nil {
+				return stats, fmt.Errorf("update batch patent details failed: %w", err)
+			}
+			if err := r.deletePatentCPC(ctx, resolved.updated, tx); err != nil {
+				return stats, fmt.Errorf("delete batch cpc failed: %w", err)
+			}
+			if err := r.insertPatentCPCBulk(ctx, resolved.updated, tx); err != nil {
+				return stats, fmt.Errorf("insert batch cpc failed: %w", err)
+			}
 		}
-		if err := r.insertJurisdictionsBulk(ctx, patents[i:end], tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch jur failed: %w", err)
+
+		withAssignees := append(inserted, resolved.updated...)
+		if err := r.insertAssigneesBulk(ctx, withAssignees, tx); err != nil {
+			return stats, fmt.Errorf("insert batch assignee failed: %w", err)
 		}
-		if err := r.insertJurisdictionsPatentLinksBulk(ctx, patents[i:end], tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch patentsjur failed: %w", err)
+		if err := r.insertAssigneePatentLinksBulk(ctx, withAssignees, tx); err != nil {
+			return stats, fmt.Errorf("insert batch patentsassignee failed: %w", err)
 		}
-		if err := r.insertPatentTransactionLinkBulk(ctx, patents[i:end], transactionId, tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch transactionpat failed: %w", err)
+		if err := r.insertCitationsBulk(ctx, resolved.all, tx); err != nil {
+			return stats, fmt.Errorf("insert batch citations failed: %w", err)
 		}
-		if err := r.insertPatentBundleLinkBulk(ctx, patents[i:end], bundleId, tx); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("insert batch bundlepatents failed: %w", err)
+		if err := r.insertPatentTransactionLinkBulk(ctx, resolved.all, transactionId, tx); err != nil {
+			return stats, fmt.Errorf("insert batch transactionpat failed: %w", err)
 		}
+		if err := r.insertPatentBundleLinkBulk(ctx, resolved.all, bundleId, tx); err != nil {
+			return stats, fmt.Errorf("insert batch bundlepatents failed: %w", err)
+		}
+	}
+	return stats, nil
+}
 
+// insertCheckpoints marks the batch's pages as done.
+func (r *DBRepository) insertCheckpoints(ctx context.Context, batch model.PatentBatch, tx *sqlx.Tx) error {
+	if len(batch.PageOffsets) == 0 {
+		return nil
 	}
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO upload_job_checkpoint (transaction_id, page_offset)
+        SELECT $1, unnest($2::integer[])`,
+		batch.TransactionId, pq.Array(batch.PageOffsets),
+	)
+	return err
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit failed: %w", err)
+// addJobCounters adds saved patents to the job's counters. The update locks
+// the job row until tx ends, which blocks the progress updates of the
+// upload's workers.
+func (r *DBRepository) addJobCounters(
+	ctx context.Context,
+	transactionId uuid.UUID,
+	saved int,
+	stats model.SaveStats,
+	tx *sqlx.Tx,
+) error {
+	if saved == 0 {
+		return nil
 	}
+	_, err := tx.ExecContext(ctx, `
+        UPDATE upload_job
+        SET patents_saved = patents_saved + $2,
+            patents_inserted = patents_inserted + $3,
+            patents_updated = patents_updated + $4,
+            patents_unchanged = patents_unchanged + $5,
+            updated_at = now()
+        WHERE transaction_id = $1`,
+		transactionId, saved, stats.Inserted, stats.Updated, stats.Unchanged,
+	)
 	return err
 }
 
-func (r *DBRepository) insertPatentsBulk(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
-	const fieldsPerRow = 9
+// insertPatentsBulk upserts new patents and returns the id each one ended up
+// with, see patentUpsertConflict.
+func (r *DBRepository) insertPatentsBulk(
+	ctx context.Context,
+	patents []model.FilteredFullPatent,
+	tx *sqlx.Tx,
+) ([]upsertedPatent, error) {
+	columns := allPatentColumns()
+	fieldsPerRow := len(columns)
 
 	placeholders := make([]string, 0, len(patents))
 	args := make([]interface{}, 0, len(patents)*fieldsPerRow)
 
 	for i, p := range patents {
-		offset := i * fieldsPerRow
-		placeholders = append(placeholders, fmt.Sprintf(
-			"($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d) ",
-			offset+1, offset+2, offset+3, offset+4, offset+5, offset+6, offset+7, offset+8, offset+9,
-		))
-		args = append(args,
-			p.ID,
-			p.Patent.Title,
-			p.Description,
-			p.Abstract,
-			p.Patent.PublicationNumber,
-			p.Patent.EarliestPriorityDate,
-			p.Patent.EstimatedExpiryDate,
-			p.Patent.ApplicationDate,
-			p.Patent.SimpleLegalStatus,
-		)
+		row := make([]string, fieldsPerRow)
+		for j := range row {
+			row[j] = fmt.Sprintf("$%d", i*fieldsPerRow+j+1)
+		}
+		placeholders = append(placeholders, "("+strings.Join(row, ",")+")")
+		args = append(args, patentValues(p)...)
 	}
 
 	query := fmt.Sprintf(`
-        INSERT INTO patent (
-            id, title, description, abstract,
-            publication_number, earliest_priority_date,
-            estimated_expiry_date, application_date, simple_legal_status
-        )
-        VALUES %s`, strings.Join(placeholders, ","))
+        INSERT INTO patent (%s)
+        VALUES %s`, strings.Join(columns, ", "), strings.Join(placeholders, ",")) + patentUpsertConflict
 
-	_, err := tx.ExecContext(ctx, query, args...)
-	return err
+	rows := make([]upsertedPatent, 0, len(patents))
+	if err := tx.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	return rows, nil
 }
 
 func (r *DBRepository) insertInventorsBulk(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
@@ -168,7 +279,8 @@ func (r *DBRepository) insertInventorPatentLinksBulk(ctx context.Context, patent
 		return nil
 	}
 	query := fmt.Sprintf(`
-INSERT INTO patentinventorlink (patent_id, inventor_name) VALUES %s`, strings.Join(placeholders, ","))
+INSERT INTO patentinventorlink (patent_id, inventor_name) VALUES %s
+ON CONFLICT DO NOTHING`, strings.Join(placeholders, ","))
 	_, err := tx.ExecContext(ctx, query, args...)
 	return err
 }
@@ -216,7 +328,8 @@ func (r *DBRepository) insertAssigneePatentLinksBulk(ctx context.Context, patent
 		return nil
 	}
 	query := fmt.Sprintf(`
-INSERT INTO patentstandardizedcurrentassigneelink (patent_id, standardized_current_assignee_name) VALUES %s`, strings.Join(placeholders, ","))
+INSERT INTO patentstandardizedcurrentassigneelink (patent_id, standardized_current_assignee_name) VALUES %s
+ON CONFLICT DO NOTHING`, strings.Join(placeholders, ","))
 	_, err := tx.ExecContext(ctx, query, args...)
 	return err
 }
@@ -264,7 +377,8 @@ func (r *DBRepository) insertJurisdictionsPatentLinksBulk(ctx context.Context, p
 		return nil
 	}
 	query := fmt.Sprintf(`
-INSERT INTO patentsimplefamilyjurisdictionlink (patent_id, family_jurisdiction_name) VALUES %s`, strings.Join(placeholders, ","))
+INSERT INTO patentsimplefamilyjurisdictionlink (patent_id, family_jurisdiction_name) VALUES %s
+ON CONFLICT DO NOTHING`, strings.Join(placeholders, ","))
 	_, err := tx.ExecContext(ctx, query, args...)
 	return err
 }
@@ -275,7 +389,7 @@ func (r *DBRepository) insertPatentTransactionLinkBulk(ctx context.Context, pate
 
 	for i, p := range patents {
 		idx := i*2 + 1
-		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d)", idx, idx+1))
+		placeholders = append(placeholders, fmt.Sprintf("($%d::uuid, $%d::uuid)", idx, idx+1))
 		args = append(args, p.ID, transactionId)
 	}
 
@@ -285,7 +399,12 @@ func (r *DBRepository) insertPatentTransactionLinkBulk(ctx context.Context, pate
 
 	query := fmt.Sprintf(`
         INSERT INTO patenttransactionlink (patent_id, transaction_id)
-        VALUES %s`, strings.Join(placeholders, ","))
+        SELECT v.patent_id, v.transaction_id
+        FROM (VALUES %s) AS v (patent_id, transaction_id)
+        WHERE NOT EXISTS (
+            SELECT 1 FROM patenttransactionlink l
+            WHERE l.patent_id = v.patent_id AND l.transaction_id = v.transaction_id
+        )`, strings.Join(placeholders, ","))
 
 	_, err := tx.ExecContext(ctx, query, args...)
 	return err
@@ -297,7 +416,7 @@ func (r *DBRepository) insertPatentBundleLinkBulk(ctx context.Context, patents [
 
 	for i, p := range patents {
 		idx := i*2 + 1
-		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d)", idx, idx+1))
+		placeholders = append(placeholders, fmt.Sprintf("($%d::uuid, $%d::uuid)", idx, idx+1))
 		args = append(args, p.ID, bundleId)
 	}
 
@@ -307,12 +426,44 @@ func (r *DBRepository) insertPatentBundleLinkBulk(ctx context.Context, patents [
 
 	query := fmt.Sprintf(`
         INSERT INTO bundlepatentlink (patent_id, bundle_id)
-        VALUES %s`, strings.Join(placeholders, ","))
+        SELECT v.patent_id, v.bundle_id
+        FROM (VALUES %s) AS v (patent_id, bundle_id)
+        WHERE NOT EXISTS (
+            SELECT 1 FROM bundlepatentlink l
+            WHERE l.patent_id = v.patent_id AND l.bundle_id = v.bundle_id
+        )`, strings.Join(placeholders, ","))
 
 	_, err := tx.ExecContext(ctx, query, args...)
 	return err
 }
 
-func (r *DBRepository) saveClaims(claims *model.Claim, tx *sqlx.Tx) error {
+func (r *DBRepository) insertClaimsBulk(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
+	claims := make([]model.Claim, 0, len(patents))
+	for _, p := range patents {
+		for _, claim := range p.Claims {
+			claim.PatentID = p.ID
+			claims = append(claims, claim)
+		}
+	}
+
+	for i := 0; i < len(claims); i += claimBatchSize {
+		end := i + claimBatchSize
+		if end > len(claims) {
+			end = len(claims)
+		}
+		placeholders := make([]string, 0, end-i)
+		args := make([]interface{}, 0, (end-i)*4)
+		for j, claim := range claims[i:end] {
+			idx := j*4 + 1
+			placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d)", idx, idx+1, idx+2, idx+3))
+			args = append(args, claim.PatentID, claim.ClaimNumber, claim.IndependentClaim, pq.Array(claim.DependantClaims))
+		}
+		query := fmt.Sprintf(`
+        INSERT INTO claim (patent_id, claim_number, independent_claim, dependent_claims)
+        VALUES %s`, strings.Join(placeholders, ","))
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,90 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+var testLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// testDB connects to the database named by the DB_* environment variables
+// and migrates it. Tests that need it are skipped when DB_HOST is not set;
+// point them at a scratch database, since they write real rows.
+func testDB(tb testing.TB) *sqlx.DB {
+	tb.Helper()
+	if os.Getenv("DB_HOST") == "" {
+		tb.Skip("DB_HOST not set, skipping database test")
+	}
+	db, err := NewPostgresDb(Config{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		Username: os.Getenv("DB_USERNAME"),
+		Password: os.Getenv("DB_PASSWORD"),
+		DBName:   os.Getenv("DB_NAME"),
+		SSLMode:  os.Getenv("SSL_MODE"),
+	})
+	if err != nil {
+		tb.Fatalf("failed to connect to db: %s", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if _, err := NewMigrator(db, testLog).Up(context.Background()); err != nil {
+		tb.Fatalf("failed to migrate: %s", err)
+	}
+	return db
+}
+
+// testPatents returns count minimal patents with publication numbers unique
+// to this run.
+func testPatents(prefix string, count int) []model.FilteredFullPatent {
+	prefix = fmt.Sprintf("%s%d", prefix, time.Now().UnixNano())
+	patents := make([]model.FilteredFullPatent, 0, count)
+	for i := 0; i < count; i++ {
+		patents = append(patents, model.FilteredFullPatent{
+			ID: uuid.New(),
+			Patent: model.FilteredPatent{
+				Title:             fmt.Sprintf("Test patent %d", i),
+				PublicationNumber: fmt.Sprintf("%s%07dB2", prefix, i),
+			},
+			Claims: []model.Claim{{ClaimNumber: 1, IndependentClaim: "A method."}},
+		})
+	}
+	return patents
+}
+
+// cleanUpTransactions deletes the patents saved under the transactions and
+// their upload jobs.
+func cleanUpTransactions(db *sqlx.DB, transactions []uuid.UUID) error {
+	ids := make([]string, 0, len(transactions))
+	for _, id := range transactions {
+		ids = append(ids, id.String())
+	}
+	const patents = `SELECT patent_id FROM patenttransactionlink WHERE transaction_id = ANY($1::uuid[])`
+	const citationKeys = `SELECT regexp_replace(publication_number, '([0-9])[A-Z][0-9]?$', '\1') FROM patent WHERE id IN (` + patents + `)`
+	for _, query := range []string{
+		`DELETE FROM claim WHERE patent_id IN (` + patents + `)`,
+		`DELETE FROM patent_cpc WHERE patent_id IN (` + patents + `)`,
+		`DELETE FROM patentinventorlink WHERE patent_id IN (` + patents + `)`,
+		`DELETE FROM patentstandardizedcurrentassigneelink WHERE patent_id IN (` + patents + `)`,
+		`DELETE FROM patentsimplefamilyjurisdictionlink WHERE patent_id IN (` + patents + `)`,
+		`DELETE FROM bundlepatentlink WHERE patent_id IN (` + patents + `)`,
+		`DELETE FROM patent_citation WHERE citing_number IN (` + citationKeys + `)`,
+		`DELETE FROM patent_npl_citation WHERE citing_number IN (` + citationKeys + `)`,
+		`DELETE FROM patent WHERE id IN (` + patents + `)`,
+		`DELETE FROM patenttransactionlink WHERE transaction_id = ANY($1::uuid[])`,
+		`DELETE FROM upload_job WHERE transaction_id = ANY($1::uuid[])`,
+	} {
+		if _, err := db.Exec(query, pq.Array(ids)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
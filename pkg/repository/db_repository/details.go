@@ -0,0 +1,224 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"strings"
+	"time"
+)
+
+// patentColumns are the core patent columns filled from model.FilteredPatent.
+var patentColumns = []string{
+	"id", "title", "description", "abstract",
+	"publication_number", "earliest_priority_date",
+	"estimated_expiry_date", "application_date", "simple_legal_status",
+}
+
+// patentDetailColumns are the patent columns filled from model.ParsedPatent,
+// with the types the VALUES list of updatePatentDetailsBulk needs.
+var patentDetailColumns = []struct {
+	name    string
+	sqlType string
+}{
+	{"brief_description_of_drawings", "text"},
+	{"inpadoc_family", "text"},
+	{"inpadoc_family_application_count", "integer"},
+	{"inpadoc_family_jurisdiction", "text"},
+	{"inpadoc_family_jurisdiction_count", "integer"},
+	{"authority", "text"},
+	{"application_number", "text"},
+	{"issue_date", "date"},
+	{"publication_date", "date"},
+	{"first_claim", "text"},
+	{"total_number_of_claims", "integer"},
+	{"total_number_of_independent_claims", "integer"},
+	{"count_of_cited_by_patents", "integer"},
+	{"file_url", "text"},
+	{"simple_family_key", "text"},
+}
+
+// allPatentColumns lists the core columns followed by the detail columns, in
+// the order of patentValues.
+func allPatentColumns() []string {
+	columns := make([]string, 0, len(patentColumns)+len(patentDetailColumns))
+	columns = append(columns, patentColumns...)
+	for _, column := range patentDetailColumns {
+		columns = append(columns, column.name)
+	}
+	return columns
+}
+
+func patentValues(p model.FilteredFullPatent) []interface{} {
+	values := make([]interface{}, 0, len(patentColumns)+len(patentDetailColumns))
+	values = append(values,
+		p.ID,
+		p.Patent.Title,
+		p.Description,
+		p.Abstract,
+		p.Patent.PublicationNumber,
+		p.Patent.EarliestPriorityDate,
+		p.Patent.EstimatedExpiryDate,
+		p.Patent.ApplicationDate,
+		p.Patent.SimpleLegalStatus,
+	)
+	return append(values, patentDetailValues(p)...)
+}
+
+// patentDetailValues returns the detail columns of a patent, all NULL when
+// the provider did not return details.
+func patentDetailValues(p model.FilteredFullPatent) []interface{} {
+	d := p.Details
+	if d == nil {
+		return make([]interface{}, len(patentDetailColumns))
+	}
+	return []interface{}{
+		d.BriefDescriptionOfDrawings,
+		d.InpadocFamily,
+		d.InpadocFamilyApplicationCount,
+		d.InpadocFamilyJurisdiction,
+		d.InpadocFamilyJurisdictionCount,
+		d.Authority,
+		d.ApplicationNumber,
+		nullDate(d.IssueDate),
+		nullDate(d.PublicationDate),
+		d.FirstClaim,
+		d.TotalNumberOfClaims,
+		d.TotalNumberOfIndependentClaims,
+		d.CountOfCitedByPatents,
+		d.FileURL,
+		nullString(d.SimpleFamilyKey),
+	}
+}
+
+func nullDate(value time.Time) interface{} {
+	if value.IsZero() {
+		return nil
+	}
+	return value
+}
+
+// cpcColumns are the patent_cpc columns in the order of cpcRows.
+var cpcColumns = []string{"patent_id", "symbol", "position", "section", "class", "subclass", "main_group", "subgroup", "inventive"}
+
+// cpcRows returns the distinct CPC classifications of a patent with their
+// position in the provider's list, which puts the main classification first.
+// Levels of symbols that did not parse are stored as NULL.
+func cpcRows(p model.FilteredFullPatent) [][]interface{} {
+	if p.Details == nil {
+		return nil
+	}
+	classifications := p.Details.CPCClassifications
+	rows := make([][]interface{}, 0, len(classifications))
+	seen := make(map[string]struct{}, len(classifications))
+	for position, c := range classifications {
+		if _, exists := seen[c.Symbol]; exists || c.Symbol == "" {
+			continue
+		}
+		seen[c.Symbol] = struct{}{}
+		rows = append(rows, []interface{}{
+			p.ID, c.Symbol, position,
+			nullString(c.Section), nullString(c.Class), nullString(c.Subclass),
+			nullString(c.Group), nullString(c.Subgroup), c.Inventive,
+		})
+	}
+	return rows
+}
+
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func (r *DBRepository) updatePatentDetailsBulk(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
+	fieldsPerRow := len(patentDetailColumns) + 1
+	placeholders := make([]string, 0, len(patents))
+	args := make([]interface{}, 0, len(patents)*fieldsPerRow)
+	for _, p := range patents {
+		if p.Details == nil {
+			continue
+		}
+		casts := make([]string, 0, fieldsPerRow)
+		casts = append(casts, fmt.Sprintf("$%d::uuid", len(args)+1))
+		for i, column := range patentDetailColumns {
+			casts = append(casts, fmt.Sprintf("$%d::%s", len(args)+i+2, column.sqlType))
+		}
+		placeholders = append(placeholders, "("+strings.Join(casts, ", ")+")")
+		args = append(args, p.ID)
+		args = append(args, patentDetailValues(p)...)
+	}
+	if len(placeholders) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(patentDetailColumns))
+	assignments := make([]string, 0, len(patentDetailColumns))
+	for _, column := range patentDetailColumns {
+		names = append(names, column.name)
+		assignments = append(assignments, fmt.Sprintf("%s = v.%s", column.name, column.name))
+	}
+	query := fmt.Sprintf(`
+        UPDATE patent AS p
+        SET %s
+        FROM (VALUES %s) AS v (id, %s)
+        WHERE p.id = v.id`,
+		strings.Join(assignments, ", "), strings.Join(placeholders, ","), strings.Join(names, ", "))
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *DBRepository) insertPatentCPCBulk(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
+	var rows [][]interface{}
+	for _, p := range patents {
+		rows = append(rows, cpcRows(p)...)
+	}
+	return insertRowsBulk(ctx, tx, "patent_cpc", cpcColumns, rows)
+}
+
+// insertRowsBulk inserts rows in chunks of claimBatchSize, skipping rows that
+// already exist.
+func insertRowsBulk(ctx context.Context, tx *sqlx.Tx, table string, columns []string, rows [][]interface{}) error {
+	for i := 0; i < len(rows); i += claimBatchSize {
+		end := i + claimBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		placeholders := make([]string, 0, end-i)
+		args := make([]interface{}, 0, (end-i)*len(columns))
+		for _, row := range rows[i:end] {
+			values := make([]string, len(row))
+			for k := range row {
+				values[k] = fmt.Sprintf("$%d", len(args)+k+1)
+			}
+			placeholders = append(placeholders, "("+strings.Join(values, ", ")+")")
+			args = append(args, row...)
+		}
+		query := fmt.Sprintf(`
+        INSERT INTO %s (%s)
+        VALUES %s
+        ON CONFLICT DO NOTHING`, table, strings.Join(columns, ", "), strings.Join(placeholders, ","))
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePatentCPC drops the stored CPC rows of patents whose details are
+// about to be replaced.
+func (r *DBRepository) deletePatentCPC(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
+	ids := make([]string, 0, len(patents))
+	for _, p := range patents {
+		if p.Details != nil {
+			ids = append(ids, p.ID.String())
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM patent_cpc WHERE patent_id = ANY($1::uuid[])`, pq.Array(ids))
+	return err
+}
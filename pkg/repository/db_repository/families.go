@@ -0,0 +1,93 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+)
+
+// ListTransactionFamilyMembers returns the patents saved by an upload with
+// their family data. Patents saved without details fall back to the country
+// prefix of their publication number as authority.
+func (r *DBRepository) ListTransactionFamilyMembers(ctx context.Context, transactionId uuid.UUID) ([]model.FamilyMember, error) {
+	members := make([]model.FamilyMember, 0)
+	err := r.db.SelectContext(ctx, &members, `
+        SELECT p.id, p.publication_number,
+               COALESCE(NULLIF(p.authority, ''), substring(p.publication_number FROM 1 FOR 2)) AS authority,
+               COALESCE(p.inpadoc_family, '') AS inpadoc_family,
+               COALESCE(p.simple_family_key, '') AS simple_family_key
+        FROM patent p
+        JOIN patenttransactionlink t ON t.patent_id = p.id
+        WHERE t.transaction_id = $1
+        ORDER BY p.publication_number`, transactionId)
+	if err != nil {
+		return nil, fmt.Errorf("list family members: %w", err)
+	}
+	return members, nil
+}
+
+// SuppressFamilyMembers removes the suppressed members of an upload from its
+// bundle and records them against their representatives. It replaces the
+// outcome of an earlier run for the same upload, so a resumed upload can
+// collapse again, and stores the count on the upload job.
+func (r *DBRepository) SuppressFamilyMembers(
+	ctx context.Context,
+	transactionId, bundleId uuid.UUID,
+	suppressions []model.FamilySuppression,
+) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	suppressedIds := make([]string, 0, len(suppressions))
+	representativeIds := make([]string, 0, len(suppressions))
+	families := make([]string, 0, len(suppressions))
+	for _, suppression := range suppressions {
+		suppressedIds = append(suppressedIds, suppression.SuppressedId.String())
+		representativeIds = append(representativeIds, suppression.RepresentativeId.String())
+		families = append(families, string(suppression.Family))
+	}
+
+	// members kept by this run may have been suppressed by an earlier upload
+	_, err = tx.ExecContext(ctx, `
+        DELETE FROM patent_family_suppression s
+        USING patenttransactionlink t
+        WHERE s.bundle_id = $1 AND t.transaction_id = $2 AND t.patent_id = s.suppressed_id
+          AND NOT s.suppressed_id = ANY($3::uuid[])`,
+		bundleId, transactionId, pq.Array(suppressedIds))
+	if err != nil {
+		return fmt.Errorf("delete stale family suppressions: %w", err)
+	}
+	if len(suppressions) > 0 {
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO patent_family_suppression (bundle_id, suppressed_id, representative_id, transaction_id, family)
+            SELECT $1, s.suppressed_id, s.representative_id, $2, s.family
+            FROM unnest($3::uuid[], $4::uuid[], $5::text[]) AS s (suppressed_id, representative_id, family)
+            ON CONFLICT (bundle_id, suppressed_id) DO UPDATE SET
+                representative_id = EXCLUDED.representative_id,
+                transaction_id = EXCLUDED.transaction_id,
+                family = EXCLUDED.family,
+                created_at = now()`,
+			bundleId, transactionId, pq.Array(suppressedIds), pq.Array(representativeIds), pq.Array(families))
+		if err != nil {
+			return fmt.Errorf("insert family suppressions: %w", err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM bundlepatentlink WHERE bundle_id = $1 AND patent_id = ANY($2::uuid[])`,
+			bundleId, pq.Array(suppressedIds))
+		if err != nil {
+			return fmt.Errorf("delete suppressed bundle links: %w", err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+        UPDATE upload_job SET patents_collapsed = $2, updated_at = now()
+        WHERE transaction_id = $1`, transactionId, len(suppressions))
+	if err != nil {
+		return fmt.Errorf("update collapsed count: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,308 @@
+package db_repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockId is the advisory lock held while migrations run, so two
+// instances started together do not apply the same version twice.
+const migrationLockId = 7_311_402_615
+
+const migrationTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// Migration is one versioned schema change read from migrations/, named
+// <version>_<name>.up.sql with a matching .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	log        *slog.Logger
+	migrations []Migration
+}
+
+func NewMigrator(db *sqlx.DB, log *slog.Logger) *Migrator {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		panic(err)
+	}
+	return &Migrator{
+		db:         db,
+		log:        log,
+		migrations: migrations,
+	}
+}
+
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionPart, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>", name)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+		body, err := fs.ReadFile(files, path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up or down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns the migrations it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	op := "db_repository.Migrator.Up"
+	log := m.log.With(slog.String("op", op))
+
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, done := versions[migration.Version]; done {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration.up, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+					migration.Version, migration.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Info("applied migration", slog.Int("version", migration.Version), slog.String("name", migration.Name))
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied migration. It returns nil when
+// nothing has been applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	op := "db_repository.Migrator.Down"
+	log := m.log.With(slog.String("op", op))
+
+	var reverted *Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		var version int
+		err := conn.GetContext(ctx, &version, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return nil
+		}
+		migration, ok := m.find(version)
+		if !ok {
+			return fmt.Errorf("migration %d is applied but unknown to this build", version)
+		}
+		if err := runMigration(ctx, conn, migration.down, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, version)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		log.Info("reverted migration", slog.Int("version", migration.Version), slog.String("name", migration.Name))
+		reverted = &migration
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration with the time it was applied, followed
+// by any applied versions this build does not know about.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if _, err := m.db.ExecContext(ctx, migrationTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	var rows []struct {
+		Version   int       `db:"version"`
+		Name      string    `db:"name"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	err := m.db.SelectContext(ctx, &rows, `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range rows {
+		if _, ok := m.find(row.Version); !ok {
+			at := row.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: row.Version, Name: row.Name, AppliedAt: &at})
+		}
+	}
+	return statuses, nil
+}
+
+// CheckSchema fails when the database is missing migrations this build needs
+// or has migrations from a newer build, so the service never runs against a
+// schema it was not written for.
+func (m *Migrator) CheckSchema(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	var pending, unknown []string
+	for _, status := range statuses {
+		label := fmt.Sprintf("%d_%s", status.Version, status.Name)
+		if _, ok := m.find(status.Version); !ok {
+			unknown = append(unknown, label)
+		} else if status.AppliedAt == nil {
+			pending = append(pending, label)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is out of date, run `migrate up` to apply: %s", strings.Join(pending, ", "))
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("database schema is newer than this build: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockId); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockId); err != nil {
+			m.log.Error("failed to release migration lock", slog.String("error", err.Error()))
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, migrationTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int]struct{}, error) {
+	var versions []int
+	if err := conn.SelectContext(ctx, &versions, `SELECT version FROM schema_migrations`); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]struct{}, len(versions))
+	for _, version := range versions {
+		applied[version] = struct{}{}
+	}
+	return applied, nil
+}
+
+// runMigration executes a migration script and its bookkeeping in one
+// transaction, so a failing script leaves no partial schema behind.
+func runMigration(ctx context.Context, conn *sqlx.Conn, script string, record func(tx *sqlx.Tx) error) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS claim;
+DROP TABLE IF EXISTS bundlepatentlink;
+DROP TABLE IF EXISTS patenttransactionlink;
+DROP TABLE IF EXISTS patentsimplefamilyjurisdictionlink;
+DROP TABLE IF EXISTS simplefamilyjurisdiction;
+DROP TABLE IF EXISTS patentstandardizedcurrentassigneelink;
+DROP TABLE IF EXISTS standardizedcurrentassignee;
+DROP TABLE IF EXISTS patentinventorlink;
+DROP TABLE IF EXISTS inventor;
+DROP TABLE IF EXISTS patent;
@@ -0,0 +1,93 @@
+-- Baseline of the patent tables. Written with IF NOT EXISTS so it can be
+-- applied to databases whose tables were created by hand before migrations
+-- existed. Such a database may hold duplicate publication numbers, which
+-- must be merged by hand before the unique index can build; the migration
+-- fails naming them rather than pick which copy to keep.
+
+CREATE TABLE IF NOT EXISTS patent (
+    id                     UUID PRIMARY KEY,
+    title                  TEXT NOT NULL DEFAULT '',
+    description            TEXT NOT NULL DEFAULT '',
+    abstract               TEXT NOT NULL DEFAULT '',
+    publication_number     TEXT NOT NULL,
+    earliest_priority_date DATE,
+    estimated_expiry_date  DATE,
+    application_date       DATE,
+    simple_legal_status    TEXT
+);
+DO $$
+DECLARE
+    duplicates TEXT;
+    total      INTEGER;
+BEGIN
+    SELECT count(*),
+           string_agg(publication_number, ', ' ORDER BY publication_number) FILTER (WHERE rank <= 20)
+    INTO total, duplicates
+    FROM (
+        SELECT publication_number, row_number() OVER (ORDER BY publication_number) AS rank
+        FROM patent
+        GROUP BY publication_number
+        HAVING count(*) > 1
+    ) duplicated;
+    IF total > 0 THEN
+        RAISE EXCEPTION 'patent holds % duplicated publication numbers, merge them before migrating: %',
+            total, duplicates || CASE WHEN total > 20 THEN ', ...' ELSE '' END;
+    END IF;
+END
+$$;
+CREATE UNIQUE INDEX IF NOT EXISTS patent_publication_number_key ON patent (publication_number);
+
+CREATE TABLE IF NOT EXISTS inventor (
+    full_name TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS patentinventorlink (
+    patent_id     UUID NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    inventor_name TEXT NOT NULL REFERENCES inventor (full_name),
+    PRIMARY KEY (patent_id, inventor_name)
+);
+CREATE INDEX IF NOT EXISTS patentinventorlink_inventor_name_idx ON patentinventorlink (inventor_name);
+
+CREATE TABLE IF NOT EXISTS standardizedcurrentassignee (
+    name TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS patentstandardizedcurrentassigneelink (
+    patent_id                          UUID NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    standardized_current_assignee_name TEXT NOT NULL REFERENCES standardizedcurrentassignee (name),
+    PRIMARY KEY (patent_id, standardized_current_assignee_name)
+);
+CREATE INDEX IF NOT EXISTS patentstandardizedcurrentassigneelink_name_idx
+    ON patentstandardizedcurrentassigneelink (standardized_current_assignee_name);
+
+CREATE TABLE IF NOT EXISTS simplefamilyjurisdiction (
+    name TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS patentsimplefamilyjurisdictionlink (
+    patent_id                UUID NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    family_jurisdiction_name TEXT NOT NULL REFERENCES simplefamilyjurisdiction (name),
+    PRIMARY KEY (patent_id, family_jurisdiction_name)
+);
+
+CREATE TABLE IF NOT EXISTS patenttransactionlink (
+    patent_id      UUID NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    transaction_id UUID NOT NULL,
+    PRIMARY KEY (patent_id, transaction_id)
+);
+CREATE INDEX IF NOT EXISTS patenttransactionlink_transaction_id_idx ON patenttransactionlink (transaction_id);
+
+CREATE TABLE IF NOT EXISTS bundlepatentlink (
+    patent_id UUID NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    bundle_id UUID NOT NULL,
+    PRIMARY KEY (patent_id, bundle_id)
+);
+CREATE INDEX IF NOT EXISTS bundlepatentlink_bundle_id_idx ON bundlepatentlink (bundle_id);
+
+CREATE TABLE IF NOT EXISTS claim (
+    patent_id         UUID    NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    claim_number      INTEGER NOT NULL,
+    independent_claim TEXT    NOT NULL DEFAULT '',
+    dependent_claims  TEXT[]  NOT NULL DEFAULT '{}',
+    PRIMARY KEY (patent_id, claim_number)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS upload_job_checkpoint;
+DROP TABLE IF EXISTS upload_job;
@@ -0,0 +1,30 @@
+-- Written with IF NOT EXISTS for databases where the service created these
+-- tables itself before migrations existed.
+
+CREATE TABLE IF NOT EXISTS upload_job (
+    transaction_id UUID PRIMARY KEY,
+    bundle_id      UUID        NOT NULL,
+    filters        JSONB       NOT NULL DEFAULT '{}',
+    state          TEXT        NOT NULL,
+    total_patents  INTEGER     NOT NULL DEFAULT 0,
+    pages_fetched  INTEGER     NOT NULL DEFAULT 0,
+    patents_parsed INTEGER     NOT NULL DEFAULT 0,
+    patents_saved  INTEGER     NOT NULL DEFAULT 0,
+    error          TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at    TIMESTAMPTZ
+);
+ALTER TABLE upload_job
+    ADD COLUMN IF NOT EXISTS patents_inserted  INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS patents_updated   INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS patents_unchanged INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS upload_job_bundle_id_idx ON upload_job (bundle_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS upload_job_state_idx ON upload_job (state, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS upload_job_checkpoint (
+    transaction_id UUID        NOT NULL REFERENCES upload_job (transaction_id) ON DELETE CASCADE,
+    page_offset    INTEGER     NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (transaction_id, page_offset)
+);
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS patent_cpc;
+
+ALTER TABLE patent
+    DROP COLUMN IF EXISTS brief_description_of_drawings,
+    DROP COLUMN IF EXISTS inpadoc_family,
+    DROP COLUMN IF EXISTS inpadoc_family_application_count,
+    DROP COLUMN IF EXISTS inpadoc_family_jurisdiction,
+    DROP COLUMN IF EXISTS inpadoc_family_jurisdiction_count,
+    DROP COLUMN IF EXISTS authority,
+    DROP COLUMN IF EXISTS application_number,
+    DROP COLUMN IF EXISTS issue_date,
+    DROP COLUMN IF EXISTS publication_date,
+    DROP COLUMN IF EXISTS first_claim,
+    DROP COLUMN IF EXISTS total_number_of_claims,
+    DROP COLUMN IF EXISTS total_number_of_independent_claims,
+    DROP COLUMN IF EXISTS count_of_cited_by_patents,
+    DROP COLUMN IF EXISTS file_url;
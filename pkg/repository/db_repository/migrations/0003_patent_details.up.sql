@@ -0,0 +1,23 @@
+ALTER TABLE patent
+    ADD COLUMN brief_description_of_drawings      TEXT,
+    ADD COLUMN inpadoc_family                     TEXT,
+    ADD COLUMN inpadoc_family_application_count   INTEGER,
+    ADD COLUMN inpadoc_family_jurisdiction        TEXT,
+    ADD COLUMN inpadoc_family_jurisdiction_count  INTEGER,
+    ADD COLUMN authority                          TEXT,
+    ADD COLUMN application_number                 TEXT,
+    ADD COLUMN issue_date                         DATE,
+    ADD COLUMN publication_date                   DATE,
+    ADD COLUMN first_claim                        TEXT,
+    ADD COLUMN total_number_of_claims             INTEGER,
+    ADD COLUMN total_number_of_independent_claims INTEGER,
+    ADD COLUMN count_of_cited_by_patents          INTEGER,
+    ADD COLUMN file_url                           TEXT;
+
+CREATE TABLE patent_cpc (
+    patent_id UUID    NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    symbol    TEXT    NOT NULL,
+    position  INTEGER NOT NULL,
+    PRIMARY KEY (patent_id, symbol)
+);
+CREATE INDEX patent_cpc_symbol_idx ON patent_cpc (symbol);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS patent_cpc_hierarchy_idx;
+
+ALTER TABLE patent_cpc
+    DROP COLUMN IF EXISTS section,
+    DROP COLUMN IF EXISTS class,
+    DROP COLUMN IF EXISTS subclass,
+    DROP COLUMN IF EXISTS main_group,
+    DROP COLUMN IF EXISTS subgroup,
+    DROP COLUMN IF EXISTS inventive;
@@ -0,0 +1,24 @@
+ALTER TABLE patent_cpc
+    ADD COLUMN section    TEXT,
+    ADD COLUMN class      TEXT,
+    ADD COLUMN subclass   TEXT,
+    ADD COLUMN main_group TEXT,
+    ADD COLUMN subgroup   TEXT,
+    ADD COLUMN inventive  BOOLEAN NOT NULL DEFAULT false;
+
+-- split the symbols stored so far; the first symbol of a patent is its main one
+UPDATE patent_cpc c
+SET section = m.parts[1],
+    class = m.parts[2],
+    subclass = m.parts[3],
+    main_group = m.parts[4],
+    subgroup = m.parts[5],
+    inventive = c.position = 0
+FROM (
+    SELECT patent_id, symbol,
+           regexp_match(upper(replace(symbol, ' ', '')), '^([A-HY])([0-9]{2})([A-Z])0*([0-9]{1,4})/([0-9]{1,6})$') AS parts
+    FROM patent_cpc
+) m
+WHERE m.patent_id = c.patent_id AND m.symbol = c.symbol AND m.parts IS NOT NULL;
+
+CREATE INDEX patent_cpc_hierarchy_idx ON patent_cpc (section, class, subclass, main_group, subgroup);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS patent_family_suppression;
+ALTER TABLE upload_job DROP COLUMN IF EXISTS patents_collapsed;
+DROP INDEX IF EXISTS patent_simple_family_key_idx;
+ALTER TABLE patent DROP COLUMN IF EXISTS simple_family_key;
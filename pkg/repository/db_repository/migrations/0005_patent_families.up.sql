@@ -0,0 +1,19 @@
+ALTER TABLE patent ADD COLUMN simple_family_key TEXT;
+CREATE INDEX patent_simple_family_key_idx ON patent (simple_family_key) WHERE simple_family_key IS NOT NULL;
+
+ALTER TABLE upload_job ADD COLUMN patents_collapsed INTEGER NOT NULL DEFAULT 0;
+
+-- Family members that family deduplication left out of a bundle, with the
+-- member that represents them there.
+CREATE TABLE patent_family_suppression (
+    bundle_id         UUID        NOT NULL,
+    suppressed_id     UUID        NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    representative_id UUID        NOT NULL REFERENCES patent (id) ON DELETE CASCADE,
+    transaction_id    UUID        NOT NULL,
+    family            TEXT        NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (bundle_id, suppressed_id)
+);
+CREATE INDEX patent_family_suppression_representative_idx
+    ON patent_family_suppression (bundle_id, representative_id);
+CREATE INDEX patent_family_suppression_transaction_idx ON patent_family_suppression (transaction_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS patent_citation_key_idx;
+DROP TABLE IF EXISTS patent_npl_citation;
+DROP TABLE IF EXISTS patent_citation;
@@ -0,0 +1,23 @@
+-- The citation graph, keyed by publication number without kind code so that
+-- edges reach cited documents that are not stored as patents. An edge is the
+-- same whether the citing or the cited patent reported it.
+CREATE TABLE patent_citation (
+    citing_number TEXT        NOT NULL,
+    cited_number  TEXT        NOT NULL,
+    category      TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (citing_number, cited_number)
+);
+CREATE INDEX patent_citation_cited_idx ON patent_citation (cited_number);
+
+CREATE TABLE patent_npl_citation (
+    citing_number TEXT        NOT NULL,
+    position      INTEGER     NOT NULL,
+    text          TEXT        NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (citing_number, position)
+);
+
+-- resolves graph nodes to stored patents; must match citationKeyExpression
+CREATE INDEX patent_citation_key_idx
+    ON patent ((regexp_replace(publication_number, '([0-9])[A-Z][0-9]?$', '\1')));
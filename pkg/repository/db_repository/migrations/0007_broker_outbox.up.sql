@@ -0,0 +1,16 @@
+-- Broker messages committed together with the change they announce. The
+-- relay leases pending rows through locked_until, publishes them and stamps
+-- sent_at once the broker confirmed.
+CREATE TABLE broker_outbox (
+    id           UUID PRIMARY KEY,
+    message_key  TEXT        NOT NULL UNIQUE,
+    exchange     TEXT        NOT NULL DEFAULT '',
+    routing_key  TEXT        NOT NULL DEFAULT '',
+    payload      BYTEA       NOT NULL,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    locked_until TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at      TIMESTAMPTZ
+);
+CREATE INDEX broker_outbox_pending_idx ON broker_outbox (created_at) WHERE sent_at IS NULL;
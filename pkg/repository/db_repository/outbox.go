@@ -0,0 +1,118 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"sort"
+	"time"
+)
+
+// insertOutboxMessage queues a message, normally in the transaction of the
+// change it announces. A message with a key already queued is skipped.
+func insertOutboxMessage(ctx context.Context, db sqlx.ExecerContext, message model.OutboxMessage) error {
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO broker_outbox (id, message_key, exchange, routing_key, payload, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (message_key) DO NOTHING`,
+		message.Id, message.Key, message.Exchange, message.RoutingKey, message.Payload, message.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert outbox message: %w", err)
+	}
+	return nil
+}
+
+// QueueOutboxMessage queues a message that announces no change of its own.
+func (r *DBRepository) QueueOutboxMessage(ctx context.Context, message model.OutboxMessage) error {
+	return insertOutboxMessage(ctx, r.db, message)
+}
+
+// defaultOutboxLease is used when the config sets no lease.
+const defaultOutboxLease = 5 * time.Minute
+
+// RelayOutbox publishes up to limit pending outbox messages, oldest first,
+// and marks each one sent once publish returns. The messages are claimed by
+// leasing them for OutboxRelayLease in a statement of their own, so no lock
+// or transaction is held while the broker confirms; concurrent relays skip
+// leased messages until the lease runs out. The first failed publish ends the
+// round: its error is recorded on the message, the rest of the batch is
+// released, and the error is returned. Returns the number of messages sent.
+//
+// Delivery is at least once: a crash between publish and marking the message
+// sent, or a round outliving its lease, sends the message again, so consumers
+// deduplicate on the message id.
+func (r *DBRepository) RelayOutbox(
+	ctx context.Context,
+	limit int,
+	publish func(context.Context, model.OutboxMessage) error,
+) (int, error) {
+	lease := r.cfg.OutboxRelayLease
+	if lease <= 0 {
+		lease = defaultOutboxLease
+	}
+	var messages []model.OutboxMessage
+	err := r.db.SelectContext(ctx, &messages, `
+        UPDATE broker_outbox
+        SET locked_until = now() + $2 * interval '1 millisecond'
+        WHERE id IN (
+            SELECT id FROM broker_outbox
+            WHERE sent_at IS NULL AND (locked_until IS NULL OR locked_until < now())
+            ORDER BY created_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, message_key, exchange, routing_key, payload, attempts, created_at`,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("claim outbox messages: %w", err)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
+
+	// a message published before ctx was cancelled is still recorded
+	recordCtx := context.WithoutCancel(ctx)
+	for i, message := range messages {
+		if publishErr := publish(ctx, message); publishErr != nil {
+			_, err := r.db.ExecContext(recordCtx, `
+                UPDATE broker_outbox
+                SET attempts = attempts + 1, last_error = $2, locked_until = NULL
+                WHERE id = $1`,
+				message.Id, publishErr.Error())
+			if err != nil {
+				return i, fmt.Errorf("record outbox failure: %w", err)
+			}
+			if err := r.releaseOutboxMessages(recordCtx, messages[i+1:]); err != nil {
+				return i, err
+			}
+			return i, fmt.Errorf("publish outbox message: %w", publishErr)
+		}
+		_, err := r.db.ExecContext(recordCtx, `
+            UPDATE broker_outbox
+            SET sent_at = now(), attempts = attempts + 1, last_error = NULL, locked_until = NULL
+            WHERE id = $1`,
+			message.Id)
+		if err != nil {
+			return i, fmt.Errorf("mark outbox message sent: %w", err)
+		}
+	}
+	return len(messages), nil
+}
+
+// releaseOutboxMessages ends the lease of messages a round did not get to,
+// so the next round picks them up without waiting for it to run out.
+func (r *DBRepository) releaseOutboxMessages(ctx context.Context, messages []model.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.Id.String())
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE broker_outbox SET locked_until = NULL WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("release outbox messages: %w", err)
+	}
+	return nil
+}
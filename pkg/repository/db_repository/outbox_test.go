@@ -0,0 +1,110 @@
+package db_repository
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"testing"
+	"time"
+)
+
+// queueTestMessages queues count messages dated before anything else in the
+// outbox, so a relay round picks them first.
+func queueTestMessages(t *testing.T, db *sqlx.DB, count int) []model.OutboxMessage {
+	t.Helper()
+	messages := make([]model.OutboxMessage, 0, count)
+	keys := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		message := model.OutboxMessage{
+			Id:        uuid.New(),
+			Key:       "test:" + uuid.NewString(),
+			Payload:   []byte("{}"),
+			CreatedAt: time.Date(1970, 1, 1, 0, 0, i, 0, time.UTC),
+		}
+		if err := insertOutboxMessage(context.Background(), db, message); err != nil {
+			t.Fatalf("queue message: %s", err)
+		}
+		messages = append(messages, message)
+		keys = append(keys, message.Key)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM broker_outbox WHERE message_key = ANY($1)`, pq.Array(keys))
+	})
+	return messages
+}
+
+func TestRelayOutboxHoldsNoLockWhilePublishing(t *testing.T) {
+	db := testDB(t)
+	repo := NewDBRepository(db, testLog, &config.Config{DBWriteMode: config.DBWriteInsert, OutboxRelayLease: time.Minute})
+	messages := queueTestMessages(t, db, 2)
+
+	published := make(map[uuid.UUID]int)
+	var concurrentErr error
+	sent, err := repo.RelayOutbox(context.Background(), 2, func(ctx context.Context, message model.OutboxMessage) error {
+		published[message.Id]++
+		if message.Id != messages[0].Id {
+			return nil
+		}
+		// a second relay must neither wait for this one nor take its messages
+		concurrentCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		_, concurrentErr = repo.RelayOutbox(concurrentCtx, 2, func(ctx context.Context, message model.OutboxMessage) error {
+			published[message.Id]++
+			return nil
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RelayOutbox: %s", err)
+	}
+	if concurrentErr != nil {
+		t.Fatalf("concurrent RelayOutbox: %s", concurrentErr)
+	}
+	if sent != 2 {
+		t.Errorf("sent = %d, want 2", sent)
+	}
+	for _, message := range messages {
+		if published[message.Id] != 1 {
+			t.Errorf("message %s published %d times, want once", message.Key, published[message.Id])
+		}
+	}
+}
+
+func TestRelayOutboxReleasesBatchOnFailure(t *testing.T) {
+	db := testDB(t)
+	repo := NewDBRepository(db, testLog, &config.Config{DBWriteMode: config.DBWriteInsert, OutboxRelayLease: time.Minute})
+	messages := queueTestMessages(t, db, 2)
+
+	sent, err := repo.RelayOutbox(context.Background(), 2, func(ctx context.Context, message model.OutboxMessage) error {
+		return errors.New("broker down")
+	})
+	if err == nil || sent != 0 {
+		t.Fatalf("RelayOutbox = %d, %v, want 0 and an error", sent, err)
+	}
+
+	var rows []struct {
+		Id          uuid.UUID  `db:"id"`
+		Attempts    int        `db:"attempts"`
+		LockedUntil *time.Time `db:"locked_until"`
+	}
+	err = db.Select(&rows, `SELECT id, attempts, locked_until FROM broker_outbox WHERE id = ANY($1::uuid[]) ORDER BY created_at`,
+		pq.Array([]string{messages[0].Id.String(), messages[1].Id.String()}))
+	if err != nil {
+		t.Fatalf("read outbox: %s", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	for i, row := range rows {
+		if row.LockedUntil != nil {
+			t.Errorf("message %d still leased until %s", i, row.LockedUntil)
+		}
+	}
+	if rows[0].Attempts != 1 || rows[1].Attempts != 0 {
+		t.Errorf("attempts = %d, %d, want 1, 0", rows[0].Attempts, rows[1].Attempts)
+	}
+}
@@ -0,0 +1,114 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"strings"
+)
+
+// ListPatents returns stored patents matching the input, with their CPC
+// classifications.
+func (r *DBRepository) ListPatents(ctx context.Context, input model.PatentListInput) ([]model.StoredPatent, error) {
+	conditions := make([]string, 0, 2)
+	args := make([]interface{}, 0, 4)
+	if input.BundleId != nil {
+		args = append(args, *input.BundleId)
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM bundlepatentlink b WHERE b.patent_id = p.id AND b.bundle_id = $%d)", len(args)))
+	}
+	if len(input.CPC) > 0 {
+		alternatives := make([]string, 0, len(input.CPC))
+		for _, value := range input.CPC {
+			pattern, err := model.ParseCPCPattern(value)
+			if err != nil {
+				return nil, err
+			}
+			var condition string
+			condition, args = cpcCondition(pattern, "c", args)
+			alternatives = append(alternatives, condition)
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM patent_cpc c WHERE c.patent_id = p.id AND (%s))", strings.Join(alternatives, " OR ")))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, input.Limit, input.Offset)
+	query := fmt.Sprintf(`
+        SELECT p.id, p.publication_number, p.title, p.authority, p.publication_date, p.simple_legal_status
+        FROM patent p
+        %s
+        ORDER BY p.publication_number
+        LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args))
+
+	patents := make([]model.StoredPatent, 0, input.Limit)
+	if err := r.db.SelectContext(ctx, &patents, query, args...); err != nil {
+		return nil, fmt.Errorf("list patents: %w", err)
+	}
+	if len(patents) == 0 {
+		return patents, nil
+	}
+
+	ids := make([]string, 0, len(patents))
+	index := make(map[uuid.UUID]int, len(patents))
+	for i, patent := range patents {
+		ids = append(ids, patent.Id.String())
+		index[patent.Id] = i
+	}
+	var rows []struct {
+		PatentId uuid.UUID `db:"patent_id"`
+		model.CPCClassification
+	}
+	err := r.db.SelectContext(ctx, &rows, `
+        SELECT patent_id, symbol, COALESCE(section, '') AS section, COALESCE(class, '') AS class,
+               COALESCE(subclass, '') AS subclass, COALESCE(main_group, '') AS main_group,
+               COALESCE(subgroup, '') AS subgroup, inventive
+        FROM patent_cpc
+        WHERE patent_id = ANY($1::uuid[])
+        ORDER BY patent_id, position`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("list patent cpc: %w", err)
+	}
+	for _, row := range rows {
+		i := index[row.PatentId]
+		patents[i].CPC = append(patents[i].CPC, row.CPCClassification)
+	}
+	return patents, nil
+}
+
+// cpcCondition is the SQL form of CPCPattern.Match over the patent_cpc columns
+// of alias, appending its parameters to args.
+func cpcCondition(pattern model.CPCPattern, alias string, args []interface{}) (string, []interface{}) {
+	levels := []struct {
+		column string
+		value  string
+	}{
+		{"section", pattern.Section},
+		{"class", pattern.Class},
+		{"subclass", pattern.Subclass},
+		{"main_group", pattern.Group},
+	}
+	conditions := make([]string, 0, len(levels)+1)
+	for _, level := range levels {
+		if level.value == "" {
+			continue
+		}
+		args = append(args, level.value)
+		conditions = append(conditions, fmt.Sprintf("%s.%s = $%d", alias, level.column, len(args)))
+	}
+	if pattern.Subgroup != "" {
+		if pattern.Wildcard {
+			// subgroups are digits only, so the value needs no LIKE escaping
+			args = append(args, pattern.Subgroup+"%")
+			conditions = append(conditions, fmt.Sprintf("%s.subgroup LIKE $%d", alias, len(args)))
+		} else {
+			args = append(args, pattern.Subgroup)
+			conditions = append(conditions, fmt.Sprintf("%s.subgroup = $%d", alias, len(args)))
+		}
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", args
+}
@@ -0,0 +1,179 @@
+package db_repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
+	"strings"
+)
+
+const uploadJobColumns = `transaction_id, bundle_id, filters, state, total_patents, pages_fetched,
+    patents_parsed, patents_saved, patents_inserted, patents_updated, patents_unchanged, patents_collapsed,
+    error, created_at, updated_at, finished_at`
+
+// UploadJobRepository stores upload job progress in the upload_job table.
+type UploadJobRepository struct {
+	db  *sqlx.DB
+	log *slog.Logger
+}
+
+func NewUploadJobRepository(db *sqlx.DB, log *slog.Logger) *UploadJobRepository {
+	return &UploadJobRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+// CreateUploadJob records a new job in the pending state. A redelivered
+// payload for a known transaction reopens the existing job; its progress is
+// rewound to the last checkpoint, which is where the upload resumes.
+func (r *UploadJobRepository) CreateUploadJob(ctx context.Context, job model.UploadJob) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO upload_job (transaction_id, bundle_id, filters, state)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (transaction_id) DO UPDATE SET
+            bundle_id = EXCLUDED.bundle_id,
+            filters = EXCLUDED.filters,
+            state = EXCLUDED.state,
+            pages_fetched = (
+                SELECT count(*) FROM upload_job_checkpoint WHERE transaction_id = EXCLUDED.transaction_id
+            ),
+            patents_parsed = upload_job.patents_saved,
+            error = NULL,
+            updated_at = now(),
+            finished_at = NULL`,
+		job.TransactionId, job.BundleId, string(job.Filters), model.JobPending,
+	)
+	if err != nil {
+		return fmt.Errorf("create upload job: %w", err)
+	}
+	return nil
+}
+
+// StartUploadJob moves a job to running once the number of patents is known.
+func (r *UploadJobRepository) StartUploadJob(ctx context.Context, transactionId uuid.UUID, totalPatents int) error {
+	return r.updateUploadJob(ctx, transactionId, `state = $2, total_patents = $3`, model.JobRunning, totalPatents)
+}
+
+// AddUploadJobProgress adds to the fetched page and parsed patent counters.
+// Workers report their own pages, so the update is relative.
+func (r *UploadJobRepository) AddUploadJobProgress(ctx context.Context, transactionId uuid.UUID, pages, parsed int) error {
+	return r.updateUploadJob(ctx, transactionId,
+		`pages_fetched = pages_fetched + $2, patents_parsed = patents_parsed + $3`, pages, parsed)
+}
+
+// FinishUploadJob records the final state of a job. errMessage is stored
+// only for failed jobs.
+func (r *UploadJobRepository) FinishUploadJob(
+	ctx context.Context,
+	transactionId uuid.UUID,
+	state model.UploadJobState,
+	errMessage string,
+) error {
+	var jobErr *string
+	if errMessage != "" {
+		jobErr = &errMessage
+	}
+	return r.updateUploadJob(ctx, transactionId, `state = $2, error = $3, finished_at = now()`, state, jobErr)
+}
+
+// CompleteUploadJob marks a job completed and queues its result messages in
+// the same transaction, so they are published exactly when the job is
+// recorded as done.
+func (r *UploadJobRepository) CompleteUploadJob(
+	ctx context.Context,
+	transactionId uuid.UUID,
+	messages ...model.OutboxMessage,
+) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updated, err := tx.ExecContext(ctx, `
+        UPDATE upload_job SET state = $2, error = NULL, finished_at = now(), updated_at = now()
+        WHERE transaction_id = $1`, transactionId, model.JobCompleted)
+	if err != nil {
+		return fmt.Errorf("complete upload job: %w", err)
+	}
+	if rows, err := updated.RowsAffected(); err == nil && rows == 0 {
+		return model.ErrJobNotFound
+	}
+	for _, message := range messages {
+		if err := insertOutboxMessage(ctx, tx, message); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit upload job: %w", err)
+	}
+	return nil
+}
+
+// ListUploadJobCheckpoints returns the offsets of the pages already saved for a job.
+func (r *UploadJobRepository) ListUploadJobCheckpoints(ctx context.Context, transactionId uuid.UUID) ([]int, error) {
+	offsets := make([]int, 0)
+	err := r.db.SelectContext(ctx, &offsets,
+		`SELECT page_offset FROM upload_job_checkpoint WHERE transaction_id = $1 ORDER BY page_offset`, transactionId)
+	if err != nil {
+		return nil, fmt.Errorf("list upload job checkpoints: %w", err)
+	}
+	return offsets, nil
+}
+
+func (r *UploadJobRepository) updateUploadJob(ctx context.Context, transactionId uuid.UUID, set string, args ...interface{}) error {
+	query := fmt.Sprintf(`UPDATE upload_job SET %s, updated_at = now() WHERE transaction_id = $1`, set)
+	result, err := r.db.ExecContext(ctx, query, append([]interface{}{transactionId}, args...)...)
+	if err != nil {
+		return fmt.Errorf("update upload job: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return model.ErrJobNotFound
+	}
+	return nil
+}
+
+func (r *UploadJobRepository) GetUploadJob(ctx context.Context, transactionId uuid.UUID) (*model.UploadJob, error) {
+	var job model.UploadJob
+	err := r.db.GetContext(ctx, &job,
+		fmt.Sprintf(`SELECT %s FROM upload_job WHERE transaction_id = $1`, uploadJobColumns), transactionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, model.ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get upload job: %w", err)
+	}
+	return &job, nil
+}
+
+func (r *UploadJobRepository) ListUploadJobs(ctx context.Context, input model.UploadJobListInput) ([]model.UploadJob, error) {
+	conditions := make([]string, 0, 2)
+	args := make([]interface{}, 0, 4)
+	if input.BundleId != nil {
+		args = append(args, *input.BundleId)
+		conditions = append(conditions, fmt.Sprintf("bundle_id = $%d", len(args)))
+	}
+	if input.State != nil {
+		args = append(args, *input.State)
+		conditions = append(conditions, fmt.Sprintf("state = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, input.Limit, input.Offset)
+	query := fmt.Sprintf(`SELECT %s FROM upload_job %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d`,
+		uploadJobColumns, where, len(args)-1, len(args))
+
+	jobs := make([]model.UploadJob, 0, input.Limit)
+	if err := r.db.SelectContext(ctx, &jobs, query, args...); err != nil {
+		return nil, fmt.Errorf("list upload jobs: %w", err)
+	}
+	return jobs, nil
+}
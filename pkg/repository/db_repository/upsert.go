@@ -0,0 +1,222 @@
+package db_repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"sort"
+	"strings"
+	"time"
+)
+
+type storedPatent struct {
+	Id                  uuid.UUID      `db:"id"`
+	PublicationNumber   string         `db:"publication_number"`
+	SimpleLegalStatus   sql.NullString `db:"simple_legal_status"`
+	EstimatedExpiryDate *time.Time     `db:"estimated_expiry_date"`
+	Assignees           pq.StringArray `db:"assignees"`
+	HasDetails          bool           `db:"has_details"`
+}
+
+// resolvedPatents splits a batch by what has to be written for each patent.
+// all holds every distinct patent of the batch with its final id.
+type resolvedPatents struct {
+	inserted []model.FilteredFullPatent
+	updated  []model.FilteredFullPatent
+	all      []model.FilteredFullPatent
+	stats    model.SaveStats
+}
+
+// resolvePatents looks the batch up by publication number and gives known
+// patents their stored id. A publication number repeated within the batch is
+// saved once and counted as unchanged for every repeat.
+func (r *DBRepository) resolvePatents(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) (resolvedPatents, error) {
+	numbers := make([]string, 0, len(patents))
+	for _, p := range patents {
+		numbers = append(numbers, p.Patent.PublicationNumber)
+	}
+	rows := make([]storedPatent, 0, len(patents))
+	err := tx.SelectContext(ctx, &rows, `
+        SELECT p.id, p.publication_number, p.simple_legal_status, p.estimated_expiry_date,
+               p.file_url IS NOT NULL AS has_details,
+               COALESCE(
+                   array_agg(l.standardized_current_assignee_name)
+                       FILTER (WHERE l.standardized_current_assignee_name IS NOT NULL),
+                   '{}'
+               ) AS assignees
+        FROM patent p
+        LEFT JOIN patentstandardizedcurrentassigneelink l ON l.patent_id = p.id
+        WHERE p.publication_number = ANY($1)
+        GROUP BY p.id, p.publication_number, p.simple_legal_status, p.estimated_expiry_date, p.file_url
+        ORDER BY p.id`, pq.Array(numbers))
+	if err != nil {
+		return resolvedPatents{}, err
+	}
+	stored := make(map[string]storedPatent, len(rows))
+	for _, row := range rows {
+		if _, exists := stored[row.PublicationNumber]; !exists {
+			stored[row.PublicationNumber] = row
+		}
+	}
+
+	resolved := resolvedPatents{all: make([]model.FilteredFullPatent, 0, len(patents))}
+	seen := make(map[string]struct{}, len(patents))
+	for _, p := range patents {
+		number := p.Patent.PublicationNumber
+		if _, exists := seen[number]; exists {
+			resolved.stats.Unchanged++
+			continue
+		}
+		seen[number] = struct{}{}
+
+		existing, exists := stored[number]
+		switch {
+		case !exists:
+			resolved.inserted = append(resolved.inserted, p)
+			resolved.stats.Inserted++
+		case existing.changed(p):
+			p.ID = existing.Id
+			resolved.updated = append(resolved.updated, p)
+			resolved.stats.Updated++
+		default:
+			p.ID = existing.Id
+			resolved.stats.Unchanged++
+		}
+		resolved.all = append(resolved.all, p)
+	}
+	return resolved, nil
+}
+
+// patentUpsertConflict completes the INSERT of new patents. resolvePatents
+// does not lock anything, so a concurrent upload may insert the same patent
+// first; the conflicting row is then refreshed like a changed patent and
+// returned with its id. xmax is 0 only for rows the statement inserted.
+const patentUpsertConflict = `
+        ON CONFLICT (publication_number) DO UPDATE SET
+            simple_legal_status = EXCLUDED.simple_legal_status,
+            estimated_expiry_date = EXCLUDED.estimated_expiry_date
+        RETURNING id, publication_number, (xmax = 0) AS inserted`
+
+type upsertedPatent struct {
+	Id                uuid.UUID `db:"id"`
+	PublicationNumber string    `db:"publication_number"`
+	Inserted          bool      `db:"inserted"`
+}
+
+// reconcile applies the outcome of the patent upsert to the batch. Patents
+// that turned out to exist already take the stored id and move from inserted
+// to updated, so their relations are refreshed instead of inserted again.
+func (r *resolvedPatents) reconcile(rows []upsertedPatent) error {
+	upserted := make(map[string]upsertedPatent, len(rows))
+	for _, row := range rows {
+		upserted[row.PublicationNumber] = row
+	}
+	inserted := make([]model.FilteredFullPatent, 0, len(r.inserted))
+	ids := make(map[uuid.UUID]uuid.UUID)
+	for _, p := range r.inserted {
+		row, ok := upserted[p.Patent.PublicationNumber]
+		if !ok {
+			return fmt.Errorf("patent %s missing from upsert result", p.Patent.PublicationNumber)
+		}
+		if row.Inserted {
+			inserted = append(inserted, p)
+			continue
+		}
+		ids[p.ID] = row.Id
+		p.ID = row.Id
+		r.updated = append(r.updated, p)
+		r.stats.Inserted--
+		r.stats.Updated++
+	}
+	r.inserted = inserted
+	for i := range r.all {
+		if id, ok := ids[r.all[i].ID]; ok {
+			r.all[i].ID = id
+		}
+	}
+	return nil
+}
+
+func (s storedPatent) changed(p model.FilteredFullPatent) bool {
+	// rows saved before details were stored are filled in on the next upload
+	if p.Details != nil && !s.HasDetails {
+		return true
+	}
+	status := ""
+	if p.Patent.SimpleLegalStatus != nil {
+		status = *p.Patent.SimpleLegalStatus
+	}
+	if s.SimpleLegalStatus.String != status {
+		return true
+	}
+	if !sameDate(s.EstimatedExpiryDate, p.Patent.EstimatedExpiryDate) {
+		return true
+	}
+	return !sameSet(s.Assignees, p.Patent.Assignee)
+}
+
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.UTC().Format(time.DateOnly) == b.UTC().Format(time.DateOnly)
+}
+
+func sameSet(a, b []string) bool {
+	a = uniqueSorted(a)
+	b = uniqueSorted(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueSorted(values []string) []string {
+	result := make([]string, 0, len(values))
+	seen := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		if _, exists := seen[value]; !exists {
+			seen[value] = struct{}{}
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (r *DBRepository) updatePatentsBulk(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
+	placeholders := make([]string, 0, len(patents))
+	args := make([]interface{}, 0, len(patents)*3)
+	for i, p := range patents {
+		idx := i*3 + 1
+		placeholders = append(placeholders, fmt.Sprintf("($%d::uuid, $%d::text, $%d::timestamptz)", idx, idx+1, idx+2))
+		args = append(args, p.ID, p.Patent.SimpleLegalStatus, p.Patent.EstimatedExpiryDate)
+	}
+	query := fmt.Sprintf(`
+        UPDATE patent AS p
+        SET simple_legal_status = v.simple_legal_status,
+            estimated_expiry_date = v.estimated_expiry_date
+        FROM (VALUES %s) AS v (id, simple_legal_status, estimated_expiry_date)
+        WHERE p.id = v.id`, strings.Join(placeholders, ","))
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *DBRepository) deleteAssigneePatentLinks(ctx context.Context, patents []model.FilteredFullPatent, tx *sqlx.Tx) error {
+	ids := make([]string, 0, len(patents))
+	for _, p := range patents {
+		ids = append(ids, p.ID.String())
+	}
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM patentstandardizedcurrentassigneelink WHERE patent_id = ANY($1::uuid[])`, pq.Array(ids))
+	return err
+}
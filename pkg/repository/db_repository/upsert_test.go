@@ -0,0 +1,88 @@
+package db_repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"sync"
+	"testing"
+)
+
+func TestReconcileMovesConflictsToUpdated(t *testing.T) {
+	patents := testPatents("RC", 3)
+	resolved := resolvedPatents{
+		inserted: patents,
+		all:      append([]model.FilteredFullPatent(nil), patents...),
+		stats:    model.SaveStats{Inserted: 3},
+	}
+	storedId := uuid.New()
+	err := resolved.reconcile([]upsertedPatent{
+		{Id: patents[0].ID, PublicationNumber: patents[0].Patent.PublicationNumber, Inserted: true},
+		{Id: storedId, PublicationNumber: patents[1].Patent.PublicationNumber, Inserted: false},
+		{Id: patents[2].ID, PublicationNumber: patents[2].Patent.PublicationNumber, Inserted: true},
+	})
+	if err != nil {
+		t.Fatalf("reconcile: %s", err)
+	}
+	if len(resolved.inserted) != 2 || len(resolved.updated) != 1 {
+		t.Fatalf("got %d inserted and %d updated, want 2 and 1", len(resolved.inserted), len(resolved.updated))
+	}
+	if resolved.updated[0].ID != storedId || resolved.all[1].ID != storedId {
+		t.Errorf("conflicting patent kept its generated id")
+	}
+	if want := (model.SaveStats{Inserted: 2, Updated: 1}); resolved.stats != want {
+		t.Errorf("stats = %+v, want %+v", resolved.stats, want)
+	}
+
+	if err := resolved.reconcile(nil); err == nil {
+		t.Errorf("reconcile accepted an upsert result without the batch's patents")
+	}
+}
+
+// Uploads that share patents run concurrently since the consumer got a worker
+// pool; the one that inserts a patent second must update it instead of failing.
+func TestConcurrentSavesOfSamePatents(t *testing.T) {
+	db := testDB(t)
+	patents := testPatents("CS", 20)
+	for _, mode := range []string{config.DBWriteInsert, config.DBWriteCopy} {
+		t.Run(mode, func(t *testing.T) {
+			repo := NewDBRepository(db, testLog, &config.Config{DBWriteMode: mode})
+			transactions := []uuid.UUID{uuid.New(), uuid.New()}
+			t.Cleanup(func() {
+				if err := cleanUpTransactions(db, transactions); err != nil {
+					t.Errorf("failed to clean up: %s", err)
+				}
+			})
+
+			var wg sync.WaitGroup
+			results := make([]model.SaveStats, len(transactions))
+			errs := make([]error, len(transactions))
+			for i, transactionId := range transactions {
+				wg.Add(1)
+				go func(i int, transactionId uuid.UUID) {
+					defer wg.Done()
+					// each upload generates its own ids, as the providers do
+					own := make([]model.FilteredFullPatent, len(patents))
+					copy(own, patents)
+					for j := range own {
+						own[j].ID = uuid.New()
+					}
+					results[i], errs[i] = repo.SavePatents(context.Background(), own, transactionId, uuid.New())
+				}(i, transactionId)
+			}
+			wg.Wait()
+
+			var total model.SaveStats
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("save %d failed: %s", i, err)
+				}
+				total.Add(results[i])
+			}
+			if total.Inserted != len(patents) || total.Inserted+total.Updated+total.Unchanged != 2*len(patents) {
+				t.Errorf("stats = %+v, want %d inserted of %d saves", total, len(patents), 2*len(patents))
+			}
+		})
+	}
+}
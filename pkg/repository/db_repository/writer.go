@@ -0,0 +1,116 @@
+package db_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+)
+
+// PatentWriter saves the batches of one upload. Unless it was opened as
+// atomic, every Write is committed on its own and Commit and Rollback only
+// release the writer.
+type PatentWriter interface {
+	Write(ctx context.Context, batch model.PatentBatch) (model.SaveStats, error)
+	Commit() error
+	Rollback() error
+}
+
+// patentWriter saves upload batches together with their page checkpoints,
+// either one transaction per batch or, when atomic, in a single transaction
+// that is only committed once the whole upload is written.
+//
+// An atomic writer adds to the job's counters only when it commits: updating
+// them per batch would lock the job row for the whole upload while the
+// upload's workers wait on it to record their progress.
+type patentWriter struct {
+	repo *DBRepository
+	tx   *sqlx.Tx
+	// pending holds the counters of an atomic upload until Commit
+	transactionId uuid.UUID
+	saved         int
+	stats         model.SaveStats
+}
+
+func (r *DBRepository) NewPatentWriter(ctx context.Context, atomic bool) (PatentWriter, error) {
+	writer := &patentWriter{repo: r}
+	if atomic {
+		tx, err := r.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		writer.tx = tx
+	}
+	return writer, nil
+}
+
+func (w *patentWriter) Write(ctx context.Context, batch model.PatentBatch) (model.SaveStats, error) {
+	if w.tx != nil {
+		stats, err := w.writeTx(ctx, batch, w.tx)
+		if err != nil {
+			return stats, err
+		}
+		w.transactionId = batch.TransactionId
+		w.saved += len(batch.Patents)
+		w.stats.Add(stats)
+		return stats, nil
+	}
+
+	tx, err := w.repo.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.SaveStats{}, err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	stats, err := w.writeTx(ctx, batch, tx)
+	if err == nil {
+		err = w.repo.addJobCounters(ctx, batch.TransactionId, len(batch.Patents), stats, tx)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return stats, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.SaveStats{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return stats, nil
+}
+
+func (w *patentWriter) writeTx(ctx context.Context, batch model.PatentBatch, tx *sqlx.Tx) (model.SaveStats, error) {
+	stats, err := w.repo.savePatentsTx(ctx, batch.Patents, batch.TransactionId, batch.BundleId, tx)
+	if err != nil {
+		return stats, err
+	}
+	if err := w.repo.insertCheckpoints(ctx, batch, tx); err != nil {
+		return stats, fmt.Errorf("insert checkpoints failed: %w", err)
+	}
+	return stats, nil
+}
+
+func (w *patentWriter) Commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	// the upload's workers are done by now, nothing waits on the job row
+	err := w.repo.addJobCounters(context.Background(), w.transactionId, w.saved, w.stats, w.tx)
+	if err != nil {
+		_ = w.tx.Rollback()
+		return fmt.Errorf("update job counters failed: %w", err)
+	}
+	if err := w.tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	return nil
+}
+
+func (w *patentWriter) Rollback() error {
+	if w.tx == nil {
+		return nil
+	}
+	return w.tx.Rollback()
+}
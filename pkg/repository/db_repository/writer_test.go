@@ -0,0 +1,81 @@
+package db_repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"testing"
+	"time"
+)
+
+// An atomic upload keeps its transaction open across batches while the
+// upload's workers record their progress on other connections; those updates
+// must not wait for the upload to commit.
+func TestAtomicWriterProgressDuringUpload(t *testing.T) {
+	db := testDB(t)
+	repo := NewDBRepository(db, testLog, &config.Config{DBWriteMode: config.DBWriteInsert})
+	jobs := NewUploadJobRepository(db, testLog)
+	ctx := context.Background()
+
+	transactionId, bundleId := uuid.New(), uuid.New()
+	t.Cleanup(func() {
+		if err := cleanUpTransactions(db, []uuid.UUID{transactionId}); err != nil {
+			t.Errorf("failed to clean up: %s", err)
+		}
+	})
+	err := jobs.CreateUploadJob(ctx, model.UploadJob{
+		TransactionId: transactionId,
+		BundleId:      bundleId,
+		Filters:       json.RawMessage(`[]`),
+	})
+	if err != nil {
+		t.Fatalf("create job: %s", err)
+	}
+
+	writer, err := repo.NewPatentWriter(ctx, true)
+	if err != nil {
+		t.Fatalf("open writer: %s", err)
+	}
+	defer writer.Rollback()
+
+	patents := testPatents("AT", 6)
+	batches := []model.PatentBatch{
+		{TransactionId: transactionId, BundleId: bundleId, Patents: patents[:3], PageOffsets: []int{0}},
+		{TransactionId: transactionId, BundleId: bundleId, Patents: patents[3:], PageOffsets: []int{20}},
+	}
+	for i, batch := range batches {
+		if _, err := writer.Write(ctx, batch); err != nil {
+			t.Fatalf("write batch %d: %s", i, err)
+		}
+		progressCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := jobs.AddUploadJobProgress(progressCtx, transactionId, 1, len(batch.Patents))
+		cancel()
+		if err != nil {
+			t.Fatalf("progress after batch %d blocked by the upload transaction: %s", i, err)
+		}
+	}
+	if err := writer.Commit(); err != nil {
+		t.Fatalf("commit: %s", err)
+	}
+
+	job, err := jobs.GetUploadJob(ctx, transactionId)
+	if err != nil {
+		t.Fatalf("get job: %s", err)
+	}
+	if job.PatentsSaved != len(patents) || job.Inserted != len(patents) {
+		t.Errorf("saved %d, inserted %d, want %d", job.PatentsSaved, job.Inserted, len(patents))
+	}
+	if job.PagesFetched != len(batches) || job.PatentsParsed != len(patents) {
+		t.Errorf("pages fetched %d, parsed %d, want %d and %d",
+			job.PagesFetched, job.PatentsParsed, len(batches), len(patents))
+	}
+	checkpoints, err := jobs.ListUploadJobCheckpoints(ctx, transactionId)
+	if err != nil {
+		t.Fatalf("list checkpoints: %s", err)
+	}
+	if len(checkpoints) != len(batches) {
+		t.Errorf("got %d checkpoints, want %d", len(checkpoints), len(batches))
+	}
+}
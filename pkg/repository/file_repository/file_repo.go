@@ -0,0 +1,241 @@
+package file_repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/patent_match"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileRepository serves patents from a directory of USPTO/EPO XML files and
+// JSONL archive exports. The directory is read once, on first use, and kept
+// in memory; filters and statistics are evaluated locally with the same
+// semantics as the KTMine search.
+type FileRepository struct {
+	log     *slog.Logger
+	dir     string
+	once    sync.Once
+	patents []localPatent
+	loadErr error
+}
+
+func NewFileRepository(log *slog.Logger, dir string) *FileRepository {
+	return &FileRepository{
+		log: log,
+		dir: dir,
+	}
+}
+
+type localClaim struct {
+	Number    int
+	Text      string
+	DependsOn int
+}
+
+type localPatent struct {
+	PublicationNumber    string
+	Country              string
+	Kind                 string
+	Title                string
+	Abstract             string
+	Description          string
+	ApplicationNumber    string
+	ApplicationDate      time.Time
+	PublicationDate      time.Time
+	EarliestPriorityDate time.Time
+	EstimatedExpiryDate  time.Time
+	LegalStatus          string
+	Assignees            []string
+	CurrentOwners        []string
+	Inventors            []string
+	CPC                  []string
+	Jurisdictions        []string
+	Claims               []localClaim
+	// document is the patent as seen by the filters, built once at load.
+	document *patent_match.Patent
+}
+
+func (r *FileRepository) SearchPatents(ctx context.Context, query model.PatentQuery) ([]model.FilteredFullPatent, error) {
+	patents, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]model.FilteredFullPatent, 0, query.Limit)
+	skipped := 0
+	for i := range patents {
+		if len(matched) >= query.Limit {
+			break
+		}
+		if i%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !patent_match.MatchFilters(patents[i].document, query.Filters) {
+			continue
+		}
+		if skipped < query.Offset {
+			skipped++
+			continue
+		}
+		matched = append(matched, patents[i].toModel(query.Full))
+	}
+	return matched, nil
+}
+
+func (r *FileRepository) GetStatistics(ctx context.Context, filters []model.SingleParsedFilter) (*model.PatentStatistics, error) {
+	patents, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*patent_match.Patent, 0)
+	for i := range patents {
+		if i%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if patent_match.MatchFilters(patents[i].document, filters) {
+			matched = append(matched, patents[i].document)
+		}
+	}
+	return &model.PatentStatistics{
+		Aggregations: patent_match.Aggregate(matched, model.AdvancedAggs),
+		TotalFound:   len(matched),
+	}, nil
+}
+
+// Status reports the provider as always available; there is no remote backend to trip over.
+func (r *FileRepository) Status() model.CircuitBreakerStatus {
+	return model.CircuitBreakerStatus{State: "closed"}
+}
+
+// SearchRequest describes a local search in the KTMine request format. There
+// is no key and no return field selection, every field is always returned.
+func (r *FileRepository) SearchRequest(query model.PatentQuery) model.FiltersRequestBody {
+	return model.NewFilterRequestBody(query.Filters, "", query.Offset, query.Limit, query.PreFilter, nil)
+}
+
+func (r *FileRepository) load() ([]localPatent, error) {
+	r.once.Do(func() {
+		op := "repository.FileRepository.load"
+		log := r.log.With(slog.String("op", op), slog.String("dir", r.dir))
+
+		entries, err := os.ReadDir(r.dir)
+		if err != nil {
+			r.loadErr = fmt.Errorf("read patent directory: %w", err)
+			return
+		}
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+
+		seen := make(map[string]struct{})
+		for _, name := range names {
+			path := filepath.Join(r.dir, name)
+			var parsed []localPatent
+			switch strings.ToLower(filepath.Ext(name)) {
+			case ".xml":
+				parsed, err = readXMLFile(path)
+			case ".jsonl", ".ndjson":
+				parsed, err = readJSONLFile(path)
+			default:
+				continue
+			}
+			if err != nil {
+				r.loadErr = fmt.Errorf("read %s: %w", name, err)
+				return
+			}
+			for _, patent := range parsed {
+				if _, exists := seen[patent.PublicationNumber]; exists || patent.PublicationNumber == "" {
+					continue
+				}
+				seen[patent.PublicationNumber] = struct{}{}
+				patent.document = patent.matchDocument()
+				r.patents = append(r.patents, patent)
+			}
+		}
+		log.Info("loaded local patents", slog.Int("count", len(r.patents)), slog.Int("files", len(names)))
+	})
+	return r.patents, r.loadErr
+}
+
+// cpcClassifications treats the first symbol as the inventive one; local
+// files do not mark inventive and additional classifications.
+func (p *localPatent) cpcClassifications() []model.CPCClassification {
+	classifications := make([]model.CPCClassification, 0, len(p.CPC))
+	for i, symbol := range p.CPC {
+		classifications = append(classifications, model.NewCPCClassification(symbol, i == 0))
+	}
+	return classifications
+}
+
+// details fills the fields a local file carries; family, citation and file
+// data do not exist locally and stay empty.
+func (p *localPatent) details(id uuid.UUID, claims []model.Claim) *model.ParsedPatent {
+	details := &model.ParsedPatent{
+		Id:                   id,
+		Title:                p.Title,
+		Abstract:             p.Abstract,
+		CPC:                  strings.Join(p.CPC, " | "),
+		CPCClassifications:   p.cpcClassifications(),
+		EarliestPriorityDate: p.EarliestPriorityDate,
+		EstimatedExpiryDate:  p.EstimatedExpiryDate,
+		PublicationNumber:    p.PublicationNumber,
+		Description:          p.Description,
+		SimpleLegalStatus:    p.LegalStatus,
+		Authority:            p.Country,
+		ApplicationDate:      p.ApplicationDate,
+		ApplicationNumber:    p.ApplicationNumber,
+		IssueDate:            p.PublicationDate,
+		PublicationDate:      p.PublicationDate,
+	}
+	details.SetClaimCounts(claims)
+	return details
+}
+
+func (p *localPatent) toModel(full bool) model.FilteredFullPatent {
+	legalStatus := p.LegalStatus
+	assignees := p.CurrentOwners
+	if len(assignees) == 0 {
+		assignees = p.Assignees
+	}
+	result := model.FilteredFullPatent{
+		Patent: model.FilteredPatent{
+			Title:                    p.Title,
+			PublicationNumber:        p.PublicationNumber,
+			EarliestPriorityDate:     datePointer(p.EarliestPriorityDate),
+			EstimatedExpiryDate:      datePointer(p.EstimatedExpiryDate),
+			InventorsNames:           p.Inventors,
+			Assignee:                 assignees,
+			SimpleFamilyJurisdiction: p.Jurisdictions,
+			ApplicationDate:          datePointer(p.ApplicationDate),
+			SimpleLegalStatus:        &legalStatus,
+		},
+	}
+	if full {
+		result.ID = uuid.New()
+		result.Description = p.Description
+		result.Abstract = p.Abstract
+		result.Claims = buildClaims(p.Claims, result.ID)
+		result.Details = p.details(result.ID, result.Claims)
+	}
+	return result
+}
+
+// datePointer leaves dates a file does not carry unset instead of pointing
+// at the zero time.
+func datePointer(value time.Time) *time.Time {
+	if value.IsZero() {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,22 @@
+package file_repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToModelLeavesMissingDatesNil(t *testing.T) {
+	filed := time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)
+	p := localPatent{PublicationNumber: "US10000000B2", ApplicationDate: filed}
+
+	patent := p.toModel(false).Patent
+	if patent.ApplicationDate == nil || !patent.ApplicationDate.Equal(filed) {
+		t.Errorf("ApplicationDate = %v, want %v", patent.ApplicationDate, filed)
+	}
+	if patent.EarliestPriorityDate != nil {
+		t.Errorf("EarliestPriorityDate = %v, want nil", patent.EarliestPriorityDate)
+	}
+	if patent.EstimatedExpiryDate != nil {
+		t.Errorf("EstimatedExpiryDate = %v, want nil", patent.EstimatedExpiryDate)
+	}
+}
@@ -0,0 +1,105 @@
+package file_repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// jsonlPatent is one line of an archive export. Dates are YYYY-MM-DD.
+type jsonlPatent struct {
+	PublicationNumber    string   `json:"publication_number"`
+	Country              string   `json:"country"`
+	Kind                 string   `json:"kind"`
+	Title                string   `json:"title"`
+	Abstract             string   `json:"abstract"`
+	Description          string   `json:"description"`
+	ApplicationNumber    string   `json:"application_number"`
+	ApplicationDate      string   `json:"application_date"`
+	PublicationDate      string   `json:"publication_date"`
+	EarliestPriorityDate string   `json:"earliest_priority_date"`
+	EstimatedExpiryDate  string   `json:"estimated_expiry_date"`
+	LegalStatus          string   `json:"legal_status"`
+	Assignees            []string `json:"assignees"`
+	CurrentOwners        []string `json:"current_owners"`
+	Inventors            []string `json:"inventors"`
+	CPC                  []string `json:"cpc"`
+	Jurisdictions        []string `json:"simple_family_jurisdictions"`
+	Claims               []struct {
+		Number    int    `json:"number"`
+		Text      string `json:"text"`
+		DependsOn int    `json:"depends_on"`
+	} `json:"claims"`
+}
+
+func readJSONLFile(path string) ([]localPatent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	patents := make([]localPatent, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record jsonlPatent
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		patents = append(patents, record.toLocal())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patents, nil
+}
+
+func (j jsonlPatent) toLocal() localPatent {
+	patent := localPatent{
+		PublicationNumber:    j.PublicationNumber,
+		Country:              j.Country,
+		Kind:                 j.Kind,
+		Title:                j.Title,
+		Abstract:             j.Abstract,
+		Description:          j.Description,
+		ApplicationNumber:    j.ApplicationNumber,
+		ApplicationDate:      parseDate("2006-01-02", j.ApplicationDate),
+		PublicationDate:      parseDate("2006-01-02", j.PublicationDate),
+		EarliestPriorityDate: parseDate("2006-01-02", j.EarliestPriorityDate),
+		EstimatedExpiryDate:  parseDate("2006-01-02", j.EstimatedExpiryDate),
+		LegalStatus:          j.LegalStatus,
+		Assignees:            j.Assignees,
+		CurrentOwners:        j.CurrentOwners,
+		Inventors:            j.Inventors,
+		CPC:                  j.CPC,
+		Jurisdictions:        j.Jurisdictions,
+	}
+	if patent.Country == "" && len(patent.PublicationNumber) >= 2 {
+		patent.Country = patent.PublicationNumber[:2]
+	}
+	if patent.EarliestPriorityDate.IsZero() {
+		patent.EarliestPriorityDate = patent.ApplicationDate
+	}
+	for _, claim := range j.Claims {
+		patent.Claims = append(patent.Claims, localClaim{Number: claim.Number, Text: claim.Text, DependsOn: claim.DependsOn})
+	}
+	return patent
+}
+
+func parseDate(layout, value string) time.Time {
+	parsed, err := time.Parse(layout, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
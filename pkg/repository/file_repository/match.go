@@ -0,0 +1,62 @@
+package file_repository
+
+import (
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/patent_match"
+)
+
+// matchDocument describes the patent for the shared filter matcher.
+func (p *localPatent) matchDocument() *patent_match.Patent {
+	claims := make([]string, 0, len(p.Claims))
+	for _, claim := range p.Claims {
+		claims = append(claims, claim.Text)
+	}
+	return &patent_match.Patent{
+		PublicationNumber:    p.PublicationNumber,
+		Country:              p.Country,
+		LegalStatus:          p.LegalStatus,
+		Title:                p.Title,
+		Abstract:             []string{p.Abstract},
+		Claims:               claims,
+		Descriptions:         []string{p.Description},
+		Assignees:            p.Assignees,
+		CurrentOwners:        p.CurrentOwners,
+		Inventors:            p.Inventors,
+		CPC:                  p.CPC,
+		ApplicationDate:      p.ApplicationDate,
+		PublicationDate:      p.PublicationDate,
+		EarliestPriorityDate: p.EarliestPriorityDate,
+		EstimatedExpiryDate:  p.EstimatedExpiryDate,
+	}
+}
+
+// buildClaims groups dependent claims under the independent claim they
+// ultimately refer to, keeping document order.
+func buildClaims(claims []localClaim, patentId uuid.UUID) []model.Claim {
+	roots := make(map[int]int)
+	result := make([]model.Claim, 0)
+	index := make(map[int]int)
+	for _, claim := range claims {
+		root := claim.Number
+		if claim.DependsOn != 0 {
+			if parentRoot, ok := roots[claim.DependsOn]; ok {
+				root = parentRoot
+			}
+		}
+		roots[claim.Number] = root
+		if root == claim.Number {
+			index[claim.Number] = len(result)
+			result = append(result, model.Claim{
+				PatentID:         patentId,
+				ClaimNumber:      claim.Number,
+				IndependentClaim: claim.Text,
+				DependantClaims:  make([]string, 0),
+			})
+			continue
+		}
+		i := index[root]
+		result[i].DependantClaims = append(result[i].DependantClaims, claim.Text)
+	}
+	return result
+}
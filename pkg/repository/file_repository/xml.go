@@ -0,0 +1,345 @@
+package file_repository
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	xmlDeclaration      = []byte("<?xml")
+	claimTextReference  = regexp.MustCompile(`(?i)\bclaims? (\d+)`)
+	whitespaceSequences = regexp.MustCompile(`\s+`)
+)
+
+type innerText struct {
+	Lang  string `xml:"lang,attr"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t innerText) String() string {
+	text := utils.RemoveHTMLTags(t.Inner)
+	text = html.UnescapeString(text)
+	return strings.TrimSpace(whitespaceSequences.ReplaceAllString(text, " "))
+}
+
+type usDocumentID struct {
+	Country   string `xml:"country"`
+	DocNumber string `xml:"doc-number"`
+	Kind      string `xml:"kind"`
+	Date      string `xml:"date"`
+}
+
+type usParty struct {
+	OrgName   string `xml:"addressbook>orgname"`
+	FirstName string `xml:"addressbook>first-name"`
+	LastName  string `xml:"addressbook>last-name"`
+}
+
+func (p usParty) name() string {
+	if p.OrgName != "" {
+		return p.OrgName
+	}
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
+
+type usClassificationCPC struct {
+	Section   string `xml:"section"`
+	Class     string `xml:"class"`
+	Subclass  string `xml:"subclass"`
+	MainGroup string `xml:"main-group"`
+	Subgroup  string `xml:"subgroup"`
+}
+
+type usBibliographicData struct {
+	Publication    usDocumentID `xml:"publication-reference>document-id"`
+	Application    usDocumentID `xml:"application-reference>document-id"`
+	Title          innerText    `xml:"invention-title"`
+	PriorityClaims []struct {
+		Country string `xml:"country"`
+		Date    string `xml:"date"`
+	} `xml:"priority-claims>priority-claim"`
+	MainCPC      []usClassificationCPC `xml:"classifications-cpc>main-cpc>classification-cpc"`
+	FurtherCPC   []usClassificationCPC `xml:"classifications-cpc>further-cpc>classification-cpc"`
+	Inventors    []usParty             `xml:"us-parties>inventors>inventor"`
+	OldInventors []usParty             `xml:"parties>inventors>inventor"`
+	Assignees    []usParty             `xml:"assignees>assignee"`
+}
+
+// usPatentDocument covers the USPTO red book grant and application formats.
+type usPatentDocument struct {
+	GrantBiblio       usBibliographicData `xml:"us-bibliographic-data-grant"`
+	ApplicationBiblio usBibliographicData `xml:"us-bibliographic-data-application"`
+	Abstract          innerText           `xml:"abstract"`
+	Description       innerText           `xml:"description"`
+	Claims            []struct {
+		ID   string    `xml:"id,attr"`
+		Num  string    `xml:"num,attr"`
+		Text innerText `xml:"claim-text"`
+	} `xml:"claims>claim"`
+}
+
+// epPatentDocument covers the EPO publication server format (ST.36 with SDOBI bibliography).
+type epPatentDocument struct {
+	Country   string `xml:"country,attr"`
+	DocNumber string `xml:"doc-number,attr"`
+	Kind      string `xml:"kind,attr"`
+	DatePubl  string `xml:"date-publ,attr"`
+	SDOBI     struct {
+		ApplicationNumber string `xml:"B200>B210"`
+		ApplicationDate   string `xml:"B200>B220>date"`
+		Priorities        []struct {
+			Date    string `xml:"B320>date"`
+			Country string `xml:"B330>ctry"`
+		} `xml:"B300"`
+		TitleLangs []string    `xml:"B500>B540>B541"`
+		Titles     []innerText `xml:"B500>B540>B542"`
+		CPC        []string    `xml:"B500>B520EP>classifications-cpc>classification-cpc>text"`
+		Inventors  []string    `xml:"B700>B720>B721>snm"`
+		Assignees  []string    `xml:"B700>B730>B731>snm"`
+	} `xml:"SDOBI"`
+	Abstracts    []innerText `xml:"abstract"`
+	Descriptions []innerText `xml:"description"`
+	ClaimSets    []struct {
+		Lang   string `xml:"lang,attr"`
+		Claims []struct {
+			Num  string    `xml:"num,attr"`
+			Text innerText `xml:"claim-text"`
+		} `xml:"claim"`
+	} `xml:"claims"`
+}
+
+// readXMLFile reads one XML file, which may hold several concatenated
+// documents as in the USPTO weekly bulk files.
+func readXMLFile(path string) ([]localPatent, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	patents := make([]localPatent, 0)
+	for _, document := range splitXMLDocuments(content) {
+		patent, ok, err := parseXMLDocument(document)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			patents = append(patents, patent)
+		}
+	}
+	return patents, nil
+}
+
+func splitXMLDocuments(content []byte) [][]byte {
+	documents := make([][]byte, 0)
+	for len(content) > 0 {
+		next := bytes.Index(content[1:], xmlDeclaration)
+		if next < 0 {
+			documents = append(documents, content)
+			break
+		}
+		documents = append(documents, content[:next+1])
+		content = content[next+1:]
+	}
+	return documents
+}
+
+func newXMLDecoder(document []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	return decoder
+}
+
+func parseXMLDocument(document []byte) (localPatent, bool, error) {
+	decoder := newXMLDecoder(document)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return localPatent{}, false, nil
+		}
+		if err != nil {
+			return localPatent{}, false, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "us-patent-grant", "us-patent-application":
+			var doc usPatentDocument
+			if err := decoder.DecodeElement(&doc, &start); err != nil {
+				return localPatent{}, false, fmt.Errorf("decode %s: %w", start.Name.Local, err)
+			}
+			return doc.toLocal(), true, nil
+		case "ep-patent-document":
+			var doc epPatentDocument
+			if err := decoder.DecodeElement(&doc, &start); err != nil {
+				return localPatent{}, false, fmt.Errorf("decode %s: %w", start.Name.Local, err)
+			}
+			return doc.toLocal(), true, nil
+		default:
+			return localPatent{}, false, nil
+		}
+	}
+}
+
+func (d usPatentDocument) toLocal() localPatent {
+	biblio := d.GrantBiblio
+	if biblio.Publication.DocNumber == "" {
+		biblio = d.ApplicationBiblio
+	}
+	patent := localPatent{
+		PublicationNumber: biblio.Publication.Country + biblio.Publication.DocNumber + biblio.Publication.Kind,
+		Country:           biblio.Publication.Country,
+		Kind:              biblio.Publication.Kind,
+		Title:             biblio.Title.String(),
+		Abstract:          d.Abstract.String(),
+		Description:       d.Description.String(),
+		ApplicationNumber: biblio.Application.DocNumber,
+		ApplicationDate:   parseDate("20060102", biblio.Application.Date),
+		PublicationDate:   parseDate("20060102", biblio.Publication.Date),
+	}
+
+	for _, cpc := range append(biblio.MainCPC, biblio.FurtherCPC...) {
+		patent.CPC = append(patent.CPC, fmt.Sprintf("%s%s%s%s/%s",
+			cpc.Section, cpc.Class, cpc.Subclass, cpc.MainGroup, cpc.Subgroup))
+	}
+	inventors := biblio.Inventors
+	if len(inventors) == 0 {
+		inventors = biblio.OldInventors
+	}
+	for _, inventor := range inventors {
+		if name := inventor.name(); name != "" {
+			patent.Inventors = append(patent.Inventors, name)
+		}
+	}
+	for _, assignee := range biblio.Assignees {
+		if name := assignee.name(); name != "" {
+			patent.Assignees = append(patent.Assignees, name)
+		}
+	}
+
+	priorities := make([]priority, 0, len(biblio.PriorityClaims))
+	for _, claim := range biblio.PriorityClaims {
+		priorities = append(priorities, priority{country: claim.Country, date: parseDate("20060102", claim.Date)})
+	}
+	patent.setPriorities(priorities)
+
+	for i, claim := range d.Claims {
+		number, err := strconv.Atoi(strings.TrimLeft(claim.Num, "0"))
+		if err != nil {
+			number = i + 1
+		}
+		patent.Claims = append(patent.Claims, newLocalClaim(number, claim.Text.String()))
+	}
+	return patent
+}
+
+func (d epPatentDocument) toLocal() localPatent {
+	sdobi := d.SDOBI
+	patent := localPatent{
+		PublicationNumber: d.Country + d.DocNumber + d.Kind,
+		Country:           d.Country,
+		Kind:              d.Kind,
+		ApplicationNumber: sdobi.ApplicationNumber,
+		ApplicationDate:   parseDate("20060102", sdobi.ApplicationDate),
+		PublicationDate:   parseDate("20060102", d.DatePubl),
+		Inventors:         sdobi.Inventors,
+		Assignees:         sdobi.Assignees,
+	}
+	for i, title := range sdobi.Titles {
+		if patent.Title == "" || (i < len(sdobi.TitleLangs) && sdobi.TitleLangs[i] == "en") {
+			patent.Title = title.String()
+		}
+	}
+	for _, cpc := range sdobi.CPC {
+		// "H04L   9/32        20130101 FI20051111BHEP" -> "H04L9/32"
+		fields := strings.Fields(cpc)
+		if len(fields) >= 2 {
+			patent.CPC = append(patent.CPC, fields[0]+fields[1])
+		}
+	}
+	for _, abstract := range d.Abstracts {
+		if patent.Abstract == "" || abstract.Lang == "en" {
+			patent.Abstract = abstract.String()
+		}
+	}
+	for _, description := range d.Descriptions {
+		if patent.Description == "" || description.Lang == "en" {
+			patent.Description = description.String()
+		}
+	}
+
+	priorities := make([]priority, 0, len(sdobi.Priorities))
+	for _, p := range sdobi.Priorities {
+		priorities = append(priorities, priority{country: p.Country, date: parseDate("20060102", p.Date)})
+	}
+	patent.setPriorities(priorities)
+
+	for _, claimSet := range d.ClaimSets {
+		if len(patent.Claims) > 0 && claimSet.Lang != "en" {
+			continue
+		}
+		patent.Claims = patent.Claims[:0]
+		for i, claim := range claimSet.Claims {
+			number, err := strconv.Atoi(strings.TrimLeft(claim.Num, "0"))
+			if err != nil {
+				number = i + 1
+			}
+			patent.Claims = append(patent.Claims, newLocalClaim(number, claim.Text.String()))
+		}
+	}
+	return patent
+}
+
+type priority struct {
+	country string
+	date    time.Time
+}
+
+// setPriorities mirrors the KTMine fields: the earliest priority date, and
+// the simple family jurisdictions as the countries claimed on that date.
+func (p *localPatent) setPriorities(priorities []priority) {
+	for _, claim := range priorities {
+		if claim.date.IsZero() {
+			continue
+		}
+		if p.EarliestPriorityDate.IsZero() || claim.date.Before(p.EarliestPriorityDate) {
+			p.EarliestPriorityDate = claim.date
+		}
+	}
+	if p.EarliestPriorityDate.IsZero() {
+		p.EarliestPriorityDate = p.ApplicationDate
+		if p.Country != "" {
+			p.Jurisdictions = []string{p.Country}
+		}
+		return
+	}
+	unique := make(map[string]struct{})
+	for _, claim := range priorities {
+		if claim.date.Equal(p.EarliestPriorityDate) && claim.country != "" {
+			if _, exists := unique[claim.country]; !exists {
+				unique[claim.country] = struct{}{}
+				p.Jurisdictions = append(p.Jurisdictions, claim.country)
+			}
+		}
+	}
+}
+
+func newLocalClaim(number int, text string) localClaim {
+	claim := localClaim{Number: number, Text: text}
+	if match := claimTextReference.FindStringSubmatch(text); match != nil {
+		if dependsOn, err := strconv.Atoi(match[1]); err == nil && dependsOn != number {
+			claim.DependsOn = dependsOn
+		}
+	}
+	return claim
+}
@@ -0,0 +1,125 @@
+package ktmine_repository
+
+import (
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// circuitBreaker stops calls to KTMine after threshold consecutive failures.
+// Once cooldown has passed a single probe request is let through: success
+// closes the breaker, failure opens it for another cooldown.
+type circuitBreaker struct {
+	log       *slog.Logger
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(log *slog.Logger, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		log:       log.With(slog.String("component", "ktmine_circuit_breaker")),
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     breakerClosed,
+	}
+}
+
+// Allow reports whether a request may be sent. Callers that are allowed must
+// report the outcome with Success or Failure, or give the call up with
+// Release.
+func (b *circuitBreaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return fmt.Errorf("circuit breaker open: %w", model.ErrUpstreamUnavailable)
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("circuit breaker half-open: %w", model.ErrUpstreamUnavailable)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *circuitBreaker) Success() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+func (b *circuitBreaker) Failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// Release gives up an allowed call without an outcome, e.g. when the caller's
+// context was cancelled, so a half-open probe slot is not held forever.
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) Status() model.CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := model.CircuitBreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != breakerClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+func (b *circuitBreaker) setState(state string) {
+	b.log.Warn("circuit breaker state changed",
+		slog.String("from", b.state),
+		slog.String("to", state),
+		slog.Int("consecutive_failures", b.failures),
+	)
+	b.state = state
+}
@@ -0,0 +1,60 @@
+package ktmine_repository
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const bodySnippetSize = 512
+
+// StatusError is returned when KTMine answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func newStatusError(resp *http.Response, body []byte) *StatusError {
+	if len(body) > bodySnippetSize {
+		body = body[:bodySnippetSize]
+	}
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ktmine responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed if sent again.
+func (e *StatusError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var seconds int
+	if _, err := fmt.Sscanf(value, "%d", &seconds); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
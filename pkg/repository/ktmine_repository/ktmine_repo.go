@@ -4,36 +4,105 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
 	"io"
 	"log/slog"
+	"math/rand"
 	"net/http"
 	"time"
 )
 
 type KTMineRepository struct {
-	log    *slog.Logger
-	cfg    *config.Config
-	client *http.Client
+	log     *slog.Logger
+	cfg     *config.Config
+	client  *http.Client
+	limiter *rateLimiter
+	breaker *circuitBreaker
 }
 
+// defaultRequestTimeout is used when the config sets no request timeout.
+const defaultRequestTimeout = 30 * time.Second
+
 func NewKTMineRepository(log *slog.Logger, cfg *config.Config) *KTMineRepository {
 	tr := &http.Transport{
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 100,
 		MaxConnsPerHost:     100,
 	}
+	timeout := cfg.KTMineRequestTimeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
 	client := &http.Client{
 		Transport: tr,
-		Timeout:   1000 * time.Second,
+		Timeout:   timeout,
 	}
 	return &KTMineRepository{
-		log:    log,
-		cfg:    cfg,
-		client: client,
+		log:     log,
+		cfg:     cfg,
+		client:  client,
+		limiter: newRateLimiter(cfg.KTMineRateLimit, cfg.KTMineRateBurst),
+		breaker: newCircuitBreaker(log, cfg.KTMineBreakerThreshold, cfg.KTMineBreakerCooldown),
+	}
+}
+
+func (r *KTMineRepository) Status() model.CircuitBreakerStatus {
+	return r.breaker.Status()
+}
+
+// SearchPatents fetches one page of patents from KTMine and normalizes it.
+func (r *KTMineRepository) SearchPatents(ctx context.Context, query model.PatentQuery) ([]model.FilteredFullPatent, error) {
+	raw, err := r.GetFilteredData(ctx, searchRequestBody(query, r.cfg.KTMineAPIKey))
+	if err != nil {
+		return nil, err
+	}
+	if query.Full {
+		return r.parseFullPatentsResponse(raw)
+	}
+
+	patents := make([]model.FilteredPatent, 0, query.Limit)
+	if err := r.parseFilteredResponse(raw, &patents); err != nil {
+		return nil, err
+	}
+	result := make([]model.FilteredFullPatent, 0, len(patents))
+	for _, patent := range patents {
+		result = append(result, model.FilteredFullPatent{Patent: patent})
+	}
+	return result, nil
+}
+
+// SearchRequest returns the body SearchPatents posts to KTMine, with the API key redacted.
+func (r *KTMineRepository) SearchRequest(query model.PatentQuery) model.FiltersRequestBody {
+	key := ""
+	if r.cfg.KTMineAPIKey != "" {
+		key = model.RedactedValue
 	}
+	return searchRequestBody(query, key)
+}
+
+func searchRequestBody(query model.PatentQuery, key string) model.FiltersRequestBody {
+	fields := returnFields
+	if query.Full {
+		fields = make([]string, 0, len(returnFields)+len(fullPatentReturnFields))
+		fields = append(fields, returnFields...)
+		fields = append(fields, fullPatentReturnFields...)
+	}
+	return model.NewFilterRequestBody(query.Filters, key, query.Offset, query.Limit, query.PreFilter, fields)
+}
+
+func (r *KTMineRepository) GetStatistics(ctx context.Context, filters []model.SingleParsedFilter) (*model.PatentStatistics, error) {
+	raw, err := r.GetFilteredData(ctx, model.NewStatisticsRequestBody(filters, r.cfg.KTMineAPIKey))
+	if err != nil {
+		return nil, err
+	}
+	aggregations, totalFound, err := r.parseStatistics(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &model.PatentStatistics{Aggregations: *aggregations, TotalFound: totalFound}, nil
 }
 
 func (r *KTMineRepository) GetFilteredData(ctx context.Context, filters model.FilterInterface) (*[]byte, error) {
@@ -42,10 +111,77 @@ func (r *KTMineRepository) GetFilteredData(ctx context.Context, filters model.Fi
 
 	requestBody, err := json.Marshal(filters)
 	if err != nil {
-		log.Error("error marshaling request body", err)
+		log.Error("error marshaling request body", slog.String("error", err.Error()))
 		return nil, err
 	}
 
+	for attempt := 0; ; attempt++ {
+		if err := r.breaker.Allow(); err != nil {
+			return nil, err
+		}
+		if err := r.limiter.Wait(ctx); err != nil {
+			r.breaker.Release()
+			return nil, err
+		}
+		body, err := r.doRequest(ctx, requestBody)
+		if err == nil {
+			r.breaker.Success()
+			return &body, nil
+		}
+		if ctx.Err() != nil {
+			r.breaker.Release()
+			return nil, ctx.Err()
+		}
+
+		var statusErr *StatusError
+		retryable := true
+		var retryAfter time.Duration
+		if errors.As(err, &statusErr) {
+			retryable = statusErr.Retryable()
+			retryAfter = statusErr.RetryAfter
+		}
+		// a 4xx says nothing about KTMine's health, so it neither resets nor
+		// adds to the failure count
+		if retryable {
+			r.breaker.Failure()
+		} else {
+			r.breaker.Release()
+		}
+		if !retryable || attempt >= r.cfg.KTMineMaxRetries {
+			log.Error("request failed", slog.String("error", err.Error()), slog.Int("attempt", attempt+1))
+			return nil, err
+		}
+
+		// a Retry-After beyond the longest wait would hold the caller for as
+		// long as the provider likes; give up instead
+		if retryAfter > r.cfg.KTMineRetryMaxWait {
+			log.Error("request throttled for longer than the maximum wait",
+				slog.String("error", err.Error()),
+				slog.Duration("retry_after", retryAfter),
+				slog.Duration("max_wait", r.cfg.KTMineRetryMaxWait),
+			)
+			return nil, err
+		}
+		wait := r.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		log.Warn("request failed, retrying",
+			slog.String("error", err.Error()),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("wait", wait),
+		)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *KTMineRepository) doRequest(ctx context.Context, requestBody []byte) ([]byte, error) {
 	req, err := http.NewRequestWithContext(
 		ctx,
 		"POST",
@@ -53,18 +189,12 @@ func (r *KTMineRepository) GetFilteredData(ctx context.Context, filters model.Fi
 		bytes.NewBuffer(requestBody),
 	)
 	if err != nil {
-		log.Error("Error creating request:", err)
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		log.Error("Error making POST request:", err)
-		return nil, err
-	}
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		log.Error("Error making POST request: status code", resp.StatusCode)
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -73,5 +203,27 @@ func (r *KTMineRepository) GetFilteredData(ctx context.Context, filters model.Fi
 	if err != nil {
 		return nil, err
 	}
-	return &body, nil
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newStatusError(resp, body)
+	}
+	return body, nil
+}
+
+// backoff returns an exponential delay for the given attempt, jittered to
+// between half and one and a half times the nominal value and capped at
+// KTMineRetryMaxWait.
+func (r *KTMineRepository) backoff(attempt int) time.Duration {
+	maxWait := r.cfg.KTMineRetryMaxWait
+	if maxWait <= 0 {
+		return 0
+	}
+	wait := r.cfg.KTMineRetryBaseWait << attempt
+	if wait <= 0 || wait > maxWait {
+		wait = maxWait
+	}
+	wait = time.Duration(rand.Int63n(int64(wait))) + wait/2
+	if wait > maxWait {
+		wait = maxWait
+	}
+	return wait
 }
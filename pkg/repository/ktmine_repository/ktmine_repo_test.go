@@ -0,0 +1,157 @@
+package ktmine_repository
+
+import (
+	"context"
+	"errors"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/pkg/fake_ktmine"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRepository(t *testing.T, opts fake_ktmine.Options, key string) *KTMineRepository {
+	t.Helper()
+	server := fake_ktmine.NewTestServer(opts)
+	t.Cleanup(server.Close)
+	cfg := &config.Config{
+		KTMineURL:              server.URL,
+		KTMineAPIKey:           key,
+		KTMineMaxRetries:       3,
+		KTMineRetryBaseWait:    time.Millisecond,
+		KTMineRetryMaxWait:     10 * time.Millisecond,
+		KTMineBreakerThreshold: 10,
+		KTMineBreakerCooldown:  time.Second,
+	}
+	return NewKTMineRepository(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+}
+
+func TestSearchPatentsAgainstFakeServer(t *testing.T) {
+	repo := testRepository(t, fake_ktmine.Options{APIKey: "secret"}, "secret")
+	filters := []model.SingleParsedFilter{
+		*model.NewSingleParsedFilter([]string{"siemens"}, "current_assignee", nil),
+		*model.NewSingleParsedFilter([]string{"US"}, "document_country", nil),
+	}
+
+	patents, err := repo.SearchPatents(context.Background(), model.PatentQuery{Filters: filters, Limit: 5, Full: true})
+	if err != nil {
+		t.Fatalf("SearchPatents: %v", err)
+	}
+	if len(patents) != 5 {
+		t.Fatalf("got %d patents, want 5", len(patents))
+	}
+	for _, p := range patents {
+		if !strings.HasPrefix(p.Patent.PublicationNumber, "US") {
+			t.Errorf("patent %s does not match the country filter", p.Patent.PublicationNumber)
+		}
+		if len(p.Patent.Assignee) == 0 || !strings.Contains(p.Patent.Assignee[0], "Siemens") {
+			t.Errorf("patent %s has assignees %v", p.Patent.PublicationNumber, p.Patent.Assignee)
+		}
+		if p.Details == nil || len(p.Claims) == 0 {
+			t.Errorf("patent %s was returned without details or claims", p.Patent.PublicationNumber)
+		}
+	}
+}
+
+func TestGetStatisticsAgainstFakeServer(t *testing.T) {
+	repo := testRepository(t, fake_ktmine.Options{}, "")
+	filters := []model.SingleParsedFilter{
+		*model.NewSingleParsedFilter([]string{"siemens"}, "current_assignee", nil),
+	}
+
+	statistics, err := repo.GetStatistics(context.Background(), filters)
+	if err != nil {
+		t.Fatalf("GetStatistics: %v", err)
+	}
+	// the fixtures rotate through five assignees
+	if want := fake_ktmine.DefaultPatentCount / 5; statistics.TotalFound != want {
+		t.Errorf("TotalFound = %d, want %d", statistics.TotalFound, want)
+	}
+	if len(statistics.Aggregations) == 0 {
+		t.Error("no aggregations returned")
+	}
+}
+
+func TestUnknownFieldMatchesNothing(t *testing.T) {
+	repo := testRepository(t, fake_ktmine.Options{}, "")
+	filters := []model.SingleParsedFilter{
+		*model.NewSingleParsedFilter([]string{"x"}, "unknown", nil),
+	}
+
+	patents, err := repo.SearchPatents(context.Background(), model.PatentQuery{Filters: filters, Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchPatents: %v", err)
+	}
+	if len(patents) != 0 {
+		t.Errorf("got %d patents for an unknown field, want none", len(patents))
+	}
+}
+
+func TestWrongKeyIsNotRetried(t *testing.T) {
+	repo := testRepository(t, fake_ktmine.Options{APIKey: "secret"}, "wrong")
+
+	_, err := repo.SearchPatents(context.Background(), model.PatentQuery{Limit: 1})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v, want a 401 StatusError", err)
+	}
+}
+
+func TestBackoffStaysUnderMaxWait(t *testing.T) {
+	repo := &KTMineRepository{cfg: &config.Config{
+		KTMineRetryBaseWait: 100 * time.Millisecond,
+		KTMineRetryMaxWait:  time.Second,
+	}}
+	for attempt := 0; attempt < 70; attempt++ {
+		for i := 0; i < 100; i++ {
+			if wait := repo.backoff(attempt); wait < 0 || wait > time.Second {
+				t.Fatalf("backoff(%d) = %v, want at most 1s", attempt, wait)
+			}
+		}
+	}
+}
+
+func TestLongRetryAfterFailsFast(t *testing.T) {
+	repo := testRepository(t, fake_ktmine.Options{ThrottleRate: 1, RetryAfter: 60}, "")
+
+	start := time.Now()
+	_, err := repo.SearchPatents(context.Background(), model.PatentQuery{Limit: 1})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got %v, want a 429 StatusError", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gave up after %v, want no wait", elapsed)
+	}
+}
+
+func TestClientErrorsDoNotResetBreaker(t *testing.T) {
+	statuses := []int{http.StatusInternalServerError, http.StatusBadRequest, http.StatusInternalServerError}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[requests%len(statuses)]
+		requests++
+		http.Error(w, http.StatusText(status), status)
+	}))
+	t.Cleanup(server.Close)
+	repo := NewKTMineRepository(slog.New(slog.NewTextHandler(io.Discard, nil)), &config.Config{
+		KTMineURL:              server.URL,
+		KTMineBreakerThreshold: 2,
+		KTMineBreakerCooldown:  time.Minute,
+	})
+
+	for range statuses {
+		repo.SearchPatents(context.Background(), model.PatentQuery{Limit: 1})
+	}
+	if state := repo.Status().State; state != breakerOpen {
+		t.Fatalf("breaker %s after two server errors around a 400, want open", state)
+	}
+	if _, err := repo.SearchPatents(context.Background(), model.PatentQuery{Limit: 1}); !errors.Is(err, model.ErrUpstreamUnavailable) {
+		t.Errorf("got %v, want ErrUpstreamUnavailable", err)
+	}
+}
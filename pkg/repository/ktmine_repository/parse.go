@@ -0,0 +1,759 @@
+package ktmine_repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var returnFields = []string{
+	"legal_status",
+	"current_assignee",
+	"inventor",
+	"titles",
+	"current_owner",
+	"expiration_date",
+	"assignee",
+	"priority_claims",
+	"app_pub_references",
+}
+
+var fullPatentReturnFields = []string{
+	"descriptions",
+	"abstract",
+	"images",
+	// parseClaim reads the claimsXml items
+	"claims_xml",
+	"classifications",
+	"families",
+	"citations",
+}
+
+func (r *KTMineRepository) parseInventors(payload []interface{}) []string {
+	parsedInventors := make(map[string]struct{})
+	for _, inventor := range payload {
+		parsedInventor, _ := inventor.(map[string]interface{})
+		var partyName string
+		if partyName, _ = parsedInventor["partyNameClean"].(string); partyName == "" {
+			partyName, _ = parsedInventor["partyName"].(string)
+		}
+		if partyName != "" {
+			parsedInventors[partyName] = struct{}{}
+		}
+	}
+	uniqueInventors := make([]string, 0, len(parsedInventors))
+	for inventor := range parsedInventors {
+		uniqueInventors = append(uniqueInventors, inventor)
+	}
+	return uniqueInventors
+}
+
+func (r *KTMineRepository) parseAssignees(payload []interface{}) []string {
+	parsedAssignees := make(map[string]struct{})
+	for _, assignee := range payload {
+		parsedAssignee, _ := assignee.(map[string]interface{})
+		var partyName string
+		if partyName, _ = parsedAssignee["partyNameClean"].(string); partyName == "" {
+			partyName, _ = parsedAssignee["partyName"].(string)
+		}
+
+		if partyName != "" {
+			parsedAssignees[partyName] = struct{}{}
+		}
+	}
+	parsedUniqueAssignees := make([]string, 0, len(parsedAssignees))
+	for assignee := range parsedAssignees {
+		parsedUniqueAssignees = append(parsedUniqueAssignees, assignee)
+	}
+	return parsedUniqueAssignees
+}
+
+func (r *KTMineRepository) parseSimpleFamilyJurisdiction(minPriorityDate string, payload []interface{}) []string {
+	parsedFamilyJurisdiction := make(map[string]struct{})
+	for _, priorityClaim := range payload {
+		parsedPriorityClaim, _ := priorityClaim.(map[string]interface{})
+		documentDate, _ := parsedPriorityClaim["documentDate"].(string)
+		if documentDate == minPriorityDate {
+			country, _ := parsedPriorityClaim["country"].(string)
+			if country != "" {
+				parsedFamilyJurisdiction[country] = struct{}{}
+			}
+		}
+	}
+	uniqueJurisdictions := make([]string, 0, len(parsedFamilyJurisdiction))
+	for jurisdiction := range parsedFamilyJurisdiction {
+		uniqueJurisdictions = append(uniqueJurisdictions, jurisdiction)
+	}
+	return uniqueJurisdictions
+}
+
+func (r *KTMineRepository) parseFilteredPatent(patent interface{}) model.FilteredPatent {
+	parsedPatent, _ := patent.(map[string]interface{})
+	publicationNumber, _ := parsedPatent["documentNumber"].(string)
+	simpleLegalStatus, _ := parsedPatent["legalStatus"].(string)
+
+	title, ok := parsedPatent["inventionTitle"].(string)
+	if !ok || title == "" {
+		inventionTitles, ok := parsedPatent["inventionTitles"].([]interface{})
+		if ok {
+			for _, it := range inventionTitles {
+				inventionTitle, ok := it.(map[string]interface{})
+				if ok {
+					if lang, ok := inventionTitle["lang"].(string); ok && lang == "eng" {
+						title, _ = inventionTitle["title"].(string)
+						break
+					}
+				}
+			}
+		}
+	}
+	var applicationDate string
+	if applicationReferences, ok := parsedPatent["applicationReferences"].([]interface{}); ok {
+		for _, applicationReference := range applicationReferences {
+			if applicationReferenceParsed, ok := applicationReference.(map[string]interface{}); ok {
+				if applicationDate == "" {
+					applicationDate, ok = applicationReferenceParsed["documentDate"].(string)
+					if !ok {
+						applicationDate = ""
+					}
+				}
+			}
+		}
+	}
+
+	const customDateLayout = "2006-01-02T15:04:05"
+	applicationDateParsed, err := time.Parse(customDateLayout, applicationDate)
+	if err != nil {
+		applicationDateParsed = time.Time{}
+	}
+	earliestPriorityDate, _ := parsedPatent["minPriorityDate"].(string)
+	estimatedExpiryDate, _ := parsedPatent["projectedExpirationDate"].(string)
+	earliestPriorityDateParsed, err := time.Parse(customDateLayout, earliestPriorityDate)
+	if err != nil {
+		earliestPriorityDateParsed = time.Time{}
+	}
+	estimatedExpiryDateParsed, err := time.Parse(customDateLayout, estimatedExpiryDate)
+	if err != nil {
+		estimatedExpiryDateParsed = time.Time{}
+	}
+	minPriorityDate, _ := parsedPatent["minPriorityDate"].(string)
+
+	priorityClaims, _ := parsedPatent["priorityClaims"].([]interface{})
+	uniqueJurisdictions := r.parseSimpleFamilyJurisdiction(minPriorityDate, priorityClaims)
+
+	var currentAssignee []interface{}
+	currentAssignee, _ = parsedPatent["currentOwners"].([]interface{})
+	if len(currentAssignee) == 0 {
+		currentAssignee, _ = parsedPatent["currentAssignees"].([]interface{})
+		if len(currentAssignee) == 0 {
+			currentAssignee, _ = parsedPatent["assignees"].([]interface{})
+		}
+	}
+	parsedUniqueAssignees := r.parseAssignees(currentAssignee)
+
+	inventors, _ := parsedPatent["inventors"].([]interface{})
+	uniqueInventors := r.parseInventors(inventors)
+
+	return model.FilteredPatent{
+		Title:                    title,
+		PublicationNumber:        publicationNumber,
+		EarliestPriorityDate:     &earliestPriorityDateParsed,
+		EstimatedExpiryDate:      &estimatedExpiryDateParsed,
+		InventorsNames:           uniqueInventors,
+		Assignee:                 parsedUniqueAssignees,
+		SimpleFamilyJurisdiction: uniqueJurisdictions,
+		ApplicationDate:          &applicationDateParsed,
+		SimpleLegalStatus:        &simpleLegalStatus,
+	}
+}
+
+func (r *KTMineRepository) ParseFullPatent(patent interface{}) model.FilteredFullPatent {
+	parsed := r.parseFilteredPatent(patent)
+	parsedPatent, _ := patent.(map[string]interface{})
+	var parsedAbstract string
+	if abstract, ok := parsedPatent["abstractParagraphs"].([]interface{}); ok {
+		for _, abstractObject := range abstract {
+			if parsedAbstractObject, ok := abstractObject.(map[string]interface{}); ok {
+				if lang, ok := parsedAbstractObject["lang"].(string); ok && lang == "en" {
+					if text, ok := parsedAbstractObject["plainText"].(string); ok {
+						parsedAbstract = utils.RemoveHTMLTags(text)
+					}
+				}
+			}
+		}
+	}
+	var builder strings.Builder
+	if description, ok := parsedPatent["descriptions"].([]interface{}); ok {
+		for _, descriptionObject := range description {
+			if parsedDescriptionObject, ok := descriptionObject.(map[string]interface{}); ok {
+				if lang, ok := parsedDescriptionObject["lang"].(string); ok && lang == "en" {
+					if text, ok := parsedDescriptionObject["plainText"].(string); ok {
+						builder.WriteString("\n")
+						builder.WriteString(text)
+					}
+				}
+			}
+		}
+	}
+	parsedDescription := builder.String()
+	id := uuid.New()
+	var claims []model.Claim
+	if parsedClaims := r.parseClaim(parsedPatent, id); parsedClaims != nil {
+		claims = *parsedClaims
+	}
+	details := r.parsePatent(parsedPatent)
+	details.Id = id
+	details.SetClaimCounts(claims)
+	return model.FilteredFullPatent{
+		Patent:      parsed,
+		ID:          id,
+		Description: parsedDescription,
+		Abstract:    parsedAbstract,
+		Claims:      claims,
+		Details:     details,
+	}
+}
+
+func (r *KTMineRepository) parseFullPatentsResponse(patents *[]byte) ([]model.FilteredFullPatent, error) {
+	var data map[string]interface{}
+	err := json.Unmarshal(*patents, &data)
+	if err != nil {
+		return nil, err
+	}
+	response, ok := data["response"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("can't parse response body")
+	}
+	items, _ := response["items"].([]interface{})
+	parsedResponse := make([]model.FilteredFullPatent, 0, len(items))
+	for _, patent := range items {
+		parsedResponse = append(parsedResponse, r.ParseFullPatent(patent))
+	}
+	return parsedResponse, nil
+}
+
+func (r *KTMineRepository) parseStatistics(payload *[]byte) (*map[string]interface{}, int, error) {
+	var data map[string]interface{}
+	err := json.Unmarshal(*payload, &data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	response, ok := data["response"].(map[string]interface{})
+	if !ok {
+		return nil, 0, errors.New("missing or invalid 'response' field")
+	}
+
+	stats, ok := data["aggregations"].(map[string]interface{})
+	if !ok {
+		return nil, 0, errors.New("missing or invalid 'aggregations' field")
+	}
+
+	totalFound, ok := response["totalFound"]
+	if !ok {
+		return nil, 0, errors.New("missing 'totalFound' in response")
+	}
+
+	totalPatents, ok := totalFound.(float64)
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid 'totalFound' type: expected float64, got %T", totalFound)
+	}
+
+	return &stats, int(totalPatents), nil
+}
+
+func (r *KTMineRepository) parseFilteredResponse(patents *[]byte, parsedResponse *[]model.FilteredPatent) error {
+	var data map[string]interface{}
+	err := json.Unmarshal(*patents, &data)
+	if err != nil {
+		return err
+	}
+	response, ok := data["response"].(map[string]interface{})
+	if !ok {
+		return errors.New("can't parse response body")
+	}
+	items, ok := response["items"].([]interface{})
+	for _, patent := range items {
+		parsedPatent := r.parseFilteredPatent(patent)
+		*parsedResponse = append(*parsedResponse, parsedPatent)
+	}
+	return nil
+}
+
+func (r *KTMineRepository) parsePatent(data map[string]interface{}) *model.ParsedPatent {
+	publicationNumber, _ := data["documentNumber"].(string)
+	simpleLegalStatus, _ := data["legalStatus"].(string)
+
+	title, ok := data["inventionTitle"].(string)
+	if !ok || title == "" {
+		inventionTitles, ok := data["inventionTitles"].([]interface{})
+		if ok {
+			for _, it := range inventionTitles {
+				inventionTitle, ok := it.(map[string]interface{})
+				if ok {
+					if lang, ok := inventionTitle["lang"].(string); ok && lang == "eng" {
+						title, _ = inventionTitle["title"].(string)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	var cpcList []string
+	var cpcClassificationList []model.CPCClassification
+	if cpcClassifications, ok := data["cpcClassifications"].([]interface{}); ok {
+		for _, entry := range cpcClassifications {
+			if classificationMap, ok := entry.(map[string]interface{}); ok {
+				if symbol, ok := classificationMap["symbol"].(string); ok {
+					cpcList = append(cpcList, symbol)
+					cpcClassificationList = append(cpcClassificationList,
+						model.NewCPCClassification(symbol, isInventiveCPC(classificationMap, len(cpcList) == 1)))
+				}
+			}
+		}
+	}
+	cpcResult := strings.Join(cpcList, " | ")
+
+	var inpadocFamilyMembers, inpadocFamilyJurisdictions []string
+	if inpadocFamilyList, ok := data["inpadocFamilyMembers"].([]interface{}); ok {
+		for _, entry := range inpadocFamilyList {
+			if inpadocFamily, ok := entry.(map[string]interface{}); ok {
+				country, _ := inpadocFamily["country"].(string)
+				documentNumber, _ := inpadocFamily["documentNumber"].(string)
+				kind, _ := inpadocFamily["kind"].(string)
+				inpadocFamilyMember := fmt.Sprintf("%s%s%s", country, documentNumber, kind)
+				inpadocFamilyMembers = append(inpadocFamilyMembers, inpadocFamilyMember)
+				if country != "" {
+					inpadocFamilyJurisdictions = append(inpadocFamilyJurisdictions, country)
+				}
+			}
+		}
+	}
+	inpadocFamilyMembersResult := strings.Join(inpadocFamilyMembers, " | ")
+	inpadocFamilyJurisdictionsResult := strings.Join(inpadocFamilyJurisdictions, " | ")
+
+	priorityClaims, _ := data["priorityClaims"].([]interface{})
+	simpleFamilyKey := parseSimpleFamilyKey(priorityClaims)
+
+	var abstractResult string
+	if abstractParagraph, ok := data["abstractParagraphs"].([]interface{}); ok {
+		for _, abstract := range abstractParagraph {
+			if abstractParsed, ok := abstract.(map[string]interface{}); ok {
+				if abstractText, ok := abstractParsed["plainText"].(string); ok {
+					abstractResult = fmt.Sprintf("%s%s\n", abstractResult, abstractText)
+				}
+			}
+		}
+	}
+	abstractResult = utils.RemoveHTMLTags(abstractResult)
+
+	briefDescriptionFlag := false
+	var descriptionResult, briefDescriptionOfDrawingsResult string
+	if descriptionData, ok := data["descriptions"].([]interface{}); ok {
+		for _, descriptionText := range descriptionData {
+			if description, ok := descriptionText.(map[string]interface{}); ok {
+				var category string
+				if category, ok = description["category"].(string); ok {
+					if category == "brief-description-of-drawings" {
+						briefDescriptionFlag = !briefDescriptionFlag
+					}
+				}
+				if parsedDescription, ok := description["plainText"].(string); ok {
+					descriptionResult = fmt.Sprintf("%s%s\n", descriptionResult, parsedDescription)
+					if briefDescriptionFlag || category == "description-of-drawings" {
+						briefDescriptionOfDrawingsResult = fmt.Sprintf("%s%s\n", briefDescriptionOfDrawingsResult,
+							parsedDescription)
+					}
+				}
+			}
+		}
+	}
+	descriptionResult = utils.RemoveHTMLTags(descriptionResult)
+	briefDescriptionOfDrawingsResult = utils.RemoveHTMLTags(briefDescriptionOfDrawingsResult)
+
+	publicationReference, _ := data["publicationReference"].(map[string]interface{})
+	authority, _ := publicationReference["country"].(string)
+
+	var applicationNumber, applicationDate string
+	if applicationReferences, ok := data["applicationReferences"].([]interface{}); ok {
+		for _, applicationReference := range applicationReferences {
+			if applicationReferenceParsed, ok := applicationReference.(map[string]interface{}); ok {
+				if dataFormat, ok := applicationReferenceParsed["dataFormat"].(string); ok && dataFormat == "original" {
+					if applicationNumber == "" {
+						applicationNumber, ok = applicationReferenceParsed["documentNumber"].(string)
+						if !ok {
+							applicationNumber = ""
+						}
+					}
+				}
+				if applicationDate == "" {
+					applicationDate, ok = applicationReferenceParsed["documentDate"].(string)
+					if !ok {
+						applicationDate = ""
+					}
+				}
+			}
+		}
+	}
+	applicationDateParsed := parseDate(applicationDate)
+
+	var issueDate string
+	if pubReferences, ok := data["publicationReferences"].([]interface{}); ok {
+		for _, pubRef := range pubReferences {
+			if pubRefMap, ok := pubRef.(map[string]interface{}); ok {
+				if date, ok := pubRefMap["documentDate"].(string); ok && date != "" {
+					issueDate = date
+					break
+				}
+			}
+		}
+	}
+	issueDateParsed := parseDate(issueDate)
+
+	earliestPriorityDate, _ := data["minPriorityDate"].(string)
+	estimatedExpiryDate, _ := data["projectedExpirationDate"].(string)
+	earliestPriorityDateParsed := parseDate(earliestPriorityDate)
+	estimatedExpiryDateParsed := parseDate(estimatedExpiryDate)
+	citations := parseCitations(publicationNumber, data)
+
+	return &model.ParsedPatent{
+		Id:                             uuid.New(),
+		Title:                          title,
+		Abstract:                       abstractResult,
+		CPC:                            cpcResult,
+		CPCClassifications:             cpcClassificationList,
+		EarliestPriorityDate:           earliestPriorityDateParsed,
+		EstimatedExpiryDate:            estimatedExpiryDateParsed,
+		PublicationNumber:              publicationNumber,
+		CountOfCitedByPatents:          len(citations.Forward),
+		Citations:                      citations,
+		Description:                    descriptionResult,
+		BriefDescriptionOfDrawings:     briefDescriptionOfDrawingsResult,
+		SimpleLegalStatus:              simpleLegalStatus,
+		InpadocFamily:                  inpadocFamilyMembersResult,
+		InpadocFamilyApplicationCount:  len(inpadocFamilyMembers),
+		InpadocFamilyJurisdiction:      inpadocFamilyJurisdictionsResult,
+		InpadocFamilyJurisdictionCount: len(inpadocFamilyJurisdictions),
+		SimpleFamilyKey:                simpleFamilyKey,
+		Authority:                      authority,
+		ApplicationDate:                applicationDateParsed,
+		ApplicationNumber:              applicationNumber,
+		IssueDate:                      issueDateParsed,
+		PublicationDate:                issueDateParsed,
+		// stored without the API key, which is added when the file is downloaded
+		FileURL: fmt.Sprintf("https://api.ktmine.com/api/v2/patents/pdf/%s", publicationNumber),
+	}
+}
+
+// parseSimpleFamilyKey identifies a simple family by its set of priority
+// claims: patents claiming exactly the same priorities are one family. It is
+// empty when the patent claims no priority.
+func parseSimpleFamilyKey(priorityClaims []interface{}) string {
+	priorities := make([]string, 0, len(priorityClaims))
+	seen := make(map[string]struct{}, len(priorityClaims))
+	for _, priorityClaim := range priorityClaims {
+		parsed, _ := priorityClaim.(map[string]interface{})
+		country, _ := parsed["country"].(string)
+		documentNumber, _ := parsed["documentNumber"].(string)
+		documentDate, _ := parsed["documentDate"].(string)
+		if len(documentDate) > len(time.DateOnly) {
+			documentDate = documentDate[:len(time.DateOnly)]
+		}
+		priority := strings.Join([]string{
+			strings.ToUpper(country), utils.NormalizePublicationNumber(documentNumber), documentDate,
+		}, ":")
+		if _, exists := seen[priority]; exists || priority == "::" {
+			continue
+		}
+		seen[priority] = struct{}{}
+		priorities = append(priorities, priority)
+	}
+	sort.Strings(priorities)
+	return strings.Join(priorities, ";")
+}
+
+// parseCitations reads the citation edges of a patent: backwardCitations are
+// the documents it cites and forwardCitations the later patents citing it.
+// Non-patent literature comes from nonPatentCitations.
+func parseCitations(publicationNumber string, data map[string]interface{}) model.PatentCitations {
+	number := utils.StripKindCode(utils.NormalizePublicationNumber(publicationNumber))
+	var citations model.PatentCitations
+	if number == "" {
+		return citations
+	}
+	seen := make(map[model.Citation]struct{})
+	add := func(edges []model.Citation, citation model.Citation) []model.Citation {
+		key := model.Citation{CitingNumber: citation.CitingNumber, CitedNumber: citation.CitedNumber}
+		if _, exists := seen[key]; exists || citation.CitingNumber == citation.CitedNumber {
+			return edges
+		}
+		seen[key] = struct{}{}
+		return append(edges, citation)
+	}
+
+	backward, _ := data["backwardCitations"].([]interface{})
+	for _, entry := range backward {
+		parsed, _ := entry.(map[string]interface{})
+		if cited := citationNumber(parsed); cited != "" {
+			category, _ := parsed["category"].(string)
+			citations.Backward = add(citations.Backward,
+				model.Citation{CitingNumber: number, CitedNumber: cited, Category: category})
+		}
+	}
+	forward, _ := data["forwardCitations"].([]interface{})
+	for _, entry := range forward {
+		parsed, _ := entry.(map[string]interface{})
+		if citing := citationNumber(parsed); citing != "" {
+			category, _ := parsed["category"].(string)
+			citations.Forward = add(citations.Forward,
+				model.Citation{CitingNumber: citing, CitedNumber: number, Category: category})
+		}
+	}
+	nonPatent, _ := data["nonPatentCitations"].([]interface{})
+	for _, entry := range nonPatent {
+		var text string
+		switch parsed := entry.(type) {
+		case string:
+			text = parsed
+		case map[string]interface{}:
+			if text, _ = parsed["text"].(string); text == "" {
+				text, _ = parsed["citationText"].(string)
+			}
+		}
+		if text = strings.TrimSpace(utils.RemoveHTMLTags(text)); text != "" {
+			citations.NonPatent = append(citations.NonPatent, model.NonPatentCitation{
+				CitingNumber: number,
+				Position:     len(citations.NonPatent),
+				Text:         text,
+			})
+		}
+	}
+	return citations
+}
+
+// citationNumber builds the graph key of a cited or citing document, which
+// KTMine gives either as a full number or split into country and number.
+func citationNumber(entry map[string]interface{}) string {
+	country, _ := entry["country"].(string)
+	documentNumber, _ := entry["documentNumber"].(string)
+	number := utils.NormalizePublicationNumber(documentNumber)
+	if number == "" {
+		return ""
+	}
+	country = strings.ToUpper(country)
+	if !strings.HasPrefix(number, country) {
+		number = country + number
+	}
+	return utils.StripKindCode(number)
+}
+
+// isInventiveCPC reads the classification value of a CPC entry, "I" for
+// inventive and "A" for additional. Entries without one count as inventive
+// only when they come first, which is where KTMine puts the main symbol.
+func isInventiveCPC(entry map[string]interface{}, first bool) bool {
+	value, _ := entry["classificationValue"].(string)
+	switch strings.ToUpper(value) {
+	case "I", "INVENTIVE":
+		return true
+	case "A", "ADDITIONAL":
+		return false
+	}
+	return first
+}
+
+// parseDate reads the date part of a KTMine date, which comes either as a
+// plain date or as a timestamp, and returns the zero time when there is none.
+func parseDate(value string) time.Time {
+	if len(value) > len(time.DateOnly) {
+		value = value[:len(time.DateOnly)]
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+var claimNumberPattern = regexp.MustCompile(`\d+$`)
+
+type claimMapKey struct {
+	claimID     string
+	claimNumber int
+}
+
+type claimMapValue struct {
+	dependent        []string
+	dependentNumbers map[claimMapKey]struct{}
+	claim            string
+}
+
+func (r *KTMineRepository) parseClaim(data map[string]interface{}, patentId uuid.UUID) *[]model.Claim {
+	claimsIds := make(map[string]struct{})
+	claimNumbers := make(map[string]int)
+	claimsMap := make(map[claimMapKey]claimMapValue)
+	claimsList, ok := data["claimsXml"].([]interface{})
+	if ok {
+		for _, value := range claimsList {
+			if claimObject, ok := value.(map[string]interface{}); ok {
+				singleClaim, ok := claimObject["xmlText"].(string)
+				if !ok {
+					continue
+				}
+				singleClaim = utils.RemoveHTMLTags(singleClaim)
+				claimId, _ := claimObject["claimId"].(string)
+				claimNumber, exists := claimNumbers[claimId]
+				if !exists {
+					// claims whose id carries no number are numbered by position
+					claimNumber = len(claimNumbers) + 1
+					if match := claimNumberPattern.FindString(claimId); match != "" {
+						number, err := strconv.Atoi(match)
+						if err != nil {
+							continue
+						}
+						claimNumber = number
+					}
+					claimNumbers[claimId] = claimNumber
+				}
+				claimStruct := claimMapKey{claimID: claimId, claimNumber: claimNumber}
+
+				if _, exists := claimsIds[claimId]; !exists {
+					isDependent, ok := claimObject["isDependent"].(bool)
+					if !ok {
+						continue
+					}
+					if !isDependent {
+						if _, exists := claimsMap[claimStruct]; !exists {
+							claimsMap[claimStruct] = claimMapValue{claim: singleClaim + "\n", dependent: make([]string, 0),
+								dependentNumbers: make(map[claimMapKey]struct{})}
+						}
+					} else {
+						claimReferences := parseClaimReferences(claimObject)
+						if len(claimReferences) > 0 {
+							if key, exists := checkClaimMapKey(claimReferences[0], claimsMap); exists {
+								value, _ := claimsMap[key]
+								value.dependentNumbers[claimStruct] = struct{}{}
+								value.dependent = append(value.dependent, singleClaim)
+								claimsMap[key] = value
+							} else {
+								for independentClaimNumber, dependentClaims := range claimsMap {
+									if _, exists := checkDependentClaimMapKey(claimReferences[0], dependentClaims.dependentNumbers); exists {
+										dependentClaims.dependent = append(dependentClaims.dependent, singleClaim)
+										dependentClaims.dependentNumbers[claimStruct] = struct{}{}
+										claimsMap[independentClaimNumber] = dependentClaims
+									}
+								}
+							}
+						}
+
+					}
+					claimsIds[claimId] = struct{}{}
+				} else {
+					if key, exists := checkClaimMapKey(claimId, claimsMap); exists {
+						value, _ := claimsMap[key]
+						value.claim += singleClaim + "\n"
+						claimsMap[key] = value
+					} else {
+						claimReferences := parseClaimReferences(claimObject)
+						if len(claimReferences) > 0 {
+							if key, exists := checkClaimMapKey(claimReferences[0], claimsMap); exists {
+								value := claimsMap[key]
+								value.dependentNumbers[claimStruct] = struct{}{}
+								value.dependent = append(value.dependent, singleClaim)
+								claimsMap[key] = value
+							} else {
+								for independentClaimNumber, dependentClaim := range claimsMap {
+									if _, exists := checkDependentClaimMapKey(claimReferences[0], dependentClaim.dependentNumbers); exists {
+										value := claimsMap[independentClaimNumber]
+										value.dependentNumbers[claimStruct] = struct{}{}
+										value.dependent = append(value.dependent, singleClaim)
+										claimsMap[independentClaimNumber] = value
+									}
+								}
+							}
+						} else {
+							for independentClaimNumber, dependentClaim := range claimsMap {
+								if _, exists := checkDependentClaimMapKey(claimId, dependentClaim.dependentNumbers); exists {
+									value := claimsMap[independentClaimNumber]
+									value.dependent = append(value.dependent, singleClaim)
+									claimsMap[independentClaimNumber] = value
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	claims := make([]model.Claim, 0, len(claimsMap))
+	keys := make([]claimMapKey, 0, len(claimsMap))
+	for key := range claimsMap {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].claimNumber != keys[j].claimNumber {
+			return keys[i].claimNumber < keys[j].claimNumber
+		}
+		return keys[i].claimID < keys[j].claimID
+	})
+	numbers := make(map[int]string, len(claimsMap))
+	for _, key := range keys {
+		value := claimsMap[key]
+		// the claim number is part of the primary key
+		if other, exists := numbers[key.claimNumber]; exists {
+			r.log.Warn("dropping claim with duplicate number",
+				slog.String("op", "repository.parseClaim"),
+				slog.String("claim_id", key.claimID),
+				slog.String("conflicts_with", other),
+				slog.Int("claim_number", key.claimNumber),
+			)
+			continue
+		}
+		numbers[key.claimNumber] = key.claimID
+		claims = append(claims, model.Claim{
+			PatentID:         patentId,
+			ClaimNumber:      key.claimNumber,
+			IndependentClaim: value.claim,
+			DependantClaims:  value.dependent,
+		})
+	}
+	return &claims
+}
+
+func parseClaimReferences(claimObject map[string]interface{}) []string {
+	references, _ := claimObject["claimReferences"].([]interface{})
+	parsedReferences := make([]string, 0, len(references))
+	for _, reference := range references {
+		if parsedReference, ok := reference.(string); ok && parsedReference != "" {
+			parsedReferences = append(parsedReferences, parsedReference)
+		}
+	}
+	return parsedReferences
+}
+
+func checkClaimMapKey(claimId string, claimMap map[claimMapKey]claimMapValue) (claimMapKey, bool) {
+	for key, _ := range claimMap {
+		if key.claimID == claimId {
+			return key, true
+		}
+	}
+	return claimMapKey{}, false
+}
+
+func checkDependentClaimMapKey(claimId string, claimMap map[claimMapKey]struct{}) (claimMapKey, bool) {
+	for key, _ := range claimMap {
+		if key.claimID == claimId {
+			return key, true
+		}
+	}
+	return claimMapKey{}, false
+}
@@ -0,0 +1,70 @@
+package ktmine_repository
+
+import (
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseClaim(t *testing.T) {
+	repo := &KTMineRepository{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	claim := func(id string, dependent bool, text string, references ...interface{}) interface{} {
+		return map[string]interface{}{
+			"claimId":         id,
+			"isDependent":     dependent,
+			"xmlText":         "<claim-text>" + text + "</claim-text>",
+			"claimReferences": references,
+		}
+	}
+	tests := []struct {
+		name   string
+		claims []interface{}
+		want   map[int][]string
+	}{
+		{
+			name: "numbered ids",
+			claims: []interface{}{
+				claim("CLM-00001", false, "a device"),
+				claim("CLM-00002", true, "the device of claim 1", "CLM-00001"),
+				claim("CLM-00003", false, "a method"),
+			},
+			want: map[int][]string{1: {"the device of claim 1"}, 3: {}},
+		},
+		{
+			name: "ids without digits are numbered by position",
+			claims: []interface{}{
+				claim("first", false, "a device"),
+				claim("second", true, "the device", "first"),
+				claim("third", false, "a method"),
+			},
+			want: map[int][]string{1: {"the device"}, 3: {}},
+		},
+		{
+			name: "duplicate numbers keep one claim",
+			claims: []interface{}{
+				claim("CLM-00002", false, "a device"),
+				claim("other", false, "a method"),
+			},
+			want: map[int][]string{2: {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := repo.parseClaim(map[string]interface{}{"claimsXml": tt.claims}, uuid.New())
+			got := make(map[int][]string, len(*parsed))
+			for _, c := range *parsed {
+				dependents := make([]string, 0, len(c.DependantClaims))
+				for _, dependent := range c.DependantClaims {
+					dependents = append(dependents, strings.TrimSpace(dependent))
+				}
+				got[c.ClaimNumber] = dependents
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("claims = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,12 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/streadway/amqp"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
 	"log/slog"
+	"sync"
 	"time"
 )
 
@@ -13,98 +16,150 @@ type BrokerConfig struct {
 	ConsumeQueue  string
 	PublishQueue  string
 	PrefetchCount int
+	RequeueDelay  time.Duration
+	// Workers is the number of messages handled concurrently. It is capped at
+	// PrefetchCount, since more workers than deliveries would sit idle.
+	Workers int
+	// ShutdownTimeout is how long in-flight messages may run after the
+	// consumer is asked to stop.
+	ShutdownTimeout time.Duration
+	// ReconnectBaseWait and ReconnectMaxWait bound the backoff between
+	// connection attempts.
+	ReconnectBaseWait time.Duration
+	ReconnectMaxWait  time.Duration
+	// DeadLetterExchange and DeadLetterQueue receive the requests that failed
+	// permanently or MaxAttempts times. They default to the consume queue name
+	// suffixed with ".dlx" and ".dlq".
+	DeadLetterExchange string
+	DeadLetterQueue    string
+	MaxAttempts        int
+	// RetryMaxDelay caps the retry delay, which starts at RequeueDelay and
+	// doubles with every attempt.
+	RetryMaxDelay time.Duration
+	// EventExchange is declared as a durable topic exchange for the upload
+	// lifecycle events. Without it, EventRoutingKey names a queue that is
+	// declared instead.
+	EventExchange   string
+	EventRoutingKey string
 }
 
-type BrokerRepoStruct struct {
-	log          *slog.Logger
-	conn         *amqp.Connection
-	consumeCh    *amqp.Channel
-	publishCh    *amqp.Channel
-	consumeQueue amqp.Queue
-	publishQueue amqp.Queue
+func (c BrokerConfig) withDefaults() BrokerConfig {
+	if c.DeadLetterExchange == "" {
+		c.DeadLetterExchange = c.ConsumeQueue + ".dlx"
+	}
+	if c.DeadLetterQueue == "" {
+		c.DeadLetterQueue = c.ConsumeQueue + ".dlq"
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 1
+	}
+	return c
 }
 
-func NewBrokerRepo(cfg BrokerConfig, log *slog.Logger) *BrokerRepoStruct {
-	conn, err := amqp.Dial(cfg.URL)
-	if err != nil {
-		panic(fmt.Sprintf("rabbitmq dial: %w", err))
-	}
+const consumerTag = "patent-upload"
 
-	consumeCh, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		panic(fmt.Sprintf("open consume channel: %w", err))
-	}
+type BrokerRepoStruct struct {
+	log             *slog.Logger
+	cfg             BrokerConfig
+	shutdownTimeout time.Duration
+	workers         int
+	// done is closed by Close and stops the reconnection loop.
+	done      chan struct{}
+	closeOnce sync.Once
 
-	publishCh, err := conn.Channel()
-	if err != nil {
-		consumeCh.Close()
-		conn.Close()
-		panic(fmt.Sprintf("open publish channel: %w", err))
-	}
+	mu sync.RWMutex
+	// current is the open session, nil while disconnected. ready is closed
+	// once a session is open and replaced when it is lost.
+	current       *session
+	ready         chan struct{}
+	since         time.Time
+	lastErr       error
+	connectedOnce bool
+	reconnects    int
+}
 
-	cq, err := consumeCh.QueueDeclare(
-		cfg.ConsumeQueue,
-		true,  // durable
-		false, // auto-delete
-		false, // exclusive
-		false, // no-wait
-		nil,   // args
-	)
-	if err != nil {
-		consumeCh.Close()
-		publishCh.Close()
-		conn.Close()
-		panic(fmt.Sprintf("declare consume queue: %w", err))
-	}
-
-	pq, err := publishCh.QueueDeclare(
-		cfg.PublishQueue,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		consumeCh.Close()
-		publishCh.Close()
-		conn.Close()
-		panic(fmt.Sprintf("declare publish queue: %w", err))
+// NewBrokerRepo starts connecting to the broker in the background and keeps
+// reconnecting whenever the connection drops; the broker does not have to be
+// reachable at startup.
+func NewBrokerRepo(cfg BrokerConfig, log *slog.Logger) *BrokerRepoStruct {
+	cfg = cfg.withDefaults()
+	b := &BrokerRepoStruct{
+		log:             log,
+		cfg:             cfg,
+		shutdownTimeout: cfg.ShutdownTimeout,
+		workers:         consumerWorkers(cfg.Workers, cfg.PrefetchCount),
+		done:            make(chan struct{}),
+		ready:           make(chan struct{}),
+		since:           time.Now(),
 	}
+	go b.maintain()
+	return b
+}
 
-	if err := consumeCh.Qos(cfg.PrefetchCount, 0, false); err != nil {
-		consumeCh.Close()
-		publishCh.Close()
-		conn.Close()
-		panic(fmt.Sprintf("set QoS: %w", err))
+// consumerWorkers defaults the pool to the prefetch count and never exceeds
+// it; a prefetch count of 0 means no limit.
+func consumerWorkers(workers, prefetchCount int) int {
+	if workers <= 0 {
+		workers = prefetchCount
 	}
-
-	return &BrokerRepoStruct{
-		log:          log,
-		conn:         conn,
-		consumeCh:    consumeCh,
-		publishCh:    publishCh,
-		consumeQueue: cq,
-		publishQueue: pq,
+	if prefetchCount > 0 && workers > prefetchCount {
+		workers = prefetchCount
+	}
+	if workers <= 0 {
+		workers = 1
 	}
+	return workers
 }
 
 func (b *BrokerRepoStruct) Close() error {
-	b.consumeCh.Close()
-	b.publishCh.Close()
-	return b.conn.Close()
+	b.closeOnce.Do(func() { close(b.done) })
+	return nil
 }
 
+// ListenAndPublish consumes upload requests with a pool of workers, at most
+// one per prefetched message, and publishes each non-nil handler result before
+// acking the request. It waits while the broker is unreachable and resumes on every
+// new connection; messages in flight when a connection drops are cancelled,
+// since the broker redelivers them. When ctx is cancelled it stops taking
+// deliveries, requeues the ones not yet started and waits up to the shutdown
+// timeout for the running handlers, whose contexts are only cancelled once
+// that timeout expires. It returns nil after a clean shutdown.
 func (b *BrokerRepoStruct) ListenAndPublish(
 	ctx context.Context,
 	handler func(context.Context, []byte) ([]byte, error),
 ) error {
 	op := "repository.ListenAndPublish"
 	log := b.log.With(slog.String("op", op))
-	msgs, err := b.consumeCh.Consume(
-		b.consumeQueue.Name,
-		"",
+	for {
+		s, err := b.waitSession(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		err = b.consume(ctx, s, handler)
+		if err == nil {
+			return nil
+		}
+		log.Warn("consumer interrupted, waiting for the broker", slog.String("error", err.Error()))
+		// make sure the session is replaced before consuming again
+		s.shutDown(errors.New("consumer interrupted"))
+	}
+}
+
+// consume runs the worker pool on one session until ctx is cancelled, which
+// returns nil, or the session closes, which returns an error.
+func (b *BrokerRepoStruct) consume(
+	ctx context.Context,
+	s *session,
+	handler func(context.Context, []byte) ([]byte, error),
+) error {
+	op := "repository.consume"
+	log := b.log.With(slog.String("op", op))
+	msgs, err := s.consumeCh.Consume(
+		s.consumeQueue.Name,
+		consumerTag,
 		false, // autoAck
 		false, // exclusive
 		false, // noLocal
@@ -114,60 +169,146 @@ func (b *BrokerRepoStruct) ListenAndPublish(
 	if err != nil {
 		return fmt.Errorf("start consume: %w", err)
 	}
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-	for {
+
+	// handlers run on workCtx so that shutdown lets them finish
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	stopping := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
 		select {
+		case <-done:
+			return
+		case <-s.closed:
+			// their acks cannot reach the broker any more
+			cancelWork()
+			return
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			select {
-			case msg, ok := <-msgs:
-				start := time.Now()
-
-				if !ok {
-					return fmt.Errorf("consume channel closed")
-				}
-				fmt.Println(string(msg.Body))
-				if len(msg.Body) == 0 {
-					log.Info("Received empty message, skipping...")
+		}
+		close(stopping)
+		log.Info("stopping consumer, draining in-flight messages", slog.Duration("timeout", b.shutdownTimeout))
+		if err := s.consumeCh.Cancel(consumerTag, false); err != nil {
+			// closing the session ends the deliveries too; the broker
+			// requeues whatever is left unacked
+			log.Error("failed to cancel consumer, closing connection", slog.String("error", err.Error()))
+			s.shutDown(err)
+		}
+		timer := time.NewTimer(b.shutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			log.Warn("shutdown timeout expired, cancelling in-flight messages")
+			cancelWork()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < b.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				select {
+				case <-stopping:
+					// not started yet, another instance takes it
+					msg.Nack(false, true)
 					continue
+				default:
 				}
+				b.handleDelivery(workCtx, s, msg, handler)
+			}
+		}()
+	}
+	log.Info("consumer started", slog.Int("workers", b.workers), slog.String("queue", s.consumeQueue.Name))
+	wg.Wait()
+	close(done)
 
-				// Process the message
-				taskCtx, cancel := context.WithCancel(ctx)
-				result, err := handler(taskCtx, msg.Body)
-				cancel()
+	select {
+	case <-stopping:
+		log.Info("consumer stopped")
+		return nil
+	default:
+		return fmt.Errorf("consume channel closed")
+	}
+}
 
-				if err != nil {
-					log.Error(fmt.Sprintf("handler error: %v, Nack and requeue", err))
-					msg.Nack(false, false)
-					continue
-				}
+// handleDelivery runs the handler for one message and acks it once the result,
+// if any, is published. Failures go through fail, except that messages whose work was
+// cancelled by shutdown or a lost connection are requeued without counting an
+// attempt.
+func (b *BrokerRepoStruct) handleDelivery(
+	ctx context.Context,
+	s *session,
+	msg amqp.Delivery,
+	handler func(context.Context, []byte) ([]byte, error),
+) {
+	op := "repository.handleDelivery"
+	log := b.log.With(slog.String("op", op), slog.Uint64("delivery_tag", msg.DeliveryTag))
+	start := time.Now()
 
-				// Publish the result
-				if err := b.publishCh.Publish(
-					"", // default exchange
-					b.publishQueue.Name,
-					false, // mandatory
-					false, // immediate
-					amqp.Publishing{
-						DeliveryMode: amqp.Persistent,
-						ContentType:  "application/json",
-						Body:         result,
-					},
-				); err != nil {
-					log.Error(fmt.Sprintf("publish error: %v, Nack and requeue", err))
-					msg.Nack(false, true)
-					continue
-				}
+	if len(msg.Body) == 0 {
+		b.fail(ctx, s, msg, fmt.Errorf("%w: empty message", model.ErrInvalidPayload))
+		return
+	}
 
-				msg.Ack(false)
-				log.Info(fmt.Sprintf("%s", time.Since(start)))
+	correlationId := msg.CorrelationId
+	if correlationId == "" {
+		correlationId = msg.MessageId
+	}
+	result, err := handler(model.WithCorrelationId(ctx, correlationId), msg.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Warn("message interrupted, requeue", slog.String("error", err.Error()))
+			msg.Nack(false, true)
+			return
+		}
+		b.fail(ctx, s, msg, err)
+		return
+	}
 
-			default:
-				log.Info("No message, waiting for next tick...")
-			}
+	if result != nil {
+		err = s.publish("", s.publishQueue.Name, amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         result,
+		})
+		if err != nil {
+			b.fail(ctx, s, msg, fmt.Errorf("publish result: %w", err))
+			return
 		}
 	}
+
+	msg.Ack(false)
+	log.Info("message processed", slog.Duration("duration", time.Since(start)))
+}
+
+// Publish sends an outbox message and returns once the broker confirmed it.
+// A message without exchange and routing key goes to the result queue.
+func (b *BrokerRepoStruct) Publish(ctx context.Context, message model.OutboxMessage) error {
+	b.mu.RLock()
+	s := b.current
+	b.mu.RUnlock()
+	if s == nil {
+		return model.ErrBrokerUnavailable
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key := message.RoutingKey
+	if message.Exchange == "" && key == "" {
+		key = s.publishQueue.Name
+	}
+	err := s.publish(message.Exchange, key, amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  "application/json",
+		MessageId:    message.Id.String(),
+		Timestamp:    message.CreatedAt,
+		Body:         message.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("publish %s: %w", message.Key, err)
+	}
+	return nil
 }
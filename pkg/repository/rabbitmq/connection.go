@@ -0,0 +1,304 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// session is one broker connection with its channels, declared queues and
+// QoS. When any part of it closes the whole session is replaced.
+type session struct {
+	conn         *amqp.Connection
+	consumeCh    *amqp.Channel
+	publishCh    *amqp.Channel
+	consumeQueue amqp.Queue
+	publishQueue amqp.Queue
+	// publishMu serializes publishes on publishCh, which is in confirm mode,
+	// so that each publish reads its own confirmation from confirms.
+	publishMu sync.Mutex
+	confirms  chan amqp.Confirmation
+	// closed is closed once the connection or one of the channels closes;
+	// err then holds the reason.
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// dial connects to the broker and sets up everything a session needs.
+func dial(cfg BrokerConfig) (*session, error) {
+	conn, err := amqp.Dial(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq dial: %w", err)
+	}
+	s := &session{conn: conn, closed: make(chan struct{})}
+
+	if s.consumeCh, err = conn.Channel(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open consume channel: %w", err)
+	}
+	if s.publishCh, err = conn.Channel(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open publish channel: %w", err)
+	}
+	s.consumeQueue, err = s.consumeCh.QueueDeclare(
+		cfg.ConsumeQueue,
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("declare consume queue: %w", err)
+	}
+	s.publishQueue, err = s.publishCh.QueueDeclare(
+		cfg.PublishQueue,
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("declare publish queue: %w", err)
+	}
+	if err := declareDeadLetters(s.publishCh, cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := declareEvents(s.publishCh, cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := s.publishCh.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("enable publisher confirms: %w", err)
+	}
+	s.confirms = s.publishCh.NotifyPublish(make(chan amqp.Confirmation, 1))
+	if err := s.consumeCh.Qos(cfg.PrefetchCount, 0, false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("set QoS: %w", err)
+	}
+
+	s.watch(
+		conn.NotifyClose(make(chan *amqp.Error, 1)),
+		s.consumeCh.NotifyClose(make(chan *amqp.Error, 1)),
+		s.publishCh.NotifyClose(make(chan *amqp.Error, 1)),
+	)
+	return s, nil
+}
+
+// declareEvents declares where the upload lifecycle events go; binding queues
+// to the exchange is left to their consumers.
+func declareEvents(ch *amqp.Channel, cfg BrokerConfig) error {
+	if cfg.EventExchange != "" {
+		err := ch.ExchangeDeclare(
+			cfg.EventExchange,
+			amqp.ExchangeTopic,
+			true,  // durable
+			false, // auto-delete
+			false, // internal
+			false, // no-wait
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("declare event exchange: %w", err)
+		}
+		return nil
+	}
+	if cfg.EventRoutingKey != "" {
+		if _, err := ch.QueueDeclare(cfg.EventRoutingKey, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("declare event queue: %w", err)
+		}
+	}
+	return nil
+}
+
+// watch marks the session closed when the first of the close notifications
+// fires. The library closes the channels without an error on a clean close.
+func (s *session) watch(notifications ...chan *amqp.Error) {
+	for _, notification := range notifications {
+		go func(notification chan *amqp.Error) {
+			amqpErr, ok := <-notification
+			err := errors.New("closed")
+			if ok && amqpErr != nil {
+				err = amqpErr
+			}
+			s.shutDown(err)
+		}(notification)
+	}
+}
+
+func (s *session) shutDown(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.closed)
+		s.conn.Close()
+	})
+}
+
+// confirmTimeout bounds the wait for the broker to confirm a publish.
+const confirmTimeout = 30 * time.Second
+
+// publish sends msg and waits until the broker confirms it, so that a nil
+// error means the broker has taken responsibility for the message.
+func (s *session) publish(exchange, key string, msg amqp.Publishing) error {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+	err := s.publishCh.Publish(
+		exchange,
+		key,
+		false, // mandatory
+		false, // immediate
+		msg,
+	)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(confirmTimeout)
+	defer timer.Stop()
+	select {
+	case confirmation, ok := <-s.confirms:
+		if !ok {
+			return errors.New("publish channel closed before confirm")
+		}
+		if !confirmation.Ack {
+			return errors.New("broker rejected the message")
+		}
+		return nil
+	case <-s.closed:
+		return fmt.Errorf("connection closed before confirm: %w", s.err)
+	case <-timer.C:
+		// a late confirm would be read by the next publish
+		s.shutDown(errors.New("publish confirm timed out"))
+		return errors.New("publish confirm timed out")
+	}
+}
+
+// maintain keeps a session open until Close is called, redialing with
+// backoff whenever the current one closes.
+func (b *BrokerRepoStruct) maintain() {
+	op := "repository.maintain"
+	log := b.log.With(slog.String("op", op))
+
+	for attempt := 0; ; {
+		s, err := dial(b.cfg)
+		if err != nil {
+			b.setDisconnected(err)
+			wait := b.backoff(attempt)
+			attempt++
+			log.Warn("broker unreachable, retrying",
+				slog.String("error", err.Error()),
+				slog.Int("attempt", attempt),
+				slog.Duration("wait", wait),
+			)
+			timer := time.NewTimer(wait)
+			select {
+			case <-b.done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		attempt = 0
+		b.setSession(s)
+		log.Info("broker connected", slog.String("consume_queue", s.consumeQueue.Name))
+
+		select {
+		case <-b.done:
+			s.shutDown(errors.New("broker repository closed"))
+			b.setDisconnected(nil)
+			return
+		case <-s.closed:
+			log.Warn("broker connection lost", slog.String("error", s.err.Error()))
+			b.setDisconnected(s.err)
+		}
+	}
+}
+
+// backoff returns an exponential delay for the given attempt, jittered to
+// between half and one and a half times the nominal value.
+func (b *BrokerRepoStruct) backoff(attempt int) time.Duration {
+	wait := b.cfg.ReconnectBaseWait << attempt
+	if wait <= 0 || wait > b.cfg.ReconnectMaxWait {
+		wait = b.cfg.ReconnectMaxWait
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(wait))) + wait/2
+}
+
+func (b *BrokerRepoStruct) setSession(s *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.connectedOnce {
+		b.reconnects++
+	}
+	b.connectedOnce = true
+	b.current = s
+	b.since = time.Now()
+	b.lastErr = nil
+	close(b.ready)
+}
+
+func (b *BrokerRepoStruct) setDisconnected(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.current != nil {
+		b.current = nil
+		b.since = time.Now()
+		b.ready = make(chan struct{})
+	}
+	if err != nil {
+		b.lastErr = err
+	}
+}
+
+// waitSession returns the open session, waiting for the broker to connect.
+func (b *BrokerRepoStruct) waitSession(ctx context.Context) (*session, error) {
+	for {
+		b.mu.RLock()
+		s, ready := b.current, b.ready
+		b.mu.RUnlock()
+		if s != nil {
+			return s, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.done:
+			return nil, errors.New("broker repository closed")
+		case <-ready:
+		}
+	}
+}
+
+// Status reports whether the broker is connected and since when.
+func (b *BrokerRepoStruct) Status() model.BrokerStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	status := model.BrokerStatus{
+		Connected:  b.current != nil,
+		Reconnects: b.reconnects,
+	}
+	if !b.since.IsZero() {
+		since := b.since
+		status.Since = &since
+	}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	return status
+}
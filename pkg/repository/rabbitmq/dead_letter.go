@@ -0,0 +1,306 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
+	"time"
+)
+
+// Headers recorded on retried and dead-lettered upload requests.
+const (
+	headerAttempts      = "x-upload-attempts"
+	headerError         = "x-upload-error"
+	headerFailedAt      = "x-upload-failed-at"
+	headerOriginalQueue = "x-upload-original-queue"
+)
+
+// declareDeadLetters declares the dead-letter exchange and queue, and one
+// retry queue per delay. A retry queue holds a message for its delay and then
+// dead-letters it back to the consume queue. The delay is part of the queue
+// name, since a queue cannot be redeclared with another TTL.
+func declareDeadLetters(ch *amqp.Channel, cfg BrokerConfig) error {
+	if err := ch.ExchangeDeclare(cfg.DeadLetterExchange, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead-letter exchange: %w", err)
+	}
+	if _, err := ch.QueueDeclare(cfg.DeadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead-letter queue: %w", err)
+	}
+	if err := ch.QueueBind(cfg.DeadLetterQueue, cfg.ConsumeQueue, cfg.DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("bind dead-letter queue: %w", err)
+	}
+	for attempt := 1; attempt <= cfg.retries(); attempt++ {
+		delay := cfg.retryDelay(attempt)
+		_, err := ch.QueueDeclare(retryQueueName(cfg, delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             int64(delay / time.Millisecond),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": cfg.ConsumeQueue,
+		})
+		if err != nil {
+			return fmt.Errorf("declare retry queue: %w", err)
+		}
+	}
+	return nil
+}
+
+// retryDelay is the wait before the attempt after the given failed one.
+func (c BrokerConfig) retryDelay(failedAttempts int) time.Duration {
+	delay := c.RequeueDelay << (failedAttempts - 1)
+	if c.RetryMaxDelay > 0 && (delay <= 0 || delay > c.RetryMaxDelay) {
+		delay = c.RetryMaxDelay
+	}
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return delay
+}
+
+// retries is the number of retry queues. There is at least one, which also
+// holds requests while the patent search backend is unavailable.
+func (c BrokerConfig) retries() int {
+	return max(c.MaxAttempts-1, 1)
+}
+
+func retryQueueName(cfg BrokerConfig, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", cfg.ConsumeQueue, delay/time.Millisecond)
+}
+
+// permanent reports whether a failure will recur however often the request
+// is retried.
+func permanent(err error) bool {
+	return errors.Is(err, model.ErrInvalidPayload) || errors.Is(err, model.ErrInvalidFilters)
+}
+
+// fail records a failed attempt on a message. Transient failures are retried
+// through the retry queue of the attempt; permanent ones, and messages out of
+// attempts, go to the dead-letter queue with the reason attached. The message
+// is only acked once its copy is published. When that fails it is requeued,
+// which cannot count the attempt, so the requeue waits out the retry delay
+// rather than spin while the broker refuses the copy.
+//
+// A request turned away by an open circuit breaker is retried without
+// counting the attempt: the failure says nothing about the request, and an
+// outage must not use up its attempts.
+func (b *BrokerRepoStruct) fail(ctx context.Context, s *session, msg amqp.Delivery, cause error) {
+	op := "repository.fail"
+	upstreamDown := errors.Is(cause, model.ErrUpstreamUnavailable)
+	attempts := attemptsOf(msg.Headers)
+	if !upstreamDown {
+		attempts++
+	}
+	log := b.log.With(
+		slog.String("op", op),
+		slog.Uint64("delivery_tag", msg.DeliveryTag),
+		slog.Int("attempts", attempts),
+		slog.String("error", cause.Error()),
+	)
+
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	headers[headerAttempts] = int32(attempts)
+	headers[headerError] = cause.Error()
+	headers[headerFailedAt] = time.Now().UTC().Format(time.RFC3339)
+	headers[headerOriginalQueue] = s.consumeQueue.Name
+	copied := amqp.Publishing{
+		Headers:      headers,
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.MessageId,
+		Timestamp:    msg.Timestamp,
+		Body:         msg.Body,
+	}
+	if copied.MessageId == "" {
+		copied.MessageId = uuid.NewString()
+	}
+
+	exchange, key := b.cfg.DeadLetterExchange, s.consumeQueue.Name
+	delay := b.cfg.retryDelay(min(max(attempts, 1), b.cfg.retries()))
+	retry := upstreamDown || !permanent(cause) && attempts < b.cfg.MaxAttempts
+	if retry {
+		exchange, key = "", retryQueueName(b.cfg, delay)
+		log = log.With(slog.Duration("retry_in", delay))
+	}
+	if err := s.publish(exchange, key, copied); err != nil {
+		log.Error("failed to route failed message, requeue after delay",
+			slog.String("publish_error", err.Error()),
+			slog.Duration("requeue_in", delay),
+		)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-s.closed:
+			// the broker requeues unacked messages of a lost connection
+			return
+		case <-ctx.Done():
+		}
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
+	if upstreamDown {
+		log.Warn("backend unavailable, retry scheduled without counting the attempt")
+	} else if retry {
+		log.Warn("message failed, retry scheduled")
+	} else {
+		log.Error("message dead-lettered", slog.String("message_id", copied.MessageId))
+	}
+}
+
+// attemptsOf reads the failed attempt count, whatever integer type the
+// header arrived as.
+func attemptsOf(headers amqp.Table) int {
+	switch value := headers[headerAttempts].(type) {
+	case int8:
+		return int(value)
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case int:
+		return value
+	}
+	return 0
+}
+
+// ListDeadLetters returns up to input.Limit messages from the head of the
+// dead-letter queue. The messages stay in the queue: they are fetched without
+// acking and return to it when the channel closes.
+func (b *BrokerRepoStruct) ListDeadLetters(ctx context.Context, input model.DeadLetterListInput) ([]model.DeadLetter, error) {
+	deadLetters := make([]model.DeadLetter, 0)
+	err := b.withAdminChannel(ctx, func(_ *session, ch *amqp.Channel) error {
+		for len(deadLetters) < input.Limit {
+			msg, ok, err := ch.Get(b.cfg.DeadLetterQueue, false)
+			if err != nil {
+				return fmt.Errorf("read dead-letter queue: %w", err)
+			}
+			if !ok {
+				return nil
+			}
+			deadLetters = append(deadLetters, deadLetterOf(msg))
+		}
+		return nil
+	})
+	return deadLetters, err
+}
+
+// ReplayDeadLetters sends dead letters back to the consume queue with their
+// attempt count reset. Without message ids it replays the first input.Limit
+// messages; with ids it looks through the whole queue for them.
+func (b *BrokerRepoStruct) ReplayDeadLetters(ctx context.Context, input model.DeadLetterReplayInput) (model.DeadLetterReplayOutput, error) {
+	op := "repository.ReplayDeadLetters"
+	log := b.log.With(slog.String("op", op))
+
+	output := model.DeadLetterReplayOutput{MessageIds: make([]string, 0)}
+	wanted := make(map[string]struct{}, len(input.MessageIds))
+	for _, id := range input.MessageIds {
+		wanted[id] = struct{}{}
+	}
+	err := b.withAdminChannel(ctx, func(s *session, ch *amqp.Channel) error {
+		queue, err := ch.QueueInspect(b.cfg.DeadLetterQueue)
+		if err != nil {
+			return fmt.Errorf("inspect dead-letter queue: %w", err)
+		}
+		// messages read but not replayed return to the queue when the channel
+		// closes, so each is seen once
+		for scanned := 0; scanned < queue.Messages; scanned++ {
+			if len(wanted) == 0 && output.Replayed >= input.Limit {
+				return nil
+			}
+			if len(wanted) > 0 && output.Replayed == len(wanted) {
+				return nil
+			}
+			msg, ok, err := ch.Get(b.cfg.DeadLetterQueue, false)
+			if err != nil {
+				return fmt.Errorf("read dead-letter queue: %w", err)
+			}
+			if !ok {
+				return nil
+			}
+			if _, selected := wanted[msg.MessageId]; len(wanted) > 0 && !selected {
+				continue
+			}
+			headers := amqp.Table{}
+			for key, value := range msg.Headers {
+				headers[key] = value
+			}
+			for _, key := range []string{headerAttempts, headerError, headerFailedAt, headerOriginalQueue} {
+				delete(headers, key)
+			}
+			original, _ := msg.Headers[headerOriginalQueue].(string)
+			if original == "" {
+				original = b.cfg.ConsumeQueue
+			}
+			// the dead letter is only removed once the broker has confirmed its
+			// copy; on failure it returns to the queue with the channel
+			err = s.publish("", original, amqp.Publishing{
+				Headers:      headers,
+				ContentType:  msg.ContentType,
+				DeliveryMode: amqp.Persistent,
+				MessageId:    msg.MessageId,
+				Timestamp:    msg.Timestamp,
+				Body:         msg.Body,
+			})
+			if err != nil {
+				return fmt.Errorf("replay %s: %w", msg.MessageId, err)
+			}
+			if err := msg.Ack(false); err != nil {
+				return fmt.Errorf("remove replayed %s: %w", msg.MessageId, err)
+			}
+			output.Replayed++
+			output.MessageIds = append(output.MessageIds, msg.MessageId)
+		}
+		return nil
+	})
+	if output.Replayed > 0 {
+		log.Info("replayed dead letters", slog.Int("replayed", output.Replayed))
+	}
+	return output, err
+}
+
+// withAdminChannel runs fn on a channel of its own, so fetched but unacked
+// messages are requeued when it closes and never mix with the consumer's.
+// fn also gets the session, to publish with confirms.
+func (b *BrokerRepoStruct) withAdminChannel(ctx context.Context, fn func(s *session, ch *amqp.Channel) error) error {
+	b.mu.RLock()
+	s := b.current
+	b.mu.RUnlock()
+	if s == nil {
+		return model.ErrBrokerUnavailable
+	}
+	ch, err := s.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("%w: %w", model.ErrBrokerUnavailable, err)
+	}
+	defer ch.Close()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(s, ch)
+}
+
+func deadLetterOf(msg amqp.Delivery) model.DeadLetter {
+	reason, _ := msg.Headers[headerError].(string)
+	original, _ := msg.Headers[headerOriginalQueue].(string)
+	deadLetter := model.DeadLetter{
+		MessageId:     msg.MessageId,
+		Reason:        reason,
+		Attempts:      attemptsOf(msg.Headers),
+		OriginalQueue: original,
+		Body:          string(msg.Body),
+	}
+	if value, ok := msg.Headers[headerFailedAt].(string); ok {
+		if failedAt, err := time.Parse(time.RFC3339, value); err == nil {
+			deadLetter.FailedAt = &failedAt
+		}
+	}
+	return deadLetter
+}
@@ -2,20 +2,23 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository/db_repository"
+	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository/file_repository"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository/ktmine_repository"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository/rabbitmq"
 	"log/slog"
 )
 
 type Repository struct {
-	KTMineRepositoryInterface
+	PatentProvider
 	DBRepository
 	BrokerRepository
+	UploadJobRepository
 }
 
 func NewRepository(log *slog.Logger, cfg *config.Config) *Repository {
@@ -32,27 +35,88 @@ func NewRepository(log *slog.Logger, cfg *config.Config) *Repository {
 		panic(err)
 	}
 
+	if err := db_repository.NewMigrator(db, log).CheckSchema(context.Background()); err != nil {
+		panic(err)
+	}
+
 	brokerConfig := rabbitmq.BrokerConfig{
-		URL:           cfg.BrokerURL,
-		ConsumeQueue:  cfg.BrokerConsumeQueue,
-		PublishQueue:  cfg.BrokerPublishQueue,
-		PrefetchCount: cfg.BrokerPrefetchCount,
+		URL:                cfg.BrokerURL,
+		ConsumeQueue:       cfg.BrokerConsumeQueue,
+		PublishQueue:       cfg.BrokerPublishQueue,
+		PrefetchCount:      cfg.BrokerPrefetchCount,
+		RequeueDelay:       cfg.BrokerRequeueDelay,
+		Workers:            cfg.BrokerConsumerWorkers,
+		ShutdownTimeout:    cfg.BrokerShutdownTimeout,
+		ReconnectBaseWait:  cfg.BrokerReconnectBaseWait,
+		ReconnectMaxWait:   cfg.BrokerReconnectMaxWait,
+		DeadLetterExchange: cfg.BrokerDeadLetterExchange,
+		DeadLetterQueue:    cfg.BrokerDeadLetterQueue,
+		MaxAttempts:        cfg.BrokerMaxAttempts,
+		RetryMaxDelay:      cfg.BrokerRetryMaxDelay,
+		EventExchange:      cfg.UploadEventsExchange,
+		EventRoutingKey:    cfg.UploadEventsRoutingKey,
 	}
 	return &Repository{
-		KTMineRepositoryInterface: ktmine_repository.NewKTMineRepository(log, cfg),
-		DBRepository:              db_repository.NewDBRepository(db, log, cfg),
-		BrokerRepository:          rabbitmq.NewBrokerRepo(brokerConfig, log),
+		PatentProvider:      newPatentProvider(log, cfg),
+		DBRepository:        db_repository.NewDBRepository(db, log, cfg),
+		BrokerRepository:    rabbitmq.NewBrokerRepo(brokerConfig, log),
+		UploadJobRepository: db_repository.NewUploadJobRepository(db, log),
 	}
 }
 
-type KTMineRepositoryInterface interface {
-	GetFilteredData(ctx context.Context, filters model.FilterInterface) (*[]byte, error)
+func newPatentProvider(log *slog.Logger, cfg *config.Config) PatentProvider {
+	switch cfg.PatentProvider {
+	case "", "ktmine":
+		return ktmine_repository.NewKTMineRepository(log, cfg)
+	case "file":
+		return file_repository.NewFileRepository(log, cfg.PatentFilesDir)
+	default:
+		panic(fmt.Sprintf("unknown patent provider %q", cfg.PatentProvider))
+	}
+}
+
+// PatentProvider is a source of patents. Implementations translate the parsed
+// filters into their own query language and return normalized records, so the
+// services never see a provider's wire format.
+type PatentProvider interface {
+	SearchPatents(ctx context.Context, query model.PatentQuery) ([]model.FilteredFullPatent, error)
+	GetStatistics(ctx context.Context, filters []model.SingleParsedFilter) (*model.PatentStatistics, error)
+	Status() model.CircuitBreakerStatus
+	// SearchRequest returns the request SearchPatents would send for query,
+	// with credentials redacted.
+	SearchRequest(query model.PatentQuery) model.FiltersRequestBody
 }
 
 type DBRepository interface {
-	SavePatents(ctx context.Context, patents []model.FilteredFullPatent, transactionId, bundleId uuid.UUID) error
+	SavePatents(ctx context.Context, patents []model.FilteredFullPatent, transactionId, bundleId uuid.UUID) (model.SaveStats, error)
+	NewPatentWriter(ctx context.Context, atomic bool) (PatentWriter, error)
+	ListPatents(ctx context.Context, input model.PatentListInput) ([]model.StoredPatent, error)
+	ListTransactionFamilyMembers(ctx context.Context, transactionId uuid.UUID) ([]model.FamilyMember, error)
+	SuppressFamilyMembers(ctx context.Context, transactionId, bundleId uuid.UUID, suppressions []model.FamilySuppression) error
+	CitationNeighbourhood(ctx context.Context, input model.CitationNeighbourhoodInput) (*model.CitationNeighbourhood, error)
+	QueueOutboxMessage(ctx context.Context, message model.OutboxMessage) error
+	RelayOutbox(ctx context.Context, limit int, publish func(context.Context, model.OutboxMessage) error) (int, error)
 }
 
 type BrokerRepository interface {
 	ListenAndPublish(ctx context.Context, handler func(context.Context, []byte) ([]byte, error)) error
+	Status() model.BrokerStatus
+	ListDeadLetters(ctx context.Context, input model.DeadLetterListInput) ([]model.DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, input model.DeadLetterReplayInput) (model.DeadLetterReplayOutput, error)
+	Publish(ctx context.Context, message model.OutboxMessage) error
+}
+
+type PatentWriter = db_repository.PatentWriter
+
+type UploadJobRepository interface {
+	CreateUploadJob(ctx context.Context, job model.UploadJob) error
+	StartUploadJob(ctx context.Context, transactionId uuid.UUID, totalPatents int) error
+	AddUploadJobProgress(ctx context.Context, transactionId uuid.UUID, pages, parsed int) error
+	FinishUploadJob(ctx context.Context, transactionId uuid.UUID, state model.UploadJobState, errMessage string) error
+	// CompleteUploadJob marks the job completed and queues messages in the
+	// outbox within the same transaction.
+	CompleteUploadJob(ctx context.Context, transactionId uuid.UUID, messages ...model.OutboxMessage) error
+	ListUploadJobCheckpoints(ctx context.Context, transactionId uuid.UUID) ([]int, error)
+	GetUploadJob(ctx context.Context, transactionId uuid.UUID) (*model.UploadJob, error)
+	ListUploadJobs(ctx context.Context, input model.UploadJobListInput) ([]model.UploadJob, error)
 }
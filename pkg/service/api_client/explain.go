@@ -0,0 +1,101 @@
+package api_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"reflect"
+	"strings"
+)
+
+// ExplainFilters is a dry run of a filter upload: it parses the filters,
+// counts the matching patents and estimates the provider traffic a full
+// upload would cause. Nothing is fetched beyond the statistics call.
+func (c *APIClient) ExplainFilters(ctx context.Context, filters model.Filters) (*model.FilterExplanation, error) {
+	// the warnings name the fields as the caller sent them
+	warnings := filterWarnings(filters)
+	filters.Sanitize()
+	parsedFilters, err := c.ParseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	_, totalFound, err := c.GetStatistics(ctx, parsedFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	request := c.repo.SearchRequest(model.PatentQuery{
+		Filters: parsedFilters,
+		Limit:   model.UploadPageSize,
+		Full:    true,
+	})
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	// one statistics call plus one call per page, each carrying the same filters
+	pages := (totalFound + model.UploadPageSize - 1) / model.UploadPageSize
+	explanation := &model.FilterExplanation{
+		Request:               request,
+		TotalFound:            totalFound,
+		PageSize:              model.UploadPageSize,
+		EstimatedCalls:        pages + 1,
+		EstimatedPayloadBytes: (pages + 1) * len(body),
+		Warnings:              warnings,
+	}
+	if totalFound == 0 {
+		explanation.Warnings = append(explanation.Warnings, "no patents match the filters")
+	}
+	return explanation, nil
+}
+
+// filterWarnings lists the parts of the filters an upload ignores or that
+// carry no criteria.
+func filterWarnings(filters model.Filters) []string {
+	warnings := make([]string, 0)
+	v := reflect.ValueOf(filters)
+	t := reflect.TypeOf(filters)
+	for i := 0; i < v.NumField(); i++ {
+		fieldValue := v.Field(i)
+		if fieldValue.IsNil() {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+
+		switch value := fieldValue.Interface().(type) {
+		case *int:
+			warnings = append(warnings, fmt.Sprintf("%s is ignored, an upload fetches every matching patent", name))
+		case *bool:
+			warnings = append(warnings, fmt.Sprintf("%s is ignored by uploads", name))
+		case *string:
+			if strings.TrimSpace(*value) == "" {
+				warnings = append(warnings, fmt.Sprintf("%s is empty", name))
+			}
+		case *[]string:
+			if len(*value) == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s has no values", name))
+			}
+			for j, criterion := range *value {
+				if strings.TrimSpace(criterion) == "" {
+					warnings = append(warnings, fmt.Sprintf("%s[%d] is empty", name, j))
+				}
+			}
+		case *[]model.SingleFilter:
+			if len(*value) == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s has no values", name))
+			}
+			for j, filter := range *value {
+				if strings.TrimSpace(filter.Value) == "" {
+					warnings = append(warnings, fmt.Sprintf("%s[%d] has an empty value", name, j))
+				}
+			}
+		case *[]model.DateInFilter:
+			if len(*value) == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s has no ranges", name))
+			}
+		}
+	}
+	return warnings
+}
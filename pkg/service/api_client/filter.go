@@ -2,8 +2,6 @@ package api_client
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
 	"golang.org/x/sync/errgroup"
@@ -12,24 +10,6 @@ import (
 	"sync"
 )
 
-var returnFields = []string{
-	"legal_status",
-	"current_assignee",
-	"inventor",
-	"titles",
-	"current_owner",
-	"expiration_date",
-	"assignee",
-	"priority_claims",
-	"app_pub_references",
-}
-
-var fullPatentReturnFields = []string{
-	"descriptions",
-	"abstract",
-	"images",
-}
-
 type FilteredResponse struct {
 	mu       sync.Mutex
 	response *[]model.FilteredPatent
@@ -100,94 +80,55 @@ func (c *APIClient) getFilteredChunk(
 	preFilter *bool,
 	response *[]model.FilteredPatent,
 ) error {
-	patents, err := c.repo.GetFilteredData(
-		ctx, model.NewFilterRequestBody(parsedFilters, c.cfg.KTMineAPIKey, offset, 5, preFilter, returnFields),
-	)
+	patents, err := c.repo.SearchPatents(ctx, model.PatentQuery{
+		Filters:   parsedFilters,
+		Offset:    offset,
+		Limit:     5,
+		PreFilter: preFilter,
+	})
 	if err != nil {
 		return err
 	}
-	if err = c.parseFilteredResponse(patents, response); err != nil {
-		return err
+	for _, patent := range patents {
+		*response = append(*response, patent.Patent)
 	}
 	return nil
 }
 
-func (c *APIClient) GetFilteredChunkFullPatentRaw(
+func (c *APIClient) GetFilteredChunkFullPatents(
 	ctx context.Context,
 	parsedFilters []model.SingleParsedFilter,
 	offset int,
 	limit int,
-) (*[]byte, error) {
-	returnFieldsFull := append(returnFields, fullPatentReturnFields...)
-	patents, err := c.repo.GetFilteredData(
-		ctx, model.NewFilterRequestBody(parsedFilters, c.cfg.KTMineAPIKey, offset, limit, nil, returnFieldsFull),
-	)
-	return patents, err
+) ([]model.FilteredFullPatent, error) {
+	return c.repo.SearchPatents(ctx, model.PatentQuery{
+		Filters: parsedFilters,
+		Offset:  offset,
+		Limit:   limit,
+		Full:    true,
+	})
 }
 
 func (c *APIClient) GetStatistics(
 	ctx context.Context,
 	parsedFilters []model.SingleParsedFilter,
 ) (*map[string]interface{}, int, error) {
-	response, err := c.repo.GetFilteredData(ctx, model.NewStatisticsRequestBody(parsedFilters, c.cfg.KTMineAPIKey))
-	if err != nil {
-		return nil, 0, err
-	}
-
-	result, totalPatents, err := c.parseStatistics(response)
+	statistics, err := c.repo.GetStatistics(ctx, parsedFilters)
 	if err != nil {
 		return nil, 0, err
 	}
-	return result, totalPatents, nil
-}
-
-func (c *APIClient) parseFilteredResponse(patents *[]byte, parsedResponse *[]model.FilteredPatent) error {
-	var data map[string]interface{}
-	err := json.Unmarshal(*patents, &data)
-	if err != nil {
-		return err
-	}
-	response, ok := data["response"].(map[string]interface{})
-	if !ok {
-		return errors.New("can't parse response body")
-	}
-	items, ok := response["items"].([]interface{})
-	for _, patent := range items {
-		parsedPatent := c.parseFilteredPatent(patent)
-		*parsedResponse = append(*parsedResponse, parsedPatent)
-	}
-	return nil
-}
-
-func (c *APIClient) parseTermsFilters(termFilter string) string {
-	var builder strings.Builder
-
-	fields := []string{
-		"invention_title",
-		"descriptions.plain_text",
-		"claims.plain_text",
-		"abstract_paragraphs.plain_text",
-	}
-
-	builder.WriteString("(")
-
-	for i, field := range fields {
-		if i > 0 {
-			builder.WriteString(" OR ")
-		}
-		builder.WriteString(fmt.Sprintf("%s:(%s)", field, termFilter))
-	}
-
-	builder.WriteString(")")
-
-	return builder.String()
+	return &statistics.Aggregations, statistics.TotalFound, nil
 }
 
 func (c *APIClient) ParseFilters(filters model.Filters) ([]model.SingleParsedFilter, error) {
 	var parsedFilters []model.SingleParsedFilter
 
-	if filters.TermsFilters != nil {
-		parsedFilters = append(parsedFilters, *model.NewSingleParsedFilter([]string{c.parseTermsFilters(*filters.TermsFilters)}, "fulltext", nil))
+	if filters.TermsFilters != nil && strings.TrimSpace(*filters.TermsFilters) != "" {
+		termsFilters, err := c.parseTermsFilters(*filters.TermsFilters)
+		if err != nil {
+			return nil, err
+		}
+		parsedFilters = append(parsedFilters, termsFilters...)
 	}
 
 	v := reflect.ValueOf(filters)
@@ -210,23 +151,22 @@ func (c *APIClient) ParseFilters(filters model.Filters) ([]model.SingleParsedFil
 		switch fieldValue.Interface().(type) {
 		case *[]model.DateInFilter:
 			dateFilters := fieldValue.Interface().(*[]model.DateInFilter)
-			if len(*dateFilters) > 0 {
-				dateFiltersParsed := *dateFilters
-				minStr := dateFiltersParsed[0].Min.Format("2006-01-02")
-				maxStr := dateFiltersParsed[0].Max.Format("2006-01-02")
-
-				parsedFilters = append(parsedFilters, *model.NewSingleParsedFilter(
-					[]string{minStr, maxStr}, key, nil))
+			groups, err := groupDateRanges(*dateFilters, field.Tag.Get("json"))
+			if err != nil {
+				return nil, err
+			}
+			for _, group := range groups {
+				parsedFilters = append(parsedFilters, *model.NewSingleParsedFilter(group.criteria, key, &group.operator))
 			}
 
 		case *[]model.SingleFilter:
 			singleFilters := fieldValue.Interface().(*[]model.SingleFilter)
-			if len(*singleFilters) > 0 {
-				var criteria []string
-				for _, filter := range *singleFilters {
-					criteria = append(criteria, filter.Value)
-				}
-				parsedFilters = append(parsedFilters, *model.NewSingleParsedFilter(criteria, key, nil))
+			groups, err := groupByOperator(*singleFilters, field.Tag.Get("json"))
+			if err != nil {
+				return nil, err
+			}
+			for _, group := range groups {
+				parsedFilters = append(parsedFilters, *model.NewSingleParsedFilter(group.criteria, key, &group.operator))
 			}
 
 		case *[]string:
@@ -238,5 +178,95 @@ func (c *APIClient) ParseFilters(filters model.Filters) ([]model.SingleParsedFil
 		}
 	}
 
+	if err := normalizeCPCFilters(parsedFilters); err != nil {
+		return nil, err
+	}
 	return parsedFilters, nil
 }
+
+// cpcSearchFields are the filters whose criteria are CPC hierarchy patterns.
+var cpcSearchFields = map[string]bool{
+	"patent.toplevelcpc": true,
+	"patent.cpccode":     true,
+}
+
+// normalizeCPCFilters validates CPC criteria and rewrites them in the
+// canonical form of model.CPCPattern, so "h04l 9/32*" is sent and matched
+// locally as "H04L9/32*".
+func normalizeCPCFilters(filters []model.SingleParsedFilter) error {
+	for i := range filters {
+		if !cpcSearchFields[filters[i].SearchField] {
+			continue
+		}
+		criteria := make([]string, 0, len(filters[i].Criteria))
+		for _, criterion := range filters[i].Criteria {
+			pattern, err := model.ParseCPCPattern(criterion)
+			if err != nil {
+				return fmt.Errorf("%w: %w", model.ErrInvalidFilters, err)
+			}
+			criteria = append(criteria, pattern.String())
+		}
+		filters[i].Criteria = criteria
+	}
+	return nil
+}
+
+type operatorGroup struct {
+	operator model.UploadFilterOperator
+	criteria []string
+}
+
+// groupByOperator splits the values of one filter field into one group per
+// operator, in the order the operators first appear. Values without an
+// operator fall into the "and" group.
+func groupByOperator(filters []model.SingleFilter, fieldName string) ([]operatorGroup, error) {
+	groups := make([]operatorGroup, 0, 1)
+	index := make(map[model.UploadFilterOperator]int)
+	for _, filter := range filters {
+		operator := model.AndOperator
+		if filter.Operator != nil {
+			operator = model.UploadFilterOperator(strings.ToLower(string(*filter.Operator)))
+		}
+		if !operator.Valid() {
+			return nil, fmt.Errorf("%w: unknown operator %q for %s", model.ErrInvalidFilters, *filter.Operator,
+				strings.Split(fieldName, ",")[0])
+		}
+		i, exists := index[operator]
+		if !exists {
+			i = len(groups)
+			index[operator] = i
+			groups = append(groups, operatorGroup{operator: operator})
+		}
+		groups[i].criteria = append(groups[i].criteria, filter.Value)
+	}
+	return groups, nil
+}
+
+// groupDateRanges validates the ranges of one date field and groups them by
+// operator. Each group's criteria are the flattened [min, max] pairs of its
+// ranges, with model.OpenDateBound for an omitted bound.
+func groupDateRanges(ranges []model.DateInFilter, fieldName string) ([]operatorGroup, error) {
+	fieldName = strings.Split(fieldName, ",")[0]
+	groups := make([]operatorGroup, 0, 1)
+	index := make(map[model.UploadFilterOperator]int)
+	for _, dateRange := range ranges {
+		if err := dateRange.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", model.ErrInvalidFilters, fieldName, err)
+		}
+		operator := model.OrOperator
+		if dateRange.Operator != nil {
+			operator = model.UploadFilterOperator(strings.ToLower(string(*dateRange.Operator)))
+		}
+		if !operator.Valid() {
+			return nil, fmt.Errorf("%w: unknown operator %q for %s", model.ErrInvalidFilters, *dateRange.Operator, fieldName)
+		}
+		i, exists := index[operator]
+		if !exists {
+			i = len(groups)
+			index[operator] = i
+			groups = append(groups, operatorGroup{operator: operator})
+		}
+		groups[i].criteria = append(groups[i].criteria, dateRange.Bounds()...)
+	}
+	return groups, nil
+}
@@ -0,0 +1,205 @@
+package api_client
+
+import (
+	"errors"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func operator(name string) *model.UploadFilterOperator {
+	op := model.UploadFilterOperator(name)
+	return &op
+}
+
+func date(value string) *model.CustomDate {
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return &model.CustomDate{Time: parsed}
+}
+
+func TestGroupByOperator(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []model.SingleFilter
+		want    []operatorGroup
+	}{
+		{
+			name:    "no operator defaults to and",
+			filters: []model.SingleFilter{{Value: "Acme"}, {Value: "Globex"}},
+			want:    []operatorGroup{{operator: model.AndOperator, criteria: []string{"Acme", "Globex"}}},
+		},
+		{
+			name: "groups in order of first appearance",
+			filters: []model.SingleFilter{
+				{Value: "Acme", Operator: operator("or")},
+				{Value: "Initech", Operator: operator("not")},
+				{Value: "Globex", Operator: operator("or")},
+				{Value: "Umbrella"},
+			},
+			want: []operatorGroup{
+				{operator: model.OrOperator, criteria: []string{"Acme", "Globex"}},
+				{operator: model.NotOperator, criteria: []string{"Initech"}},
+				{operator: model.AndOperator, criteria: []string{"Umbrella"}},
+			},
+		},
+		{
+			name: "mixed case operators share a group",
+			filters: []model.SingleFilter{
+				{Value: "Acme", Operator: operator("OR")},
+				{Value: "Globex", Operator: operator("Or")},
+				{Value: "Initech", Operator: operator("NOT")},
+				{Value: "Umbrella", Operator: operator("And")},
+			},
+			want: []operatorGroup{
+				{operator: model.OrOperator, criteria: []string{"Acme", "Globex"}},
+				{operator: model.NotOperator, criteria: []string{"Initech"}},
+				{operator: model.AndOperator, criteria: []string{"Umbrella"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := groupByOperator(tt.filters, "current_assignee,omitempty")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupDateRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []model.DateInFilter
+		want   []operatorGroup
+	}{
+		{
+			name:   "open bounds",
+			ranges: []model.DateInFilter{{Min: date("2020-01-01")}, {Max: date("2010-12-31")}},
+			want: []operatorGroup{{operator: model.OrOperator, criteria: []string{
+				"2020-01-01", model.OpenDateBound, model.OpenDateBound, "2010-12-31",
+			}}},
+		},
+		{
+			name: "ranges with the same operator are merged into one group",
+			ranges: []model.DateInFilter{
+				{Min: date("2001-01-01"), Max: date("2001-12-31"), Operator: operator("OR")},
+				{Min: date("2005-01-01"), Max: date("2005-06-30"), Operator: operator("not")},
+				{Min: date("2003-01-01"), Max: date("2003-12-31"), Operator: operator("or")},
+			},
+			want: []operatorGroup{
+				{operator: model.OrOperator, criteria: []string{
+					"2001-01-01", "2001-12-31", "2003-01-01", "2003-12-31",
+				}},
+				{operator: model.NotOperator, criteria: []string{"2005-01-01", "2005-06-30"}},
+			},
+		},
+		{
+			name:   "and ranges",
+			ranges: []model.DateInFilter{{Min: date("2001-01-01"), Operator: operator("AND")}},
+			want: []operatorGroup{{operator: model.AndOperator, criteria: []string{
+				"2001-01-01", model.OpenDateBound,
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := groupDateRanges(tt.ranges, "publication_date,omitempty")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupingRejectsInvalidFilters(t *testing.T) {
+	tests := []struct {
+		name  string
+		group func() error
+	}{
+		{
+			name: "unknown operator",
+			group: func() error {
+				_, err := groupByOperator([]model.SingleFilter{{Value: "Acme", Operator: operator("xor")}}, "inventor")
+				return err
+			},
+		},
+		{
+			name: "unknown date operator",
+			group: func() error {
+				_, err := groupDateRanges([]model.DateInFilter{
+					{Min: date("2001-01-01"), Operator: operator("nand")},
+				}, "application_date")
+				return err
+			},
+		},
+		{
+			name: "empty date range",
+			group: func() error {
+				_, err := groupDateRanges([]model.DateInFilter{{}}, "application_date")
+				return err
+			},
+		},
+		{
+			name: "min after max",
+			group: func() error {
+				_, err := groupDateRanges([]model.DateInFilter{
+					{Min: date("2005-01-01"), Max: date("2001-01-01")},
+				}, "application_date")
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.group(); !errors.Is(err, model.ErrInvalidFilters) {
+				t.Errorf("got error %v, want ErrInvalidFilters", err)
+			}
+		})
+	}
+}
+
+func TestParseFiltersGroupsFields(t *testing.T) {
+	filters := model.Filters{
+		CurrentAssignee: &[]model.SingleFilter{
+			{Value: "Acme", Operator: operator("Or")},
+			{Value: "Globex", Operator: operator("or")},
+			{Value: "Initech", Operator: operator("NOT")},
+		},
+		PublicationDate: &[]model.DateInFilter{
+			{Min: date("2001-01-01"), Max: date("2001-12-31")},
+			{Min: date("2003-01-01")},
+		},
+	}
+	got, err := (&APIClient{}).ParseFilters(filters)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []model.SingleParsedFilter{
+		{
+			SearchField:    "patent.publicationdate",
+			Criteria:       []string{"2001-01-01", "2001-12-31", "2003-01-01", model.OpenDateBound},
+			FilterOperator: operator("or"),
+		},
+		{SearchField: "patent.currentassignee", Criteria: []string{"Acme", "Globex"}, FilterOperator: operator("or")},
+		{SearchField: "patent.currentassignee", Criteria: []string{"Initech"}, FilterOperator: operator("not")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	filters.Inventor = &[]model.SingleFilter{{Value: "Ada", Operator: operator("maybe")}}
+	if _, err := (&APIClient{}).ParseFilters(filters); !errors.Is(err, model.ErrInvalidFilters) {
+		t.Errorf("got error %v, want ErrInvalidFilters", err)
+	}
+}
@@ -0,0 +1,188 @@
+package api_client
+
+import (
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/query"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// queryFields maps the field prefixes of the query language to KTMine fields.
+// The empty prefix is the default full-text search.
+var queryFields = map[string][]string{
+	"":    {"invention_title", "abstract_paragraphs.plain_text", "claims.plain_text", "descriptions.plain_text"},
+	"ti":  {"invention_title"},
+	"ab":  {"abstract_paragraphs.plain_text"},
+	"cl":  {"claims.plain_text"},
+	"de":  {"descriptions.plain_text"},
+	"cpc": {"classifications_cpc.symbol"},
+	"as":  {"current_assignee.party_name"},
+}
+
+// structuredQueryFields are the prefixes that have a filter of their own. A
+// top-level clause on one of them is sent as that filter instead of as text.
+var structuredQueryFields = map[string]string{
+	"cpc": "cpc_code",
+	"as":  "current_assignee",
+}
+
+const luceneSpecialCharacters = `+-&|!(){}[]^"~*?:\/`
+
+// parseTermsFilters translates a query in the terms filter language into the
+// structured filters it implies plus one full-text filter for the rest.
+func (c *APIClient) parseTermsFilters(termFilter string) ([]model.SingleParsedFilter, error) {
+	root, err := query.Parse(termFilter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", model.ErrInvalidFilters, err)
+	}
+	var fieldErr error
+	root.Walk(func(node *query.Node) bool {
+		if _, ok := queryFields[node.Field]; !ok {
+			fieldErr = &query.SyntaxError{Pos: node.Pos, Message: fmt.Sprintf(
+				"unknown field %q, expected one of ti, ab, cl, de, cpc, as", node.Field)}
+			return false
+		}
+		return true
+	})
+	if fieldErr != nil {
+		return nil, fmt.Errorf("%w: %w", model.ErrInvalidFilters, fieldErr)
+	}
+
+	conjuncts := []*query.Node{root}
+	if root.Kind == query.KindAnd {
+		conjuncts = root.Children
+	}
+
+	type groupKey struct {
+		field    string
+		operator model.UploadFilterOperator
+	}
+	groups := make(map[groupKey][]string)
+	order := make([]groupKey, 0)
+	remainder := make([]*query.Node, 0, len(conjuncts))
+	for _, conjunct := range conjuncts {
+		field, operator, values, ok := structuredClause(conjunct)
+		if !ok {
+			remainder = append(remainder, conjunct)
+			continue
+		}
+		key := groupKey{field: field, operator: operator}
+		if _, exists := groups[key]; !exists {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], values...)
+	}
+
+	parsedFilters := make([]model.SingleParsedFilter, 0, len(order)+1)
+	if len(remainder) > 0 {
+		fullText := remainder[0]
+		if len(remainder) > 1 {
+			fullText = &query.Node{Kind: query.KindAnd, Children: remainder}
+		}
+		parsedFilters = append(parsedFilters, *model.NewSingleParsedFilter([]string{toLucene(fullText)}, "fulltext", nil))
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].field < order[j].field })
+	for _, key := range order {
+		operator := key.operator
+		parsedFilters = append(parsedFilters, *model.NewSingleParsedFilter(groups[key], key.field, &operator))
+	}
+	return parsedFilters, nil
+}
+
+// structuredClause recognises "as:x", "as:(x OR y)" and "NOT as:x" style
+// clauses on a structured field.
+func structuredClause(node *query.Node) (string, model.UploadFilterOperator, []string, bool) {
+	switch node.Kind {
+	case query.KindTerm, query.KindPhrase:
+		value, ok := structuredValue(node)
+		if !ok {
+			return "", "", nil, false
+		}
+		return structuredQueryFields[node.Field], model.AndOperator, []string{value}, true
+	case query.KindOr:
+		values := make([]string, 0, len(node.Children))
+		for _, child := range node.Children {
+			value, ok := structuredValue(child)
+			if !ok || child.Field != node.Children[0].Field {
+				return "", "", nil, false
+			}
+			values = append(values, value)
+		}
+		return structuredQueryFields[node.Children[0].Field], model.OrOperator, values, true
+	case query.KindNot:
+		field, operator, values, ok := structuredClause(node.Children[0])
+		if !ok || operator == model.NotOperator {
+			return "", "", nil, false
+		}
+		return field, model.NotOperator, values, true
+	}
+	return "", "", nil, false
+}
+
+func structuredValue(node *query.Node) (string, bool) {
+	if _, ok := structuredQueryFields[node.Field]; !ok {
+		return "", false
+	}
+	switch {
+	case node.Kind == query.KindTerm && node.Prefix && node.Field == "cpc":
+		return node.Value + "*", true
+	case node.Kind == query.KindTerm && !node.Prefix:
+		return node.Value, true
+	case node.Kind == query.KindPhrase && node.Slop == 0:
+		return node.Value, true
+	}
+	return "", false
+}
+
+func toLucene(node *query.Node) string {
+	switch node.Kind {
+	case query.KindAnd, query.KindOr:
+		separator := " AND "
+		if node.Kind == query.KindOr {
+			separator = " OR "
+		}
+		parts := make([]string, 0, len(node.Children))
+		for _, child := range node.Children {
+			parts = append(parts, toLucene(child))
+		}
+		return "(" + strings.Join(parts, separator) + ")"
+	case query.KindNot:
+		return "NOT " + toLucene(node.Children[0])
+	}
+
+	var value string
+	if node.Kind == query.KindPhrase {
+		value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(node.Value) + `"`
+		if node.Slop > 0 {
+			value += "~" + strconv.Itoa(node.Slop)
+		}
+	} else {
+		value = escapeLucene(node.Value)
+		if node.Prefix {
+			value += "*"
+		}
+	}
+
+	fields := queryFields[node.Field]
+	if len(fields) == 1 {
+		return fields[0] + ":" + value
+	}
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+":"+value)
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+func escapeLucene(value string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(luceneSpecialCharacters, r) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
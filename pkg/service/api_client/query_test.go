@@ -0,0 +1,150 @@
+package api_client
+
+import (
+	"errors"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/query"
+	"reflect"
+	"testing"
+)
+
+func mustParse(t *testing.T, input string) *query.Node {
+	t.Helper()
+	node, err := query.Parse(input)
+	if err != nil {
+		t.Fatalf("parse %q: %s", input, err)
+	}
+	return node
+}
+
+func TestToLucene(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"battery", "(invention_title:battery OR abstract_paragraphs.plain_text:battery OR " +
+			"claims.plain_text:battery OR descriptions.plain_text:battery)"},
+		{"ti:battery", "invention_title:battery"},
+		{"ab:battery", "abstract_paragraphs.plain_text:battery"},
+		{"cl:battery", "claims.plain_text:battery"},
+		{"de:battery", "descriptions.plain_text:battery"},
+		{"cpc:H04L9/32", `classifications_cpc.symbol:H04L9\/32`},
+		{"as:Acme", "current_assignee.party_name:Acme"},
+		{"ti:charg*", "invention_title:charg*"},
+		{`ti:"wireless charging"`, `invention_title:"wireless charging"`},
+		{`ti:"wireless charging"~5`, `invention_title:"wireless charging"~5`},
+		{`ti:"say \"hi\""`, `invention_title:"say \"hi\""`},
+		{`ti:c\+\+`, `invention_title:c\+\+`},
+		{`ti:abc\*`, `invention_title:abc\*`},
+		{"ti:a ab:b", "(invention_title:a AND abstract_paragraphs.plain_text:b)"},
+		{"ti:a OR ab:b", "(invention_title:a OR abstract_paragraphs.plain_text:b)"},
+		{"ti:a -ab:b", "(invention_title:a AND NOT abstract_paragraphs.plain_text:b)"},
+		{"ti:(a OR b) cl:c", "((invention_title:a OR invention_title:b) AND claims.plain_text:c)"},
+		{"NOT (ti:a ti:b)", "NOT (invention_title:a AND invention_title:b)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := toLucene(mustParse(t, tt.query)); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructuredClause(t *testing.T) {
+	tests := []struct {
+		query    string
+		ok       bool
+		field    string
+		operator model.UploadFilterOperator
+		values   []string
+	}{
+		{query: "as:Acme", ok: true, field: "current_assignee", operator: model.AndOperator, values: []string{"Acme"}},
+		{query: `as:"Robert Bosch"`, ok: true, field: "current_assignee", operator: model.AndOperator,
+			values: []string{"Robert Bosch"}},
+		{query: "as:(Acme OR Globex)", ok: true, field: "current_assignee", operator: model.OrOperator,
+			values: []string{"Acme", "Globex"}},
+		{query: "NOT as:Acme", ok: true, field: "current_assignee", operator: model.NotOperator, values: []string{"Acme"}},
+		{query: "-as:(Acme OR Globex)", ok: true, field: "current_assignee", operator: model.NotOperator,
+			values: []string{"Acme", "Globex"}},
+		{query: "cpc:H04L9/32", ok: true, field: "cpc_code", operator: model.AndOperator, values: []string{"H04L9/32"}},
+		{query: "cpc:H04L*", ok: true, field: "cpc_code", operator: model.AndOperator, values: []string{"H04L*"}},
+		// clauses the structured filters cannot express stay full text
+		{query: "as:Acme*"},
+		{query: `as:"Robert Bosch"~2`},
+		{query: "ti:battery"},
+		{query: "battery"},
+		{query: "as:Acme OR cpc:H04L"},
+		{query: "as:Acme OR battery"},
+		{query: "NOT NOT as:Acme"},
+		{query: "as:(Acme Globex)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			field, operator, values, ok := structuredClause(mustParse(t, tt.query))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if field != tt.field || operator != tt.operator || !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("got %s %s %v, want %s %s %v", field, operator, values, tt.field, tt.operator, tt.values)
+			}
+		})
+	}
+}
+
+func TestParseTermsFilters(t *testing.T) {
+	got, err := (&APIClient{}).parseTermsFilters(`ti:battery as:Acme -as:Initech cpc:(H04L* OR H01M*) as:Globex`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []model.SingleParsedFilter{
+		{SearchField: "patent.fulltext", Criteria: []string{"invention_title:battery"}, FilterOperator: operator("and")},
+		{SearchField: "patent.cpccode", Criteria: []string{"H04L*", "H01M*"}, FilterOperator: operator("or")},
+		{SearchField: "patent.currentassignee", Criteria: []string{"Acme", "Globex"}, FilterOperator: operator("and")},
+		{SearchField: "patent.currentassignee", Criteria: []string{"Initech"}, FilterOperator: operator("not")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	// an OR at the top level is sent as full text as a whole
+	got, err = (&APIClient{}).parseTermsFilters(`as:Acme OR ti:battery`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want = []model.SingleParsedFilter{{
+		SearchField:    "patent.fulltext",
+		Criteria:       []string{"(current_assignee.party_name:Acme OR invention_title:battery)"},
+		FilterOperator: operator("and"),
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseTermsFiltersErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"battery xx:cell", 8},
+		{"ti:(a OR b", 10},
+		{"xx:(a OR b)", 4},
+		{"a OR", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := (&APIClient{}).parseTermsFilters(tt.query)
+			if !errors.Is(err, model.ErrInvalidFilters) {
+				t.Fatalf("got %v, want ErrInvalidFilters", err)
+			}
+			var syntaxErr *query.SyntaxError
+			if !errors.As(err, &syntaxErr) || syntaxErr.Pos != tt.pos {
+				t.Errorf("got %v, want a syntax error at %d", err, tt.pos)
+			}
+		})
+	}
+}
@@ -1,491 +1,93 @@
 package api_client
 
 import (
+	"context"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
-	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository"
+	"golang.org/x/sync/errgroup"
 	"log/slog"
-	"regexp"
-	"strconv"
-	"strings"
-	"time"
+	"sync"
 )
 
 const chunkSize = 20
 
+// kindsPerNumber is how many documents (A1, B1, B2...) a publication number
+// without a kind code may resolve to within one document_number chunk.
+const kindsPerNumber = 3
+
 type APIClient struct {
 	cfg  *config.Config
 	log  *slog.Logger
-	repo repository.KTMineRepositoryInterface
+	repo repository.PatentProvider
 }
 
-func NewAPIClient(log *slog.Logger, repo repository.KTMineRepositoryInterface, cfg *config.Config) *APIClient {
+func NewAPIClient(log *slog.Logger, repo repository.PatentProvider, cfg *config.Config) *APIClient {
 	return &APIClient{
 		cfg:  cfg,
 		log:  log,
 		repo: repo,
 	}
 }
-func (c *APIClient) GetData(input model.UploadInput) error {
-	return nil
-}
-
-//func (c *APIClient) GetData(input model.UploadInput) error {
-//	var wg sync.WaitGroup
-//	packagesChan := make(chan *model.ParsedPatentsData, 1000)
-//	for i := 0; i < len(input.PublicationNumbers); i += chunkSize {
-//		end := i + chunkSize
-//		if end > len(input.PublicationNumbers) {
-//			end = len(input.PublicationNumbers)
-//		}
-//		wg.Add(1)
-//		requestBody := model.NewFilterRequestBody([]model.SingleParsedFilter{*model.NewSingleParsedFilter(
-//			input.PublicationNumbers[i:end], "documentnumber", nil)},
-//			c.cfg.KTMineAPIKey, 0, chunkSize, nil, []string{"all"})
-//		go func() error {
-//			defer wg.Done()
-//			if err := c.getAndParseData(requestBody, packagesChan); err != nil {
-//				fmt.Println(err)
-//			}
-//			return nil
-//		}()
-//	}
-//	wg.Wait()
-//	close(packagesChan)
-//
-//	return nil
-//}
-
-//func (c *APIClient) getAndParseData(requestBody model.FiltersRequestBody, ch chan *model.ParsedPatentsData) error {
-//	body, err := c.sendRequest(requestBody)
-//	if err != nil {
-//		return err
-//	}
-//	err = c.parseResponse(body, ch)
-//
-//	return err
-//}
-
-//func (c *APIClient) parseResponse(body *[]byte, ch chan *model.ParsedPatentsData) error {
-//	var data map[string]interface{}
-//	err := json.Unmarshal(*body, &data)
-//	if err != nil {
-//		return err
-//	}
-//	response, ok := data["response"].(map[string]interface{})
-//	if !ok {
-//		return errors.New("can't parse response body")
-//	}
-//	items, ok := response["items"].([]interface{})
-//	if !ok {
-//		return errors.New("can't parse response body")
-//	}
-//	fmt.Println(len(items))
-//
-//	for _, item := range items {
-//		itemMap, ok := item.(map[string]interface{})
-//		if !ok {
-//			return errors.New("can't parse response body")
-//		}
-//		parsedPatent := c.parsePatent(itemMap)
-//		parsedInventors, parsedInventorPatentLink := c.parseInventors(itemMap, parsedPatent.Id)
-//		parsedAssignees, parsedAssigneePatentLink := c.parseAssignees(itemMap, parsedPatent.Id)
-//		parsedJurisdictions, parsedJurisdictionsPatentLink := c.parseJurisdictions(itemMap, parsedPatent.Id,
-//			parsedPatent.EarliestPriorityDate)
-//		parsedClaims := c.parseClaim(itemMap, parsedPatent.Id)
-//
-//		ch <- &model.ParsedPatentsData{
-//			Patent:                  parsedPatent,
-//			Inventors:               parsedInventors,
-//			PatentInventorsLink:     parsedInventorPatentLink,
-//			Assignees:               parsedAssignees,
-//			PatentAssigneesLink:     parsedAssigneePatentLink,
-//			Jurisdictions:           parsedJurisdictions,
-//			PatentJurisdictionsLink: parsedJurisdictionsPatentLink,
-//			Claims:                  parsedClaims,
-//		}
-//	}
-//
-//	return nil
-//}
-
-//func (c *APIClient) parseInventors(data map[string]interface{}, patentId uuid.UUID) (
-//	*[]model.Inventor, *[]model.PatentInventorLink) {
-//	inventors := make([]model.Inventor, 0)
-//	inventorPatentLink := make([]model.PatentInventorLink, 0)
-//	inventorsList, ok := data["inventors"].([]interface{})
-//	if ok {
-//		for _, name := range inventorsList {
-//			parsedInventorName, ok := name.(map[string]interface{})
-//			if ok {
-//				if parsedName, ok := parsedInventorName["partyNameClean"].(string); ok {
-//					inventors = append(inventors, model.Inventor{FullName: parsedName})
-//					inventorPatentLink = append(inventorPatentLink, model.PatentInventorLink{
-//						PatentID: patentId, InventorName: parsedName})
-//				} else if parsedName, ok := parsedInventorName["partyName"].(string); ok {
-//					inventors = append(inventors, model.Inventor{FullName: parsedName})
-//					inventorPatentLink = append(inventorPatentLink, model.PatentInventorLink{
-//						PatentID: patentId, InventorName: parsedName})
-//				}
-//			}
-//		}
-//	}
-//	return &inventors, &inventorPatentLink
-//}
-
-func (c *APIClient) parsePatent(data map[string]interface{}) *model.ParsedPatent {
-	publicationNumber, _ := data["documentNumber"].(string)
-	simpleLegalStatus, _ := data["legalStatus"].(string)
-
-	title, ok := data["inventionTitle"].(string)
-	if !ok || title == "" {
-		inventionTitles, ok := data["inventionTitles"].([]interface{})
-		if ok {
-			for _, it := range inventionTitles {
-				inventionTitle, ok := it.(map[string]interface{})
-				if ok {
-					if lang, ok := inventionTitle["lang"].(string); ok && lang == "eng" {
-						title, _ = inventionTitle["title"].(string)
-						break
-					}
-				}
-			}
-		}
-	}
-
-	var cpcList []string
-	if cpcClassifications, ok := data["cpcClassifications"].([]interface{}); ok {
-		for _, entry := range cpcClassifications {
-			if classificationMap, ok := entry.(map[string]interface{}); ok {
-				if symbol, ok := classificationMap["symbol"].(string); ok {
-					cpcList = append(cpcList, symbol)
-				}
-			}
-		}
-	}
-	cpcResult := strings.Join(cpcList, " | ")
 
-	var inpadocFamilyMembers, inpadocFamilyJurisdictions []string
-	if inpadocFamilyList, ok := data["inpadocFamilyMembers"].([]interface{}); ok {
-		for _, entry := range inpadocFamilyList {
-			if inpadocFamily, ok := entry.(map[string]interface{}); ok {
-				country, _ := inpadocFamily["country"].(string)
-				documentNumber, _ := inpadocFamily["documentNumber"].(string)
-				kind, _ := inpadocFamily["kind"].(string)
-				inpadocFamilyMember := fmt.Sprintf("%s%s%s", country, documentNumber, kind)
-				inpadocFamilyMembers = append(inpadocFamilyMembers, inpadocFamilyMember)
-				if country != "" {
-					inpadocFamilyJurisdictions = append(inpadocFamilyJurisdictions, country)
-				}
-			}
-		}
-	}
-	inpadocFamilyMembersResult := strings.Join(inpadocFamilyMembers, " | ")
-	inpadocFamilyJurisdictionsResult := strings.Join(inpadocFamilyJurisdictions, " | ")
-
-	var abstractResult string
-	if abstractParagraph, ok := data["abstractParagraphs"].([]interface{}); ok {
-		for _, abstract := range abstractParagraph {
-			if abstractParsed, ok := abstract.(map[string]interface{}); ok {
-				if abstractText, ok := abstractParsed["plainText"].(string); ok {
-					abstractResult = fmt.Sprintf("%s%s\n", abstractResult, abstractText)
-				}
-			}
-		}
-	}
-	abstractResult = utils.RemoveHTMLTags(abstractResult)
+func (c *APIClient) UpstreamStatus() model.CircuitBreakerStatus {
+	return c.repo.Status()
+}
 
-	briefDescriptionFlag := false
-	var descriptionResult, briefDescriptionOfDrawingsResult string
-	if descriptionData, ok := data["descriptions"].([]interface{}); ok {
-		for _, descriptionText := range descriptionData {
-			if description, ok := descriptionText.(map[string]interface{}); ok {
-				var category string
-				if category, ok = description["category"].(string); ok {
-					if category == "brief-description-of-drawings" {
-						briefDescriptionFlag = !briefDescriptionFlag
-					}
-				}
-				if parsedDescription, ok := description["plainText"].(string); ok {
-					descriptionResult = fmt.Sprintf("%s%s\n", descriptionResult, parsedDescription)
-					if briefDescriptionFlag || category == "description-of-drawings" {
-						briefDescriptionOfDrawingsResult = fmt.Sprintf("%s%s\n", briefDescriptionOfDrawingsResult,
-							parsedDescription)
-					}
-				}
-			}
+// GetData fetches full patents for an explicit list of publication numbers,
+// querying the provider in document_number chunks of chunkSize. Each chunk is
+// paged until the provider returns a short page, since a number without a
+// kind code may match more documents than kindsPerNumber allows for.
+func (c *APIClient) GetData(ctx context.Context, input model.UploadInput) ([]model.FilteredFullPatent, error) {
+	g, ctx := errgroup.WithContext(ctx)
+
+	var mu sync.Mutex
+	patents := make([]model.FilteredFullPatent, 0, len(input.PublicationNumbers))
+	for i := 0; i < len(input.PublicationNumbers); i += chunkSize {
+		end := i + chunkSize
+		if end > len(input.PublicationNumbers) {
+			end = len(input.PublicationNumbers)
 		}
-	}
-	descriptionResult = utils.RemoveHTMLTags(descriptionResult)
-	briefDescriptionOfDrawingsResult = utils.RemoveHTMLTags(briefDescriptionOfDrawingsResult)
-
-	authority, _ := data["publicationReference"].(map[string]interface{})["country"].(string)
-
-	var applicationNumber, applicationDate string
-	if applicationReferences, ok := data["applicationReferences"].([]interface{}); ok {
-		for _, applicationReference := range applicationReferences {
-			if applicationReferenceParsed, ok := applicationReference.(map[string]interface{}); ok {
-				if dataFormat, ok := applicationReferenceParsed["dataFormat"].(string); ok && dataFormat == "original" {
-					if applicationNumber == "" {
-						applicationNumber, ok = applicationReferenceParsed["documentNumber"].(string)
-						if !ok {
-							applicationNumber = ""
-						}
-					}
-				}
-				if applicationDate == "" {
-					applicationDate, ok = applicationReferenceParsed["documentDate"].(string)
-					if !ok {
-						applicationDate = ""
-					}
-				}
-			}
+		operator := model.OrOperator
+		parsedFilters := []model.SingleParsedFilter{
+			*model.NewSingleParsedFilter(input.PublicationNumbers[i:end], "document_number", &operator),
 		}
-	}
-	applicationDateParsed, err := time.Parse("2006-01-02", applicationDate)
-	if err != nil {
-		applicationDateParsed = time.Time{}
-	}
-
-	var issueDate string
-	if pubReferences, ok := data["publicationReferences"].([]interface{}); ok {
-		for _, pubRef := range pubReferences {
-			if pubRefMap, ok := pubRef.(map[string]interface{}); ok {
-				if date, ok := pubRefMap["documentDate"].(string); ok && date != "" {
-					issueDate = date
-					break
-				}
+		g.Go(func() error {
+			local, err := c.getChunk(ctx, parsedFilters, (end-i)*kindsPerNumber)
+			if err != nil {
+				return fmt.Errorf("chunk @%d: %w", i, err)
 			}
-		}
-	}
-	issueDateParsed, err := time.Parse("2006-01-02", issueDate)
-	if err != nil {
-		issueDateParsed = time.Time{}
-	}
 
-	earliestPriorityDate, _ := data["minPriorityDate"].(string)
-	estimatedExpiryDate, _ := data["projectedExpirationDate"].(string)
-	earliestPriorityDateParsed, err := time.Parse("2006-01-02", earliestPriorityDate)
-	if err != nil {
-		earliestPriorityDateParsed = time.Time{}
-	}
-	estimatedExpiryDateParsed, err := time.Parse("2006-01-02", estimatedExpiryDate)
-	if err != nil {
-		estimatedExpiryDateParsed = time.Time{}
-	}
-	var countOfCitedByPatents int
-	if backwardCitations, ok := data["backwardCitations"].([]interface{}); ok && backwardCitations != nil {
-		countOfCitedByPatents = len(backwardCitations)
+			mu.Lock()
+			patents = append(patents, local...)
+			mu.Unlock()
+			return nil
+		})
 	}
-
-	return &model.ParsedPatent{
-		Id:                             uuid.New(),
-		Title:                          title,
-		Abstract:                       abstractResult,
-		CPC:                            cpcResult,
-		EarliestPriorityDate:           earliestPriorityDateParsed,
-		EstimatedExpiryDate:            estimatedExpiryDateParsed,
-		PublicationNumber:              publicationNumber,
-		CountOfCitedByPatents:          countOfCitedByPatents,
-		Description:                    descriptionResult,
-		BriefDescriptionOfDrawings:     briefDescriptionOfDrawingsResult,
-		SimpleLegalStatus:              simpleLegalStatus,
-		InpadocFamily:                  inpadocFamilyMembersResult,
-		InpadocFamilyApplicationCount:  len(inpadocFamilyMembers),
-		InpadocFamilyJurisdiction:      inpadocFamilyJurisdictionsResult,
-		InpadocFamilyJurisdictionCount: len(inpadocFamilyJurisdictions),
-		Authority:                      authority,
-		ApplicationDate:                applicationDateParsed,
-		ApplicationNumber:              applicationNumber,
-		IssueDate:                      issueDateParsed,
-		PublicationDate:                issueDateParsed,
-		FileURL: fmt.Sprintf("https://api.ktmine.com/api/v2/patents/pdf/%s?key=%s",
-			publicationNumber, c.cfg.KTMineAPIKey),
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
+	return patents, nil
 }
 
-//func (c *APIClient) parseAssignees(data map[string]interface{}, patentId uuid.UUID) (
-//	*[]model.StandardizedCurrentAssignee, *[]model.PatentStandardizedCurrentAssigneeLink) {
-//	assignees := make([]model.StandardizedCurrentAssignee, 0)
-//	assigneePatentLink := make([]model.PatentStandardizedCurrentAssigneeLink, 0)
-//	assigneesList, ok := data["currentAssignees"].([]interface{})
-//	if ok {
-//		for _, name := range assigneesList {
-//			parsedInventorName, ok := name.(map[string]interface{})
-//			if ok {
-//				if parsedName, ok := parsedInventorName["partyNameClean"].(string); ok {
-//					assignees = append(assignees, model.StandardizedCurrentAssignee{Name: parsedName})
-//					assigneePatentLink = append(assigneePatentLink, model.PatentStandardizedCurrentAssigneeLink{
-//						PatentID: patentId, AssigneeName: parsedName})
-//				} else if parsedName, ok := parsedInventorName["partyName"].(string); ok {
-//					assignees = append(assignees, model.StandardizedCurrentAssignee{Name: parsedName})
-//					assigneePatentLink = append(assigneePatentLink, model.PatentStandardizedCurrentAssigneeLink{
-//						PatentID: patentId, AssigneeName: parsedName})
-//				}
-//			}
-//		}
-//	}
-//	return &assignees, &assigneePatentLink
-//}
-
-//func (c *APIClient) parseJurisdictions(data map[string]interface{}, patentId uuid.UUID, minPriorityDate time.Time) (
-//	*[]model.SimpleFamilyJurisdiction, *[]model.PatentSimpleFamilyJurisdictionLink) {
-//
-//	jurisdictions := make([]model.SimpleFamilyJurisdiction, 0)
-//	jurisdictionPatentLink := make([]model.PatentSimpleFamilyJurisdictionLink, 0)
-//
-//	minPriorityDateStr := minPriorityDate.Format("2006-01-02") // Adjust the format as needed
-//
-//	claimsList, ok := data["priorityClaims"].([]interface{})
-//	if ok {
-//		for _, claim := range claimsList {
-//			if parsedClaim, ok := claim.(map[string]interface{}); ok {
-//				if claimDate, ok := parsedClaim["documentDate"].(string); ok && claimDate == minPriorityDateStr {
-//					if country, ok := parsedClaim["country"].(string); ok {
-//						jurisdictions = append(jurisdictions, model.SimpleFamilyJurisdiction{Name: country})
-//						jurisdictionPatentLink = append(jurisdictionPatentLink, model.PatentSimpleFamilyJurisdictionLink{
-//							JurisdictionName: country, PatentID: patentId})
-//					}
-//				}
-//			}
-//		}
-//	}
-//	return &jurisdictions, &jurisdictionPatentLink
-//}
-
-type claimMapKey struct {
-	claimID     string
-	claimNumber int
-}
-
-type claimMapValue struct {
-	dependent        []string
-	dependentNumbers map[claimMapKey]struct{}
-	claim            string
-}
-
-func (c *APIClient) parseClaim(data map[string]interface{}, patentId uuid.UUID) *[]model.Claim {
-	claimsIds := make(map[string]struct{})
-	claimsMap := make(map[claimMapKey]claimMapValue)
-	claimsList, ok := data["claimsXml"].([]interface{})
-	if ok {
-		for _, value := range claimsList {
-			if claimObject, ok := value.(map[string]interface{}); ok {
-				singleClaim, ok := claimObject["xmlText"].(string)
-				if !ok {
-					continue
-				}
-				singleClaim = utils.RemoveHTMLTags(singleClaim)
-				claimId, _ := claimObject["claimId"].(string)
-				pattern := regexp.MustCompile(`\d{1,2}$`)
-				match := pattern.FindString(claimId)
-				var claimNumber int
-				var err error
-				if match != "" {
-					claimNumber, err = strconv.Atoi(match)
-					if err == nil {
-						continue
-					}
-				}
-				claimStruct := claimMapKey{claimID: claimId, claimNumber: claimNumber}
-
-				if _, exists := claimsIds[claimId]; !exists {
-					isDependent, ok := claimObject["isDependent"].(bool)
-					if !ok {
-						continue
-					}
-					if !isDependent {
-						if _, exists := claimsMap[claimStruct]; !exists {
-							claimsMap[claimStruct] = claimMapValue{claim: singleClaim + "\n", dependent: make([]string, 0),
-								dependentNumbers: make(map[claimMapKey]struct{})}
-						}
-					} else {
-						claimReferences, ok := claimObject["claimReferences"].([]string)
-						if ok {
-							if key, exists := checkClaimMapKey(claimReferences[0], claimsMap); exists {
-								value, _ := claimsMap[key]
-								value.dependentNumbers[claimStruct] = struct{}{}
-								value.dependent = append(value.dependent, singleClaim)
-								claimsMap[key] = value
-							} else {
-								for independentClaimNumber, dependentClaims := range claimsMap {
-									if _, exists := checkDependentClaimMapKey(claimReferences[0], dependentClaims.dependentNumbers); exists {
-										dependentClaims.dependent = append(dependentClaims.dependent, singleClaim)
-										dependentClaims.dependentNumbers[claimStruct] = struct{}{}
-										claimsMap[independentClaimNumber] = dependentClaims
-									}
-								}
-							}
-						}
-
-					}
-				} else {
-					if key, exists := checkClaimMapKey(claimId, claimsMap); exists {
-						value, _ := claimsMap[key]
-						value.claim += singleClaim + "\n"
-						claimsMap[key] = value
-					} else {
-						claimReferences, ok := claimObject["claimReferences"].([]string)
-						if ok {
-							if key, exists := checkClaimMapKey(claimReferences[0], claimsMap); exists {
-								value := claimsMap[key]
-								value.dependentNumbers[claimStruct] = struct{}{}
-								value.dependent = append(value.dependent, singleClaim)
-								claimsMap[key] = value
-							} else {
-								for independentClaimNumber, dependentClaim := range claimsMap {
-									if _, exists := checkDependentClaimMapKey(claimReferences[0], dependentClaim.dependentNumbers); exists {
-										value := claimsMap[independentClaimNumber]
-										value.dependentNumbers[claimStruct] = struct{}{}
-										value.dependent = append(value.dependent, singleClaim)
-										claimsMap[independentClaimNumber] = value
-									}
-								}
-							}
-						} else {
-							for independentClaimNumber, dependentClaim := range claimsMap {
-								if _, exists := checkDependentClaimMapKey(claimId, dependentClaim.dependentNumbers); exists {
-									value := claimsMap[independentClaimNumber]
-									value.dependent = append(value.dependent, singleClaim)
-									claimsMap[independentClaimNumber] = value
-								}
-							}
-						}
-					}
-				}
-			}
+func (c *APIClient) getChunk(
+	ctx context.Context,
+	parsedFilters []model.SingleParsedFilter,
+	pageSize int,
+) ([]model.FilteredFullPatent, error) {
+	patents := make([]model.FilteredFullPatent, 0, pageSize)
+	for offset := 0; ; offset += pageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-	}
-	claims := make([]model.Claim, 0, len(claimsMap))
-
-	for key, value := range claimsMap {
-		claims = append(claims, model.Claim{
-			PatentID:         patentId,
-			ClaimNumber:      key.claimNumber,
-			IndependentClaim: value.claim,
-			DependantClaims:  value.dependent,
-		})
-	}
-	return &claims
-}
-
-func checkClaimMapKey(claimId string, claimMap map[claimMapKey]claimMapValue) (claimMapKey, bool) {
-	for key, _ := range claimMap {
-		if key.claimID == claimId {
-			return key, true
+		page, err := c.GetFilteredChunkFullPatents(ctx, parsedFilters, offset, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("page @%d: %w", offset, err)
 		}
-	}
-	return claimMapKey{}, false
-}
-
-func checkDependentClaimMapKey(claimId string, claimMap map[claimMapKey]struct{}) (claimMapKey, bool) {
-	for key, _ := range claimMap {
-		if key.claimID == claimId {
-			return key, true
+		patents = append(patents, page...)
+		if len(page) < pageSize {
+			return patents, nil
 		}
 	}
-	return claimMapKey{}, false
 }
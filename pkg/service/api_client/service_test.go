@@ -0,0 +1,60 @@
+package api_client
+
+import (
+	"context"
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// pagedProvider answers every search from the same result list, paged by the
+// query's offset and limit.
+type pagedProvider struct {
+	repository.PatentProvider
+	patents []model.FilteredFullPatent
+
+	mu      sync.Mutex
+	offsets []int
+}
+
+func (p *pagedProvider) SearchPatents(ctx context.Context, query model.PatentQuery) ([]model.FilteredFullPatent, error) {
+	p.mu.Lock()
+	p.offsets = append(p.offsets, query.Offset)
+	p.mu.Unlock()
+	if query.Offset >= len(p.patents) {
+		return nil, nil
+	}
+	end := query.Offset + query.Limit
+	if end > len(p.patents) {
+		end = len(p.patents)
+	}
+	return p.patents[query.Offset:end], nil
+}
+
+func TestGetDataPagesUntilExhausted(t *testing.T) {
+	// one requested number resolving to more documents than kindsPerNumber
+	patents := make([]model.FilteredFullPatent, 0, 2*kindsPerNumber+1)
+	for i := 0; i < cap(patents); i++ {
+		patents = append(patents, model.FilteredFullPatent{
+			Patent: model.FilteredPatent{PublicationNumber: fmt.Sprintf("US10000000B%d", i)},
+		})
+	}
+	provider := &pagedProvider{patents: patents}
+	client := NewAPIClient(slog.New(slog.NewTextHandler(io.Discard, nil)), provider, nil)
+
+	got, err := client.GetData(context.Background(), model.UploadInput{PublicationNumbers: []string{"US10000000"}})
+	if err != nil {
+		t.Fatalf("GetData: %v", err)
+	}
+	if len(got) != len(patents) {
+		t.Errorf("got %d patents, want %d", len(got), len(patents))
+	}
+	want := []int{0, kindsPerNumber, 2 * kindsPerNumber}
+	if fmt.Sprint(provider.offsets) != fmt.Sprint(want) {
+		t.Errorf("requested offsets %v, want %v", provider.offsets, want)
+	}
+}
@@ -2,6 +2,7 @@ package broker_client
 
 import (
 	"context"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository"
 	"log/slog"
 )
@@ -20,6 +21,28 @@ func NewBrokerClient(log *slog.Logger, repo repository.BrokerRepository) BrokerC
 
 func (s BrokerClient) ListenPatentUpload(ctx context.Context, handler func(context.Context, []byte) ([]byte, error)) {
 	if err := s.repo.ListenAndPublish(ctx, handler); err != nil {
-		panic("failed to consume data")
+		s.log.Error("upload consumer stopped",
+			slog.String("op", "broker_client.ListenPatentUpload"),
+			slog.String("error", err.Error()),
+		)
 	}
 }
+
+func (s BrokerClient) BrokerStatus() model.BrokerStatus {
+	return s.repo.Status()
+}
+
+func (s BrokerClient) ListDeadLetters(ctx context.Context, input model.DeadLetterListInput) ([]model.DeadLetter, error) {
+	return s.repo.ListDeadLetters(ctx, input)
+}
+
+func (s BrokerClient) ReplayDeadLetters(
+	ctx context.Context,
+	input model.DeadLetterReplayInput,
+) (model.DeadLetterReplayOutput, error) {
+	return s.repo.ReplayDeadLetters(ctx, input)
+}
+
+func (s BrokerClient) Publish(ctx context.Context, message model.OutboxMessage) error {
+	return s.repo.Publish(ctx, message)
+}
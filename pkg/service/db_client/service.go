@@ -20,9 +20,49 @@ func NewDBClient(log *slog.Logger, repo repository.DBRepository) *DBClient {
 	}
 }
 
-func (s *DBClient) HandleSavePatents(ctx context.Context, patents []model.FilteredFullPatent, transactionId, bundleId uuid.UUID) error {
-	if err := s.repo.SavePatents(ctx, patents, transactionId, bundleId); err != nil {
-		return err
-	}
-	return nil
+func (s *DBClient) HandleSavePatents(
+	ctx context.Context,
+	patents []model.FilteredFullPatent,
+	transactionId, bundleId uuid.UUID,
+) (model.SaveStats, error) {
+	return s.repo.SavePatents(ctx, patents, transactionId, bundleId)
+}
+
+func (s *DBClient) NewPatentWriter(ctx context.Context, atomic bool) (repository.PatentWriter, error) {
+	return s.repo.NewPatentWriter(ctx, atomic)
+}
+
+func (s *DBClient) ListPatents(ctx context.Context, input model.PatentListInput) ([]model.StoredPatent, error) {
+	return s.repo.ListPatents(ctx, input)
+}
+
+func (s *DBClient) ListTransactionFamilyMembers(ctx context.Context, transactionId uuid.UUID) ([]model.FamilyMember, error) {
+	return s.repo.ListTransactionFamilyMembers(ctx, transactionId)
+}
+
+func (s *DBClient) SuppressFamilyMembers(
+	ctx context.Context,
+	transactionId, bundleId uuid.UUID,
+	suppressions []model.FamilySuppression,
+) error {
+	return s.repo.SuppressFamilyMembers(ctx, transactionId, bundleId, suppressions)
+}
+
+func (s *DBClient) CitationNeighbourhood(
+	ctx context.Context,
+	input model.CitationNeighbourhoodInput,
+) (*model.CitationNeighbourhood, error) {
+	return s.repo.CitationNeighbourhood(ctx, input)
+}
+
+func (s *DBClient) QueueOutboxMessage(ctx context.Context, message model.OutboxMessage) error {
+	return s.repo.QueueOutboxMessage(ctx, message)
+}
+
+func (s *DBClient) RelayOutbox(
+	ctx context.Context,
+	limit int,
+	publish func(context.Context, model.OutboxMessage) error,
+) (int, error) {
+	return s.repo.RelayOutbox(ctx, limit, publish)
 }
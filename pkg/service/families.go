@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// collapseFamilies keeps one representative per family among the patents an
+// upload saved and takes the other members out of the bundle. It runs once
+// every page is saved, because the preferred member of a family may be on any
+// page, and returns the number of members collapsed.
+func (s Service) collapseFamilies(ctx context.Context, payload model.UploadPatentPayload) (int, error) {
+	op := "service.collapseFamilies"
+	log := s.log.With(slog.String("op", op), slog.String("transaction_id", payload.TransactionId.String()))
+
+	options := payload.FamilyDedup
+	members, err := s.DBClient.ListTransactionFamilyMembers(ctx, payload.TransactionId)
+	if err != nil {
+		return 0, err
+	}
+	suppressions := familySuppressions(members, *options)
+	if err := s.DBClient.SuppressFamilyMembers(ctx, payload.TransactionId, payload.BundleId, suppressions); err != nil {
+		return 0, fmt.Errorf("failed to collapse families: %w", err)
+	}
+	log.Info("collapsed patent families",
+		slog.String("family", string(options.Family)),
+		slog.Int("patents", len(members)),
+		slog.Int("collapsed", len(suppressions)),
+	)
+	return len(suppressions), nil
+}
+
+// familySuppressions groups members into families and pairs every member but
+// the representative with the representative of its family.
+func familySuppressions(members []model.FamilyMember, options model.FamilyDedupOptions) []model.FamilySuppression {
+	rank := make(map[string]int, len(options.JurisdictionPreference))
+	for i, jurisdiction := range options.JurisdictionPreference {
+		if _, exists := rank[jurisdiction]; !exists {
+			rank[jurisdiction] = i
+		}
+	}
+	jurisdictionRank := func(member model.FamilyMember) int {
+		if i, ok := rank[strings.ToUpper(member.Authority)]; ok {
+			return i
+		}
+		return len(rank)
+	}
+
+	families := groupFamilies(members, options.Family)
+	suppressions := make([]model.FamilySuppression, 0)
+	for _, family := range families {
+		if len(family) < 2 {
+			continue
+		}
+		sort.Slice(family, func(i, j int) bool {
+			ri, rj := jurisdictionRank(family[i]), jurisdictionRank(family[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return family[i].PublicationNumber < family[j].PublicationNumber
+		})
+		for _, member := range family[1:] {
+			suppressions = append(suppressions, model.FamilySuppression{
+				RepresentativeId: family[0].Id,
+				SuppressedId:     member.Id,
+				Family:           options.Family,
+			})
+		}
+	}
+	return suppressions
+}
+
+// groupFamilies splits members into families. INPADOC families join members
+// that list each other, directly or through another member, so an incomplete
+// member list still lands in the right family; simple families share the
+// same priority claims. Members without family data stay on their own.
+func groupFamilies(members []model.FamilyMember, familyType model.FamilyType) [][]model.FamilyMember {
+	parent := make([]int, len(members))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		if ri, rj := find(i), find(j); ri != rj {
+			parent[rj] = ri
+		}
+	}
+
+	owner := make(map[string]int, len(members))
+	link := func(key string, i int) {
+		if key == "" {
+			return
+		}
+		if j, exists := owner[key]; exists {
+			union(j, i)
+			return
+		}
+		owner[key] = i
+	}
+	for i, member := range members {
+		switch familyType {
+		case model.SimpleFamily:
+			link(member.SimpleFamilyKey, i)
+		default:
+			link(familyNumber(member.PublicationNumber), i)
+			for _, number := range strings.Split(member.InpadocFamily, "|") {
+				link(familyNumber(number), i)
+			}
+		}
+	}
+
+	groups := make(map[int][]model.FamilyMember, len(members))
+	order := make([]int, 0, len(members))
+	for i, member := range members {
+		root := find(i)
+		if _, exists := groups[root]; !exists {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], member)
+	}
+	families := make([][]model.FamilyMember, 0, len(order))
+	for _, root := range order {
+		families = append(families, groups[root])
+	}
+	return families
+}
+
+// familyNumber identifies a family member regardless of its kind code, which
+// differs between a member list and the published document.
+func familyNumber(number string) string {
+	return utils.StripKindCode(utils.NormalizePublicationNumber(number))
+}
@@ -0,0 +1,84 @@
+package job_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository"
+	"log/slog"
+)
+
+// JobClient keeps the upload_job record of a broker upload up to date.
+// Progress updates are best effort: a failed update is logged and never
+// fails the upload it describes.
+type JobClient struct {
+	log  *slog.Logger
+	repo repository.UploadJobRepository
+}
+
+func NewJobClient(log *slog.Logger, repo repository.UploadJobRepository) *JobClient {
+	return &JobClient{
+		log:  log,
+		repo: repo,
+	}
+}
+
+func (c *JobClient) CreateUploadJob(ctx context.Context, payload model.UploadPatentPayload) error {
+	filters, err := json.Marshal(payload.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to marshal filters: %w", err)
+	}
+	return c.repo.CreateUploadJob(ctx, model.UploadJob{
+		TransactionId: payload.TransactionId,
+		BundleId:      payload.BundleId,
+		Filters:       filters,
+	})
+}
+
+func (c *JobClient) StartUploadJob(ctx context.Context, transactionId uuid.UUID, totalPatents int) {
+	c.logError(c.repo.StartUploadJob(ctx, transactionId, totalPatents), transactionId)
+}
+
+func (c *JobClient) AddUploadJobProgress(ctx context.Context, transactionId uuid.UUID, pages, parsed int) {
+	c.logError(c.repo.AddUploadJobProgress(ctx, transactionId, pages, parsed), transactionId)
+}
+
+// CompleteUploadJob records the job as completed together with its result
+// messages. Unlike the progress updates it reports failure, since the results
+// would otherwise never be published.
+func (c *JobClient) CompleteUploadJob(
+	ctx context.Context,
+	transactionId uuid.UUID,
+	messages ...model.OutboxMessage,
+) error {
+	return c.repo.CompleteUploadJob(ctx, transactionId, messages...)
+}
+
+func (c *JobClient) FailUploadJob(ctx context.Context, transactionId uuid.UUID, jobErr error) {
+	c.logError(c.repo.FinishUploadJob(ctx, transactionId, model.JobFailed, jobErr.Error()), transactionId)
+}
+
+func (c *JobClient) ListUploadJobCheckpoints(ctx context.Context, transactionId uuid.UUID) ([]int, error) {
+	return c.repo.ListUploadJobCheckpoints(ctx, transactionId)
+}
+
+func (c *JobClient) GetUploadJob(ctx context.Context, transactionId uuid.UUID) (*model.UploadJob, error) {
+	return c.repo.GetUploadJob(ctx, transactionId)
+}
+
+func (c *JobClient) ListUploadJobs(ctx context.Context, input model.UploadJobListInput) ([]model.UploadJob, error) {
+	return c.repo.ListUploadJobs(ctx, input)
+}
+
+func (c *JobClient) logError(err error, transactionId uuid.UUID) {
+	if err == nil {
+		return
+	}
+	c.log.Error("failed to update upload job",
+		slog.String("op", "job_client.update"),
+		slog.String("transaction_id", transactionId.String()),
+		slog.String("error", err.Error()),
+	)
+}
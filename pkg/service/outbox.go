@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunOutboxRelay publishes committed outbox messages until ctx is cancelled.
+// It runs every OutboxRelayInterval and whenever an upload completes, and
+// once more on cancellation so that results written during shutdown are not
+// left for the next start.
+func (s Service) RunOutboxRelay(ctx context.Context) {
+	op := "service.RunOutboxRelay"
+	log := s.log.With(slog.String("op", op))
+	interval := s.cfg.OutboxRelayInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	log.Info("outbox relay started", slog.Duration("interval", interval))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.relayOutbox(context.WithoutCancel(ctx))
+			log.Info("outbox relay stopped")
+			return
+		case <-ticker.C:
+		case <-s.outboxWake:
+		}
+		s.relayOutbox(ctx)
+	}
+}
+
+// relayOutbox publishes pending messages batch by batch until none are left
+// or publishing fails; failed messages are retried on the next run.
+func (s Service) relayOutbox(ctx context.Context) {
+	op := "service.relayOutbox"
+	batchSize := s.cfg.OutboxRelayBatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if !s.BrokerClient.BrokerStatus().Connected {
+		// the messages wait in the outbox until the broker is back
+		return
+	}
+	for {
+		sent, err := s.DBClient.RelayOutbox(ctx, batchSize, s.BrokerClient.Publish)
+		if sent > 0 {
+			s.log.Debug("outbox messages published", slog.String("op", op), slog.Int("count", sent))
+		}
+		if err != nil {
+			s.log.Warn("outbox relay failed, retrying on next run",
+				slog.String("op", op),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		if sent < batchSize {
+			return
+		}
+	}
+}
+
+// wakeOutboxRelay asks the relay to run now instead of at its next tick.
+func (s Service) wakeOutboxRelay() {
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+}
@@ -3,164 +3,227 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
 	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/service/api_client"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/service/broker_client"
 	"github.com/vpnvsk/amunetip-patent-upload/pkg/service/db_client"
+	"github.com/vpnvsk/amunetip-patent-upload/pkg/service/job_client"
 	"log/slog"
-	"sync"
 )
 
 type Service struct {
 	log *slog.Logger
+	cfg *config.Config
+	// outboxWake asks the outbox relay to run before its next tick.
+	outboxWake chan struct{}
 	APIClientInterface
 	DBClient
 	BrokerClient
+	UploadJobClient
 }
 
 func NewService(log *slog.Logger, repo *repository.Repository, cfg *config.Config) *Service {
 	return &Service{
 		log:                log,
-		APIClientInterface: api_client.NewAPIClient(log, repo.KTMineRepositoryInterface, cfg),
+		cfg:                cfg,
+		outboxWake:         make(chan struct{}, 1),
+		APIClientInterface: api_client.NewAPIClient(log, repo.PatentProvider, cfg),
 		DBClient:           db_client.NewDBClient(log, repo.DBRepository),
 		BrokerClient:       broker_client.NewBrokerClient(log, repo.BrokerRepository),
+		UploadJobClient:    job_client.NewJobClient(log, repo.UploadJobRepository),
 	}
 }
 
 type APIClientInterface interface {
-	GetData(input model.UploadInput) error
+	GetData(ctx context.Context, input model.UploadInput) ([]model.FilteredFullPatent, error)
 	FilterPatents(ctx context.Context, req model.Filters) (*model.FilteredPatentsResponse, error)
 	GetStatistics(ctx context.Context, parsedFilters []model.SingleParsedFilter) (*map[string]interface{}, int, error)
 	ParseFilters(filters model.Filters) ([]model.SingleParsedFilter, error)
-	GetFilteredChunkFullPatentRaw(ctx context.Context, parsedFilters []model.SingleParsedFilter, offset int, limit int) (*[]byte, error)
-	ParseFullPatent(patent interface{}) model.FilteredFullPatent
+	GetFilteredChunkFullPatents(ctx context.Context, parsedFilters []model.SingleParsedFilter, offset int, limit int) ([]model.FilteredFullPatent, error)
+	UpstreamStatus() model.CircuitBreakerStatus
+	ExplainFilters(ctx context.Context, filters model.Filters) (*model.FilterExplanation, error)
 }
 
 type DBClient interface {
-	HandleSavePatents(ctx context.Context, patents []model.FilteredFullPatent, transactionId, bundleId uuid.UUID) error
+	HandleSavePatents(ctx context.Context, patents []model.FilteredFullPatent, transactionId, bundleId uuid.UUID) (model.SaveStats, error)
+	NewPatentWriter(ctx context.Context, atomic bool) (repository.PatentWriter, error)
+	ListPatents(ctx context.Context, input model.PatentListInput) ([]model.StoredPatent, error)
+	ListTransactionFamilyMembers(ctx context.Context, transactionId uuid.UUID) ([]model.FamilyMember, error)
+	SuppressFamilyMembers(ctx context.Context, transactionId, bundleId uuid.UUID, suppressions []model.FamilySuppression) error
+	CitationNeighbourhood(ctx context.Context, input model.CitationNeighbourhoodInput) (*model.CitationNeighbourhood, error)
+	QueueOutboxMessage(ctx context.Context, message model.OutboxMessage) error
+	RelayOutbox(ctx context.Context, limit int, publish func(context.Context, model.OutboxMessage) error) (int, error)
 }
 
 type BrokerClient interface {
 	ListenPatentUpload(ctx context.Context, handler func(context.Context, []byte) ([]byte, error))
+	BrokerStatus() model.BrokerStatus
+	ListDeadLetters(ctx context.Context, input model.DeadLetterListInput) ([]model.DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, input model.DeadLetterReplayInput) (model.DeadLetterReplayOutput, error)
+	Publish(ctx context.Context, message model.OutboxMessage) error
 }
 
+type UploadJobClient interface {
+	CreateUploadJob(ctx context.Context, payload model.UploadPatentPayload) error
+	StartUploadJob(ctx context.Context, transactionId uuid.UUID, totalPatents int)
+	AddUploadJobProgress(ctx context.Context, transactionId uuid.UUID, pages, parsed int)
+	CompleteUploadJob(ctx context.Context, transactionId uuid.UUID, messages ...model.OutboxMessage) error
+	FailUploadJob(ctx context.Context, transactionId uuid.UUID, jobErr error)
+	ListUploadJobCheckpoints(ctx context.Context, transactionId uuid.UUID) ([]int, error)
+	GetUploadJob(ctx context.Context, transactionId uuid.UUID) (*model.UploadJob, error)
+	ListUploadJobs(ctx context.Context, input model.UploadJobListInput) ([]model.UploadJob, error)
+}
+
+func (s Service) Status() model.ServiceStatus {
+	return model.ServiceStatus{
+		KTMine: s.APIClientInterface.UpstreamStatus(),
+		Broker: s.BrokerClient.BrokerStatus(),
+	}
+}
+
+// UploadPatentHandler processes one broker upload payload and tracks its
+// progress in the upload job recorded under the payload's transaction id.
+// The result is not returned to the consumer but queued in the outbox with the
+// job's completion and published by the outbox relay, as are the lifecycle
+// events of the upload. A payload that cannot be read or recorded as a job is
+// still reported by a failed event, carrying the message's correlation id.
 func (s Service) UploadPatentHandler(ctx context.Context, payload []byte) ([]byte, error) {
 	var parsedPayload model.UploadPatentPayload
 	if err := json.Unmarshal(payload, &parsedPayload); err != nil {
-		return nil, fmt.Errorf("failed to parse body: %w", err)
+		err = fmt.Errorf("%w: failed to parse body: %w", model.ErrInvalidPayload, err)
+		s.publishUploadFailed(ctx, parsedPayload, err)
+		return nil, err
 	}
-	convertedFilters, err := s.APIClientInterface.ParseFilters(parsedPayload.Filters)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert filters: %w", err)
+	if options := parsedPayload.FamilyDedup; options != nil {
+		if err := options.Validate(); err != nil {
+			err = fmt.Errorf("%w: invalid family_dedup: %w", model.ErrInvalidPayload, err)
+			s.publishUploadFailed(ctx, parsedPayload, err)
+			return nil, err
+		}
+		options.Sanitize(s.cfg.FamilyJurisdictionPreference)
 	}
-	_, totalPatents, err := s.APIClientInterface.GetStatistics(ctx, convertedFilters)
+	if err := s.UploadJobClient.CreateUploadJob(ctx, parsedPayload); err != nil {
+		err = fmt.Errorf("failed to create upload job: %w", err)
+		s.publishUploadFailed(ctx, parsedPayload, err)
+		return nil, err
+	}
+
+	stats, err := s.uploadFilteredPatents(ctx, parsedPayload)
+	var collapsed int
+	if err == nil && parsedPayload.FamilyDedup != nil {
+		collapsed, err = s.collapseFamilies(ctx, parsedPayload)
+	}
+	// the job must be finished even when the upload was cancelled
+	jobCtx := context.WithoutCancel(ctx)
 	if err != nil {
+		s.UploadJobClient.FailUploadJob(jobCtx, parsedPayload.TransactionId, err)
+		s.publishUploadFailed(ctx, parsedPayload, err)
 		return nil, err
 	}
 
-	parsedResponse := make([]model.FilteredFullPatent, 0, totalPatents)
-	var mu sync.Mutex
-	const fetchWorkers = 8
-	const parseWorkers = 2
-
-	itemChan := make(chan int)
-	fetchedChan := make(chan *[]byte)
-	errCh := make(chan error, 1)
-
-	var wgFetch sync.WaitGroup
-	wgFetch.Add(fetchWorkers)
-	for i := 0; i < fetchWorkers; i++ {
-		go func() {
-			defer wgFetch.Done()
-			for offset := range itemChan {
-				data, err := s.APIClientInterface.GetFilteredChunkFullPatentRaw(ctx, convertedFilters, offset*20, 20)
-				if err != nil {
-					select {
-					case errCh <- err:
-					default:
-					}
-					return
-				}
-				fetchedChan <- data
-			}
-		}()
-	}
-
-	var wgParse sync.WaitGroup
-	wgParse.Add(parseWorkers)
-	for i := 0; i < parseWorkers; i++ {
-		go func() {
-			defer wgParse.Done()
-			for rawData := range fetchedChan {
-				parsed, err := s.parse(rawData)
-				if err != nil {
-					select {
-					case errCh <- err:
-					default:
-					}
-					return
-				}
-				mu.Lock()
-				parsedResponse = append(parsedResponse, parsed...)
-				mu.Unlock()
-			}
-		}()
-	}
-	go func() {
-		defer close(itemChan)
-		for i := 0; i < totalPatents; i += 20 {
-			select {
-			case itemChan <- i:
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	response := model.AnalyzePatentsOutput{
+		TransactionId: parsedPayload.TransactionId,
+		BundleId:      parsedPayload.BundleId,
+		SaveStats:     stats,
+		Collapsed:     collapsed,
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert response: %s", err)
+	}
+	messages := []model.OutboxMessage{model.NewUploadResultMessage(parsedPayload.TransactionId, jsonResponse)}
+	completed, ok, err := s.uploadEventMessage(model.UploadEvent{
+		Type:          model.UploadCompleted,
+		TransactionId: parsedPayload.TransactionId,
+		BundleId:      parsedPayload.BundleId,
+		CorrelationId: model.CorrelationIdFrom(ctx),
+		SaveStats:     &stats,
+		Collapsed:     collapsed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		messages = append(messages, completed)
+	}
+	if err := s.UploadJobClient.CompleteUploadJob(jobCtx, parsedPayload.TransactionId, messages...); err != nil {
+		// the patents are saved, so the retry resumes from the checkpoints
+		err = fmt.Errorf("failed to complete upload job: %w", err)
+		s.publishUploadFailed(ctx, parsedPayload, err)
+		return nil, err
+	}
+	s.wakeOutboxRelay()
+	return nil, nil
+}
 
-	go func() {
-		wgFetch.Wait()
-		close(fetchedChan)
-	}()
-	wgParse.Wait()
+// UploadPatents imports a hand-picked list of publication numbers into a bundle
+// and reports which of them were found, not found or repeated in the input.
+func (s Service) UploadPatents(ctx context.Context, input model.UploadInput) (*model.UploadReport, error) {
+	report := &model.UploadReport{
+		TransactionId: input.TransactionId,
+		BundleId:      input.BundleId,
+		Found:         make([]string, 0, len(input.PublicationNumbers)),
+		NotFound:      make([]string, 0),
+		Duplicates:    make([]string, 0),
+	}
 
-	select {
-	case err := <-errCh:
-		return nil, err
-	default:
-		err = s.DBClient.HandleSavePatents(ctx, parsedResponse, parsedPayload.TransactionId, parsedPayload.BundleId)
-		if err != nil {
-			return nil, fmt.Errorf("failed to save data: %s", err)
+	// the report lists numbers as the caller wrote them; inputs maps each
+	// normalized number to its first spelling
+	inputs := make(map[string]string, len(input.PublicationNumbers))
+	requested := make([]string, 0, len(input.PublicationNumbers))
+	for _, number := range input.PublicationNumbers {
+		normalized := utils.NormalizePublicationNumber(number)
+		if normalized == "" {
+			continue
 		}
-		response := model.AnalyzePatentsOutput{TransactionId: parsedPayload.TransactionId, BundleId: parsedPayload.BundleId}
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert response: %s", err)
+		if _, exists := inputs[normalized]; exists {
+			report.Duplicates = append(report.Duplicates, number)
+			continue
 		}
-
-		return jsonResponse, err
+		inputs[normalized] = number
+		requested = append(requested, normalized)
 	}
-}
+	input.PublicationNumbers = requested
 
-func (s Service) parse(patents *[]byte) ([]model.FilteredFullPatent, error) {
-	var data map[string]interface{}
-	err := json.Unmarshal(*patents, &data)
+	patents, err := s.APIClientInterface.GetData(ctx, input)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch patents: %w", err)
 	}
-	response, ok := data["response"].(map[string]interface{})
-	if !ok {
-		return nil, errors.New("can't parse response body")
+
+	toSave := make([]model.FilteredFullPatent, 0, len(patents))
+	saved := make(map[string]struct{}, len(patents))
+	for _, number := range requested {
+		found := false
+		for _, patent := range patents {
+			returned := utils.NormalizePublicationNumber(patent.Patent.PublicationNumber)
+			if !utils.MatchPublicationNumber(number, returned) {
+				continue
+			}
+			found = true
+			if _, exists := saved[returned]; !exists {
+				saved[returned] = struct{}{}
+				toSave = append(toSave, patent)
+			}
+		}
+		if found {
+			report.Found = append(report.Found, inputs[number])
+		} else {
+			report.NotFound = append(report.NotFound, inputs[number])
+		}
 	}
-	items, ok := response["items"].([]interface{})
-	parsedResponse := make([]model.FilteredFullPatent, 0, 20)
-	for _, patent := range items {
-		parsedPatent := s.APIClientInterface.ParseFullPatent(patent)
-		parsedResponse = append(parsedResponse, parsedPatent)
+
+	if len(toSave) > 0 {
+		stats, err := s.DBClient.HandleSavePatents(ctx, toSave, input.TransactionId, input.BundleId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save data: %w", err)
+		}
+		report.SaveStats = stats
 	}
-	return parsedResponse, nil
+	report.TotalSaved = len(toSave)
+	return report, nil
 }
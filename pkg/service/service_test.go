@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+type stubAPIClient struct {
+	APIClientInterface
+	patents []model.FilteredFullPatent
+}
+
+func (c stubAPIClient) GetData(ctx context.Context, input model.UploadInput) ([]model.FilteredFullPatent, error) {
+	return c.patents, nil
+}
+
+type stubDBClient struct {
+	DBClient
+}
+
+func (c stubDBClient) HandleSavePatents(
+	ctx context.Context,
+	patents []model.FilteredFullPatent,
+	transactionId, bundleId uuid.UUID,
+) (model.SaveStats, error) {
+	return model.SaveStats{Inserted: len(patents)}, nil
+}
+
+func TestUploadPatentsReportsInputSpelling(t *testing.T) {
+	s := Service{
+		log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		APIClientInterface: stubAPIClient{patents: []model.FilteredFullPatent{
+			{Patent: model.FilteredPatent{PublicationNumber: "US10000000B2"}},
+		}},
+		DBClient: stubDBClient{},
+	}
+
+	report, err := s.UploadPatents(context.Background(), model.UploadInput{
+		PublicationNumbers: []string{"us 10,000,000", "EP-1234567", "US10000000", "ep 1234567"},
+	})
+	if err != nil {
+		t.Fatalf("UploadPatents: %v", err)
+	}
+	if want := []string{"us 10,000,000"}; !reflect.DeepEqual(report.Found, want) {
+		t.Errorf("Found = %v, want %v", report.Found, want)
+	}
+	if want := []string{"EP-1234567"}; !reflect.DeepEqual(report.NotFound, want) {
+		t.Errorf("NotFound = %v, want %v", report.NotFound, want)
+	}
+	if want := []string{"US10000000", "ep 1234567"}; !reflect.DeepEqual(report.Duplicates, want) {
+		t.Errorf("Duplicates = %v, want %v", report.Duplicates, want)
+	}
+	if report.TotalSaved != 1 {
+		t.Errorf("TotalSaved = %d, want 1", report.TotalSaved)
+	}
+}
+
+type outboxRecorder struct {
+	DBClient
+	messages []model.OutboxMessage
+}
+
+func (c *outboxRecorder) QueueOutboxMessage(ctx context.Context, message model.OutboxMessage) error {
+	c.messages = append(c.messages, message)
+	return nil
+}
+
+func TestPublishUploadFailedSkipsCancelledUploads(t *testing.T) {
+	outbox := &outboxRecorder{}
+	s := Service{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg:        &config.Config{UploadEventsRoutingKey: "upload.events"},
+		outboxWake: make(chan struct{}, 1),
+		DBClient:   outbox,
+	}
+	payload := model.UploadPatentPayload{TransactionId: uuid.New()}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.publishUploadFailed(cancelled, payload, context.Canceled)
+	if len(outbox.messages) != 0 {
+		t.Fatalf("queued %d events for a cancelled upload, want none", len(outbox.messages))
+	}
+
+	s.publishUploadFailed(context.Background(), payload, errors.New("provider down"))
+	if len(outbox.messages) != 1 {
+		t.Fatalf("queued %d events for a failed upload, want one", len(outbox.messages))
+	}
+}
+
+func TestUploadPatentHandlerReportsUnreadablePayloads(t *testing.T) {
+	outbox := &outboxRecorder{}
+	s := Service{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg:        &config.Config{UploadEventsRoutingKey: "upload.events"},
+		outboxWake: make(chan struct{}, 1),
+		DBClient:   outbox,
+	}
+
+	ctx := model.WithCorrelationId(context.Background(), "request-1")
+	if _, err := s.UploadPatentHandler(ctx, []byte("{not json")); !errors.Is(err, model.ErrInvalidPayload) {
+		t.Fatalf("err = %v, want ErrInvalidPayload", err)
+	}
+	if len(outbox.messages) != 1 {
+		t.Fatalf("queued %d events, want one", len(outbox.messages))
+	}
+	var event model.UploadEvent
+	if err := json.Unmarshal(outbox.messages[0].Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != model.UploadFailed || event.CorrelationId != "request-1" || event.ErrorClass != model.UploadErrorInvalidPayload {
+		t.Errorf("event = %+v, want a failed invalid_payload event for request-1", event)
+	}
+}
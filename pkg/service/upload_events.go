@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"log/slog"
+	"time"
+)
+
+func (s Service) uploadEventsEnabled() bool {
+	return s.cfg.UploadEventsExchange != "" || s.cfg.UploadEventsRoutingKey != ""
+}
+
+// uploadEventMessage wraps event in an outbox message addressed to the
+// configured events exchange. ok is false when events are disabled.
+func (s Service) uploadEventMessage(event model.UploadEvent) (message model.OutboxMessage, ok bool, err error) {
+	if !s.uploadEventsEnabled() {
+		return model.OutboxMessage{}, false, nil
+	}
+	event.OccurredAt = time.Now()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return model.OutboxMessage{}, false, fmt.Errorf("failed to marshal upload event: %w", err)
+	}
+	return model.NewUploadEventMessage(s.cfg.UploadEventsExchange, s.cfg.UploadEventsRoutingKey, payload), true, nil
+}
+
+// publishUploadEvent queues event in the outbox for the relay to publish.
+// Like the job progress updates it is best effort: a lost event is logged and
+// never fails the upload.
+func (s Service) publishUploadEvent(ctx context.Context, event model.UploadEvent) {
+	op := "service.publishUploadEvent"
+	event.CorrelationId = model.CorrelationIdFrom(ctx)
+	message, ok, err := s.uploadEventMessage(event)
+	if err == nil && ok {
+		err = s.DBClient.QueueOutboxMessage(ctx, message)
+	}
+	if err != nil {
+		s.log.Error("failed to queue upload event",
+			slog.String("op", op),
+			slog.String("transaction_id", event.TransactionId.String()),
+			slog.String("type", string(event.Type)),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if ok {
+		s.wakeOutboxRelay()
+	}
+}
+
+// publishUploadFailed reports a failed upload attempt. ctx is the upload's
+// own context: an upload cut short by shutdown did not fail, the broker
+// redelivers it after the restart, so nothing is reported.
+func (s Service) publishUploadFailed(ctx context.Context, payload model.UploadPatentPayload, uploadErr error) {
+	if ctx.Err() != nil {
+		return
+	}
+	s.publishUploadEvent(ctx, model.UploadEvent{
+		Type:          model.UploadFailed,
+		TransactionId: payload.TransactionId,
+		BundleId:      payload.BundleId,
+		ErrorClass:    model.ClassifyUploadError(uploadErr),
+		Error:         uploadErr.Error(),
+	})
+}
+
+// uploadProgress emits a progress event every cfg.UploadEventsProgressPages
+// pages handed to the writer. It is only used by the writer loop.
+type uploadProgress struct {
+	event    model.UploadEvent
+	every    int
+	reported int
+}
+
+func (s Service) newUploadProgress(payload model.UploadPatentPayload, totalPatents, pagesDone int) *uploadProgress {
+	return &uploadProgress{
+		event: model.UploadEvent{
+			Type:          model.UploadProgress,
+			TransactionId: payload.TransactionId,
+			BundleId:      payload.BundleId,
+			TotalPatents:  totalPatents,
+			TotalPages:    (totalPatents + model.UploadPageSize - 1) / model.UploadPageSize,
+			PagesDone:     pagesDone,
+		},
+		every:    s.cfg.UploadEventsProgressPages,
+		reported: pagesDone,
+	}
+}
+
+// started returns the started event, which reports the pages done by earlier
+// attempts.
+func (p *uploadProgress) started() model.UploadEvent {
+	event := p.event
+	event.Type = model.UploadStarted
+	return event
+}
+
+// page counts a page and returns a progress event when one is due.
+func (p *uploadProgress) page(patents int) (model.UploadEvent, bool) {
+	p.event.PagesDone++
+	p.event.PatentsParsed += patents
+	if p.every <= 0 || p.event.PagesDone-p.reported < p.every {
+		return model.UploadEvent{}, false
+	}
+	p.reported = p.event.PagesDone
+	return p.event, true
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/utils"
+	"log/slog"
+	"sync"
+)
+
+type fetchedPage struct {
+	offset  int
+	patents []model.FilteredFullPatent
+	size    int64
+}
+
+// uploadFilteredPatents streams every page matching the payload's filters to
+// the database: fetch workers pull pages from the provider, parse workers
+// prepare them for storage and a single writer saves them in batches of
+// cfg.UploadBatchSize patents. The stages are joined by unbuffered channels
+// and pages hold a share of cfg.UploadMemoryLimit from the moment they are
+// fetched until they are written, so a slow database stalls fetching instead
+// of piling patents up in memory.
+//
+// Each batch records the offsets of its pages, so a redelivered payload skips
+// the pages a previous attempt already saved. The returned stats include the
+// batches saved by earlier attempts.
+func (s Service) uploadFilteredPatents(ctx context.Context, payload model.UploadPatentPayload) (model.SaveStats, error) {
+	op := "service.uploadFilteredPatents"
+	log := s.log.With(slog.String("op", op), slog.String("transaction_id", payload.TransactionId.String()))
+
+	convertedFilters, err := s.APIClientInterface.ParseFilters(payload.Filters)
+	if err != nil {
+		return model.SaveStats{}, fmt.Errorf("failed to convert filters: %w", err)
+	}
+	_, totalPatents, err := s.APIClientInterface.GetStatistics(ctx, convertedFilters)
+	if err != nil {
+		return model.SaveStats{}, err
+	}
+	checkpoints, err := s.UploadJobClient.ListUploadJobCheckpoints(ctx, payload.TransactionId)
+	if err != nil {
+		return model.SaveStats{}, fmt.Errorf("failed to load checkpoints: %w", err)
+	}
+	completed := make(map[int]struct{}, len(checkpoints))
+	for _, offset := range checkpoints {
+		completed[offset] = struct{}{}
+	}
+	var stats model.SaveStats
+	if len(completed) > 0 {
+		job, err := s.UploadJobClient.GetUploadJob(ctx, payload.TransactionId)
+		if err != nil {
+			return stats, fmt.Errorf("failed to load upload job: %w", err)
+		}
+		// keep the page grid of the first attempt so checkpointed offsets stay valid
+		if job.TotalPatents > 0 {
+			totalPatents = job.TotalPatents
+		}
+		stats = model.SaveStats{Inserted: job.Inserted, Updated: job.Updated, Unchanged: job.Unchanged}
+		log.Info("resuming upload", slog.Int("completed_pages", len(completed)))
+	}
+	s.UploadJobClient.StartUploadJob(ctx, payload.TransactionId, totalPatents)
+	progress := s.newUploadProgress(payload, totalPatents, len(completed))
+	s.publishUploadEvent(ctx, progress.started())
+
+	writer, err := s.DBClient.NewPatentWriter(ctx, payload.AllOrNothing)
+	if err != nil {
+		return model.SaveStats{}, fmt.Errorf("failed to open patent writer: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	budget := newMemoryBudget(s.cfg.UploadMemoryLimit)
+	offsets := make(chan int)
+	fetched := make(chan fetchedPage)
+	parsed := make(chan fetchedPage)
+	errCh := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+		cancel()
+	}
+
+	go func() {
+		defer close(offsets)
+		for offset := 0; offset < totalPatents; offset += model.UploadPageSize {
+			if _, done := completed[offset]; done {
+				continue
+			}
+			select {
+			case offsets <- offset:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wgFetch sync.WaitGroup
+	wgFetch.Add(s.cfg.UploadFetchWorkers)
+	for i := 0; i < s.cfg.UploadFetchWorkers; i++ {
+		go func() {
+			defer wgFetch.Done()
+			for offset := range offsets {
+				data, err := s.APIClientInterface.GetFilteredChunkFullPatents(ctx, convertedFilters, offset, model.UploadPageSize)
+				if err != nil {
+					fail(err)
+					return
+				}
+				page := fetchedPage{offset: offset, patents: data, size: patentsSize(data)}
+				if err := budget.acquire(ctx, page.size); err != nil {
+					return
+				}
+				s.UploadJobClient.AddUploadJobProgress(ctx, payload.TransactionId, 1, 0)
+				select {
+				case fetched <- page:
+				case <-ctx.Done():
+					budget.release(page.size)
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wgFetch.Wait()
+		close(fetched)
+	}()
+
+	// seen drops patents that shift onto a later page while the upload runs
+	var seenMu sync.Mutex
+	seen := make(map[string]struct{}, totalPatents)
+	var wgParse sync.WaitGroup
+	wgParse.Add(s.cfg.UploadParseWorkers)
+	for i := 0; i < s.cfg.UploadParseWorkers; i++ {
+		go func() {
+			defer wgParse.Done()
+			for page := range fetched {
+				patents := make([]model.FilteredFullPatent, 0, len(page.patents))
+				seenMu.Lock()
+				for _, patent := range page.patents {
+					number := utils.NormalizePublicationNumber(patent.Patent.PublicationNumber)
+					if _, exists := seen[number]; exists {
+						continue
+					}
+					seen[number] = struct{}{}
+					patents = append(patents, patent)
+				}
+				seenMu.Unlock()
+				page.patents = patents
+
+				s.UploadJobClient.AddUploadJobProgress(ctx, payload.TransactionId, 0, len(patents))
+				select {
+				case parsed <- page:
+				case <-ctx.Done():
+					budget.release(page.size)
+				}
+			}
+		}()
+	}
+	go func() {
+		wgParse.Wait()
+		close(parsed)
+	}()
+
+	batch := model.PatentBatch{TransactionId: payload.TransactionId, BundleId: payload.BundleId}
+	var batchSize int64
+	flush := func() error {
+		if len(batch.PageOffsets) == 0 {
+			return nil
+		}
+		written, err := writer.Write(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("failed to save data: %w", err)
+		}
+		stats.Add(written)
+		budget.release(batchSize)
+		batch.Patents, batch.PageOffsets, batchSize = nil, nil, 0
+		return nil
+	}
+	for parsed != nil {
+		select {
+		case page, ok := <-parsed:
+			if !ok {
+				parsed = nil
+				continue
+			}
+			if ctx.Err() != nil {
+				budget.release(page.size)
+				continue
+			}
+			batch.Patents = append(batch.Patents, page.patents...)
+			batch.PageOffsets = append(batch.PageOffsets, page.offset)
+			batchSize += page.size
+			if event, due := progress.page(len(page.patents)); due {
+				s.publishUploadEvent(ctx, event)
+			}
+			// a fetch worker waiting for memory may have signalled pressure
+			// before this page arrived; only a flush releases what it needs
+			if len(batch.Patents) < s.cfg.UploadBatchSize && !budget.waiting() {
+				continue
+			}
+		case <-budget.pressure:
+			// a fetch worker is waiting for memory the pending batch holds
+			if ctx.Err() != nil {
+				continue
+			}
+		}
+		if err := flush(); err != nil {
+			fail(err)
+		}
+	}
+
+	if err == nil {
+		select {
+		case err = <-errCh:
+		default:
+			err = ctx.Err()
+		}
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if rollbackErr := writer.Rollback(); rollbackErr != nil {
+			log.Error("failed to roll back upload", slog.String("error", rollbackErr.Error()))
+		}
+		return model.SaveStats{}, err
+	}
+	if err := writer.Commit(); err != nil {
+		return model.SaveStats{}, err
+	}
+	return stats, nil
+}
+
+// patentsSize estimates the memory held by a page of patents from its text,
+// which dwarfs everything else in a full patent.
+func patentsSize(patents []model.FilteredFullPatent) int64 {
+	var size int64
+	for _, patent := range patents {
+		size += int64(len(patent.Description) + len(patent.Abstract) + len(patent.Patent.Title))
+		for _, claim := range patent.Claims {
+			size += int64(len(claim.IndependentClaim))
+			for _, dependant := range claim.DependantClaims {
+				size += int64(len(dependant))
+			}
+		}
+	}
+	return size
+}
+
+// memoryBudget caps the bytes held by pages in flight. A page larger than the
+// whole budget is still let through once nothing else is held. Every time a
+// caller has to wait, pressure is signalled so the writer can flush a partial
+// batch rather than wait for pages that cannot be fetched. The signal may
+// reach the writer before the pages holding the budget do, so the writer also
+// flushes every page it receives while waiting reports callers.
+type memoryBudget struct {
+	mu       sync.Mutex
+	limit    int64
+	used     int64
+	waiters  int
+	released chan struct{}
+	pressure chan struct{}
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{
+		limit:    limit,
+		released: make(chan struct{}),
+		pressure: make(chan struct{}, 1),
+	}
+}
+
+func (b *memoryBudget) acquire(ctx context.Context, size int64) error {
+	for {
+		b.mu.Lock()
+		if b.limit <= 0 || b.used == 0 || b.used+size <= b.limit {
+			b.used += size
+			b.mu.Unlock()
+			return nil
+		}
+		released := b.released
+		b.waiters++
+		b.mu.Unlock()
+
+		select {
+		case b.pressure <- struct{}{}:
+		default:
+		}
+		var err error
+		select {
+		case <-released:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		b.mu.Lock()
+		b.waiters--
+		b.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// waiting reports whether a caller is blocked in acquire.
+func (b *memoryBudget) waiting() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.waiters > 0
+}
+
+func (b *memoryBudget) release(size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= size
+	close(b.released)
+	b.released = make(chan struct{})
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/config"
+	"github.com/vpnvsk/amunetip-patent-upload/internal/model"
+	"github.com/vpnvsk/amunetip-patent-upload/pkg/repository"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pagedAPIClient serves total patents whose descriptions are descriptionSize
+// bytes long.
+type pagedAPIClient struct {
+	APIClientInterface
+	total           int
+	descriptionSize int
+}
+
+func (c pagedAPIClient) ParseFilters(filters model.Filters) ([]model.SingleParsedFilter, error) {
+	return nil, nil
+}
+
+func (c pagedAPIClient) GetStatistics(ctx context.Context, parsedFilters []model.SingleParsedFilter) (*map[string]interface{}, int, error) {
+	return nil, c.total, nil
+}
+
+func (c pagedAPIClient) GetFilteredChunkFullPatents(
+	ctx context.Context,
+	parsedFilters []model.SingleParsedFilter,
+	offset int,
+	limit int,
+) ([]model.FilteredFullPatent, error) {
+	patents := make([]model.FilteredFullPatent, 0, limit)
+	for i := offset; i < offset+limit && i < c.total; i++ {
+		patents = append(patents, model.FilteredFullPatent{
+			Patent:      model.FilteredPatent{PublicationNumber: fmt.Sprintf("US%08dB2", i)},
+			Description: strings.Repeat("x", c.descriptionSize),
+		})
+	}
+	return patents, nil
+}
+
+type noopJobClient struct {
+	UploadJobClient
+}
+
+func (c noopJobClient) ListUploadJobCheckpoints(ctx context.Context, transactionId uuid.UUID) ([]int, error) {
+	return nil, nil
+}
+
+func (c noopJobClient) StartUploadJob(ctx context.Context, transactionId uuid.UUID, totalPatents int) {
+}
+
+func (c noopJobClient) AddUploadJobProgress(ctx context.Context, transactionId uuid.UUID, pages, parsed int) {
+}
+
+type writerDBClient struct {
+	DBClient
+	writer *countingWriter
+}
+
+func (c writerDBClient) NewPatentWriter(ctx context.Context, atomic bool) (repository.PatentWriter, error) {
+	return c.writer, nil
+}
+
+type countingWriter struct {
+	mu        sync.Mutex
+	batches   int
+	patents   int
+	committed bool
+}
+
+func (w *countingWriter) Write(ctx context.Context, batch model.PatentBatch) (model.SaveStats, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.batches++
+	w.patents += len(batch.Patents)
+	return model.SaveStats{Inserted: len(batch.Patents)}, nil
+}
+
+func (w *countingWriter) Commit() error {
+	w.committed = true
+	return nil
+}
+
+func (w *countingWriter) Rollback() error { return nil }
+
+func TestUploadFinishesWhenBudgetIsBelowBatchSize(t *testing.T) {
+	const total, descriptionSize = 400, 1000
+	writer := &countingWriter{}
+	s := Service{
+		log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg: &config.Config{
+			UploadFetchWorkers: 4,
+			UploadParseWorkers: 2,
+			// the budget holds three pages, so the fourth fetch worker waits on
+			// memory that the writer holds in a batch it would never fill
+			UploadBatchSize:   total,
+			UploadMemoryLimit: 3 * model.UploadPageSize * descriptionSize,
+		},
+		outboxWake:         make(chan struct{}, 1),
+		APIClientInterface: pagedAPIClient{total: total, descriptionSize: descriptionSize},
+		DBClient:           writerDBClient{writer: writer},
+		UploadJobClient:    noopJobClient{},
+	}
+
+	for run := 0; run < 20; run++ {
+		*writer = countingWriter{}
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.uploadFilteredPatents(context.Background(), model.UploadPatentPayload{TransactionId: uuid.New()})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("run %d: %v", run, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("run %d: upload did not finish", run)
+		}
+		if writer.patents != total || !writer.committed {
+			t.Fatalf("run %d: wrote %d patents, committed %v, want %d and true", run, writer.patents, writer.committed, total)
+		}
+		if writer.batches < 2 {
+			t.Errorf("run %d: wrote %d batches, want partial batches under memory pressure", run, writer.batches)
+		}
+	}
+}